@@ -1,15 +1,37 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"todo-app-mongo/internal/config"
+	"todo-app-mongo/internal/pkg/telemetry"
 	"todo-app-mongo/internal/server"
+
+	// time zones of users, wherever the server runs
+	_ "time/tzdata"
 )
 
 func main() {
 
-	server := server.NewServer()
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%s\n", err)
+		os.Exit(2)
+	}
+
+	shutdownTracing, err := telemetry.Setup(context.Background(), cfg.Tracing.Exporter)
+	if err != nil {
+		panic(fmt.Sprintf("cannot setup tracing: %s", err))
+	}
+	defer shutdownTracing(context.Background())
+
+	server, err := server.NewServer(context.Background(), cfg)
+	if err != nil {
+		panic(fmt.Sprintf("cannot connect to database: %s", err))
+	}
 
-	err := server.ListenAndServe()
+	err = server.Run(context.Background())
 	if err != nil {
 		panic(fmt.Sprintf("cannot start server: %s", err))
 	}
@@ -0,0 +1,479 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+)
+
+type Config struct {
+	Server    Server
+	Database  Database
+	JWT       JWT
+	CORS      CORS
+	Health    Health
+	Tracing   Tracing
+	RateLimit RateLimit
+	Login     Login
+	Mailer    Mailer
+	Password  Password
+	Email     Email
+	MFA       MFA
+	OIDC      OIDC
+	Admin     Admin
+	Audit     Audit
+	Todo      Todo
+}
+
+type Server struct {
+	// PublicURL is where clients reach the API, used in emailed links and
+	// calendar feed URLs.
+	PublicURL string
+	// TrustedProxies are the addresses or CIDR ranges of the proxies whose
+	// X-Forwarded-For is believed. Without any the client IP is the peer
+	// address, so clients can't pick the IP rate limits and audit see.
+	TrustedProxies  []string
+	Port            int
+	DrainDelay      time.Duration
+	ShutdownTimeout time.Duration
+}
+
+type Database struct {
+	ConnectionString       string
+	Name                   string
+	MinPoolSize            uint64
+	MaxPoolSize            uint64
+	ConnectTimeout         time.Duration
+	ServerSelectionTimeout time.Duration
+	SocketTimeout          time.Duration
+	RetryWrites            bool
+	ReadPreference         string
+	WriteConcern           string
+	ConnectAttempts        int
+	ConnectBackoff         time.Duration
+}
+
+type JWT struct {
+	SecretKey        string
+	RefreshKey       string
+	TokenLifetime    time.Duration
+	RefreshLifetime  time.Duration
+	MFATokenLifetime time.Duration
+}
+
+type CORS struct {
+	AllowedOrigins []string
+}
+
+type Health struct {
+	CacheTTL     time.Duration
+	CheckTimeout time.Duration
+}
+
+type Tracing struct {
+	Exporter string
+}
+
+// Rate allows Requests per Period.
+type Rate struct {
+	Requests int
+	Period   time.Duration
+}
+
+// RateLimit sets the limits of each route group. Auth covers the anonymous
+// signup, login and refresh routes and is keyed by client IP; User and Todo
+// are keyed by the authenticated email.
+type RateLimit struct {
+	Enabled bool
+	Store   string
+	Auth    Rate
+	User    Rate
+	Todo    Rate
+}
+
+// Login throttles password guessing. After MaxAttempts consecutive
+// failures an account is locked for LockoutDuration, doubled for every
+// following lock up to MaxLockoutDuration. Failed responses are delayed by
+// FailureDelay, doubled per consecutive failure up to MaxFailureDelay. An
+// IP with IPMaxAttempts failures inside IPWindow is blocked for the window.
+type Login struct {
+	MaxAttempts        int
+	LockoutDuration    time.Duration
+	MaxLockoutDuration time.Duration
+	FailureDelay       time.Duration
+	MaxFailureDelay    time.Duration
+	IPMaxAttempts      int
+	IPWindow           time.Duration
+}
+
+type Mailer struct {
+	Driver       string
+	From         string
+	Dir          string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+}
+
+// Password configures the reset flow. ResetURL is the page the emailed
+// link points to; the token is appended as the "token" query parameter.
+type Password struct {
+	ResetTokenTTL time.Duration
+	ResetURL      string
+
+	MinLength          int
+	MaxLength          int
+	RequireLowercase   bool
+	RequireUppercase   bool
+	RequireDigit       bool
+	RequireSymbol      bool
+	RejectPersonalInfo bool
+	BreachedFile       string
+	BreachedMinCount   int
+
+	Hasher            string
+	BcryptCost        int
+	Argon2Memory      int
+	Argon2Iterations  int
+	Argon2Parallelism int
+}
+
+// maxPasswordLength bounds the work an attacker can cause with huge
+// passwords when the hasher has no length limit of its own.
+const maxPasswordLength = 1024
+
+// MFA configures TOTP two-factor authentication. Skew is how many 30s steps
+// before and after the current one are accepted, for clock drift.
+type MFA struct {
+	Issuer        string
+	Skew          int
+	RecoveryCodes int
+}
+
+// OIDC configures login through OpenID Connect providers. Providers are
+// listed by name in oidc.providers and each one is configured under
+// oidc.<name>.* or OIDC_<NAME>_*.
+type OIDC struct {
+	Providers []OIDCProvider
+	StateTTL  time.Duration
+}
+
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+// Admin configures the admin API. Emails lists the accounts made admins on
+// startup, so there is a first admin to hand out roles; only verified
+// accounts are promoted.
+type Admin struct {
+	Emails []string
+}
+
+// Audit configures the audit log. Events are deleted Retention after they
+// happen, or kept forever when it is 0. A new retention only applies to
+// events recorded after the change.
+type Audit struct {
+	Retention time.Duration
+}
+
+// Todo configures the trash and the history. Deleted todos are purged
+// TrashRetention after their deletion, or kept forever when it is 0, by a
+// job running every PurgeInterval. Each todo keeps its MaxRevisions latest
+// revisions, or all of them when it is 0.
+type Todo struct {
+	TrashRetention time.Duration
+	PurgeInterval  time.Duration
+	MaxRevisions   int
+}
+
+const (
+	VerificationPolicyNone         = "none"
+	VerificationPolicyReadOnly     = "read_only"
+	VerificationPolicyLoginRefused = "login_refused"
+)
+
+// Email configures address changes and verification. VerificationPolicy
+// restricts unverified accounts: none, read_only (todos can't be changed)
+// or login_refused.
+type Email struct {
+	ChangeTokenTTL             time.Duration
+	VerificationPolicy         string
+	VerificationTokenTTL       time.Duration
+	VerificationResendInterval time.Duration
+}
+
+var providerNameRegex = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+var readPreferences = map[string]bool{
+	"primary":            true,
+	"primaryPreferred":   true,
+	"secondary":          true,
+	"secondaryPreferred": true,
+	"nearest":            true,
+}
+
+var rateLimitStores = map[string]bool{
+	"memory": true,
+	"mongo":  true,
+}
+
+var mailerDrivers = map[string]bool{
+	"log":  true,
+	"file": true,
+	"smtp": true,
+}
+
+var tracingExporters = map[string]bool{
+	"":        true,
+	"none":    true,
+	"stdout":  true,
+	"console": true,
+	"otlp":    true,
+}
+
+// Validate reports every invalid setting at once so a misconfigured
+// deployment fails at startup with the full list of problems.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Server.PublicURL == "" {
+		errs = append(errs, errors.New("server.public_url is required"))
+	}
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port must be between 1 and 65535, got %d", c.Server.Port))
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if !validProxy(proxy) {
+			errs = append(errs, fmt.Errorf("server.trusted_proxies: %q is not an IP address or CIDR range", proxy))
+		}
+	}
+	if c.Server.DrainDelay < 0 {
+		errs = append(errs, errors.New("server.drain_delay must not be negative"))
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("server.shutdown_timeout must be positive"))
+	}
+
+	if c.Database.ConnectionString == "" {
+		errs = append(errs, errors.New("database.connection_string is required"))
+	}
+	if c.Database.Name == "" {
+		errs = append(errs, errors.New("database.name is required"))
+	}
+	if c.Database.MaxPoolSize != 0 && c.Database.MinPoolSize > c.Database.MaxPoolSize {
+		errs = append(errs, errors.New("database.min_pool_size must not exceed database.max_pool_size"))
+	}
+	if c.Database.ConnectTimeout <= 0 {
+		errs = append(errs, errors.New("database.connect_timeout must be positive"))
+	}
+	if c.Database.ServerSelectionTimeout <= 0 {
+		errs = append(errs, errors.New("database.server_selection_timeout must be positive"))
+	}
+	if c.Database.SocketTimeout < 0 {
+		errs = append(errs, errors.New("database.socket_timeout must not be negative"))
+	}
+	if !readPreferences[c.Database.ReadPreference] {
+		errs = append(errs, fmt.Errorf("database.read_preference %q is not a valid read preference", c.Database.ReadPreference))
+	}
+	if c.Database.WriteConcern != "majority" {
+		if w, err := strconv.Atoi(c.Database.WriteConcern); err != nil || w < 0 {
+			errs = append(errs, fmt.Errorf("database.write_concern must be \"majority\" or a node count, got %q", c.Database.WriteConcern))
+		}
+	}
+	if c.Database.ConnectAttempts < 1 {
+		errs = append(errs, errors.New("database.connect_attempts must be at least 1"))
+	}
+	if c.Database.ConnectBackoff < 0 {
+		errs = append(errs, errors.New("database.connect_backoff must not be negative"))
+	}
+
+	if c.JWT.SecretKey == "" {
+		errs = append(errs, errors.New("jwt.secret_key is required"))
+	}
+	if c.JWT.RefreshKey == "" {
+		errs = append(errs, errors.New("jwt.refresh_key is required"))
+	}
+	if c.JWT.TokenLifetime <= 0 {
+		errs = append(errs, errors.New("jwt.token_lifetime must be positive"))
+	}
+	if c.JWT.RefreshLifetime <= 0 {
+		errs = append(errs, errors.New("jwt.refresh_lifetime must be positive"))
+	}
+	if c.JWT.MFATokenLifetime <= 0 {
+		errs = append(errs, errors.New("jwt.mfa_token_lifetime must be positive"))
+	}
+
+	if len(c.CORS.AllowedOrigins) == 0 {
+		errs = append(errs, errors.New("cors.allowed_origins must not be empty"))
+	}
+
+	if c.Health.CacheTTL < 0 {
+		errs = append(errs, errors.New("health.cache_ttl must not be negative"))
+	}
+	if c.Health.CheckTimeout <= 0 {
+		errs = append(errs, errors.New("health.check_timeout must be positive"))
+	}
+
+	if !tracingExporters[c.Tracing.Exporter] {
+		errs = append(errs, fmt.Errorf("tracing.exporter %q is not one of none, stdout, otlp", c.Tracing.Exporter))
+	}
+
+	if !rateLimitStores[c.RateLimit.Store] {
+		errs = append(errs, fmt.Errorf("rate_limit.store %q is not one of memory, mongo", c.RateLimit.Store))
+	}
+	rates := []struct {
+		name string
+		rate Rate
+	}{{"auth", c.RateLimit.Auth}, {"user", c.RateLimit.User}, {"todo", c.RateLimit.Todo}}
+	for _, r := range rates {
+		if r.rate.Requests < 1 || r.rate.Period < time.Millisecond {
+			errs = append(errs, fmt.Errorf("rate_limit.%s must allow at least one request per period of at least 1ms", r.name))
+		}
+	}
+
+	if c.Login.MaxAttempts < 1 {
+		errs = append(errs, errors.New("login.max_attempts must be at least 1"))
+	}
+	if c.Login.LockoutDuration <= 0 || c.Login.MaxLockoutDuration < c.Login.LockoutDuration {
+		errs = append(errs, errors.New("login.lockout_duration must be positive and not exceed login.max_lockout_duration"))
+	}
+	if c.Login.FailureDelay < 0 || c.Login.MaxFailureDelay < c.Login.FailureDelay {
+		errs = append(errs, errors.New("login.failure_delay must not be negative nor exceed login.max_failure_delay"))
+	}
+	if c.Login.IPMaxAttempts < 1 {
+		errs = append(errs, errors.New("login.ip_max_attempts must be at least 1"))
+	}
+	if c.Login.IPWindow <= 0 {
+		errs = append(errs, errors.New("login.ip_window must be positive"))
+	}
+
+	if !mailerDrivers[c.Mailer.Driver] {
+		errs = append(errs, fmt.Errorf("mailer.driver %q is not supported", c.Mailer.Driver))
+	}
+	if c.Mailer.From == "" {
+		errs = append(errs, errors.New("mailer.from is required"))
+	}
+	if c.Mailer.Driver == "file" && c.Mailer.Dir == "" {
+		errs = append(errs, errors.New("mailer.dir is required by the file driver"))
+	}
+	if c.Mailer.Driver == "smtp" && (c.Mailer.SMTPHost == "" || c.Mailer.SMTPPort < 1) {
+		errs = append(errs, errors.New("mailer.smtp_host and mailer.smtp_port are required by the smtp driver"))
+	}
+
+	if c.Password.ResetTokenTTL <= 0 {
+		errs = append(errs, errors.New("password.reset_token_ttl must be positive"))
+	}
+	if c.Password.ResetURL == "" {
+		errs = append(errs, errors.New("password.reset_url is required"))
+	}
+	if c.Password.MinLength < 1 {
+		errs = append(errs, errors.New("password.min_length must be at least 1"))
+	}
+	if c.Password.MaxLength < c.Password.MinLength || c.Password.MaxLength > maxPasswordLength {
+		errs = append(errs, fmt.Errorf("password.max_length must be between password.min_length and %d", maxPasswordLength))
+	}
+	if c.Password.BreachedMinCount < 1 {
+		errs = append(errs, errors.New("password.breached_min_count must be at least 1"))
+	}
+	switch c.Password.Hasher {
+	case "bcrypt":
+		if c.Password.MaxLength > 72 {
+			errs = append(errs, errors.New("password.max_length must not exceed 72 with bcrypt, which ignores the bytes past it"))
+		}
+		if c.Password.BcryptCost < 10 || c.Password.BcryptCost > 31 {
+			errs = append(errs, errors.New("password.bcrypt_cost must be between 10 and 31"))
+		}
+	case "argon2id":
+		if c.Password.Argon2Memory < 8*c.Password.Argon2Parallelism || c.Password.Argon2Memory > math.MaxUint32 {
+			errs = append(errs, errors.New("password.argon2_memory must be at least 8 KiB per thread"))
+		}
+		if c.Password.Argon2Iterations < 1 {
+			errs = append(errs, errors.New("password.argon2_iterations must be at least 1"))
+		}
+		if c.Password.Argon2Parallelism < 1 || c.Password.Argon2Parallelism > 255 {
+			errs = append(errs, errors.New("password.argon2_parallelism must be between 1 and 255"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("password.hasher %q is not one of argon2id, bcrypt", c.Password.Hasher))
+	}
+
+	if c.Email.ChangeTokenTTL <= 0 {
+		errs = append(errs, errors.New("email.change_token_ttl must be positive"))
+	}
+	switch c.Email.VerificationPolicy {
+	case VerificationPolicyNone, VerificationPolicyReadOnly, VerificationPolicyLoginRefused:
+	default:
+		errs = append(errs, fmt.Errorf("email.verification_policy %q is not one of none, read_only, login_refused", c.Email.VerificationPolicy))
+	}
+	if c.Email.VerificationTokenTTL <= 0 {
+		errs = append(errs, errors.New("email.verification_token_ttl must be positive"))
+	}
+	if c.Email.VerificationResendInterval < 0 {
+		errs = append(errs, errors.New("email.verification_resend_interval must not be negative"))
+	}
+
+	if c.MFA.Issuer == "" {
+		errs = append(errs, errors.New("mfa.issuer is required"))
+	}
+	if c.MFA.Skew < 0 || c.MFA.Skew > 10 {
+		errs = append(errs, errors.New("mfa.skew must be between 0 and 10"))
+	}
+	if c.MFA.RecoveryCodes < 1 {
+		errs = append(errs, errors.New("mfa.recovery_codes must be at least 1"))
+	}
+
+	if c.OIDC.StateTTL <= 0 {
+		errs = append(errs, errors.New("oidc.state_ttl must be positive"))
+	}
+	seen := map[string]bool{}
+	for _, p := range c.OIDC.Providers {
+		if !providerNameRegex.MatchString(p.Name) {
+			errs = append(errs, fmt.Errorf("oidc provider name %q must only contain lowercase letters, digits and _", p.Name))
+		}
+		if seen[p.Name] {
+			errs = append(errs, fmt.Errorf("oidc provider %q is listed twice", p.Name))
+		}
+		seen[p.Name] = true
+
+		if p.Issuer == "" || p.ClientID == "" {
+			errs = append(errs, fmt.Errorf("oidc.%s.issuer and oidc.%s.client_id are required", p.Name, p.Name))
+		}
+		if !slices.Contains(p.Scopes, "openid") {
+			errs = append(errs, fmt.Errorf("oidc.%s.scopes must include openid", p.Name))
+		}
+	}
+
+	if c.Audit.Retention < 0 {
+		errs = append(errs, errors.New("audit.retention must not be negative"))
+	}
+
+	if c.Todo.TrashRetention < 0 {
+		errs = append(errs, errors.New("todo.trash_retention must not be negative"))
+	}
+	if c.Todo.PurgeInterval <= 0 {
+		errs = append(errs, errors.New("todo.purge_interval must be positive"))
+	}
+	if c.Todo.MaxRevisions < 0 {
+		errs = append(errs, errors.New("todo.max_revisions must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func validProxy(proxy string) bool {
+	if _, _, err := net.ParseCIDR(proxy); err == nil {
+		return true
+	}
+
+	return net.ParseIP(proxy) != nil
+}
@@ -0,0 +1,504 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/joho/godotenv/autoload"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// field binds one setting to its file key, environment variable and flag.
+// The flag name is the file key, e.g. -jwt.secret_key.
+type field struct {
+	key   string
+	env   string
+	def   string
+	usage string
+	set   func(c *Config, value string) error
+}
+
+var fields = []field{
+	{"server.public_url", "PUBLIC_URL", "http://localhost:8080", "URL clients use to reach the API, for emailed links and calendar feeds",
+		stringField(func(c *Config) *string { return &c.Server.PublicURL })},
+	{"server.trusted_proxies", "TRUSTED_PROXIES", "", "proxies allowed to set X-Forwarded-For, IPs or CIDR ranges separated by ';'",
+		listField(func(c *Config) *[]string { return &c.Server.TrustedProxies })},
+	{"server.port", "PORT", "8080", "HTTP listen port",
+		intField(func(c *Config) *int { return &c.Server.Port })},
+	{"server.drain_delay", "SHUTDOWN_DRAIN_DELAY", "0s", "delay between failing readiness and shutting down",
+		durationField(func(c *Config) *time.Duration { return &c.Server.DrainDelay }, 0)},
+	{"server.shutdown_timeout", "SHUTDOWN_TIMEOUT", "15s", "time allowed to drain requests and stop components",
+		durationField(func(c *Config) *time.Duration { return &c.Server.ShutdownTimeout }, 0)},
+
+	{"database.connection_string", "DB_CONNECTION_STRING", "", "MongoDB connection string",
+		stringField(func(c *Config) *string { return &c.Database.ConnectionString })},
+	{"database.name", "DB_NAME", "eccom", "MongoDB database name",
+		stringField(func(c *Config) *string { return &c.Database.Name })},
+	{"database.min_pool_size", "DB_MIN_POOL_SIZE", "0", "minimum connections kept in the pool",
+		uintField(func(c *Config) *uint64 { return &c.Database.MinPoolSize })},
+	{"database.max_pool_size", "DB_MAX_POOL_SIZE", "100", "maximum connections in the pool, 0 for unlimited",
+		uintField(func(c *Config) *uint64 { return &c.Database.MaxPoolSize })},
+	{"database.connect_timeout", "DB_CONNECT_TIMEOUT", "10s", "timeout to open a connection",
+		durationField(func(c *Config) *time.Duration { return &c.Database.ConnectTimeout }, 0)},
+	{"database.server_selection_timeout", "DB_SERVER_SELECTION_TIMEOUT", "10s", "timeout to find a suitable server",
+		durationField(func(c *Config) *time.Duration { return &c.Database.ServerSelectionTimeout }, 0)},
+	{"database.socket_timeout", "DB_SOCKET_TIMEOUT", "0s", "socket read/write timeout, 0 for none",
+		durationField(func(c *Config) *time.Duration { return &c.Database.SocketTimeout }, 0)},
+	{"database.retry_writes", "DB_RETRY_WRITES", "true", "retry writes once on transient errors",
+		boolField(func(c *Config) *bool { return &c.Database.RetryWrites })},
+	{"database.read_preference", "DB_READ_PREFERENCE", "primary", "primary, primaryPreferred, secondary, secondaryPreferred or nearest",
+		stringField(func(c *Config) *string { return &c.Database.ReadPreference })},
+	{"database.write_concern", "DB_WRITE_CONCERN", "majority", "\"majority\" or the number of nodes acknowledging writes",
+		stringField(func(c *Config) *string { return &c.Database.WriteConcern })},
+	{"database.connect_attempts", "DB_CONNECT_ATTEMPTS", "5", "pings tried at startup before giving up",
+		intField(func(c *Config) *int { return &c.Database.ConnectAttempts })},
+	{"database.connect_backoff", "DB_CONNECT_BACKOFF", "1s", "initial wait between startup pings, doubled each attempt",
+		durationField(func(c *Config) *time.Duration { return &c.Database.ConnectBackoff }, 0)},
+
+	{"jwt.secret_key", "SECRET_KEY", "", "key signing access tokens",
+		stringField(func(c *Config) *string { return &c.JWT.SecretKey })},
+	{"jwt.refresh_key", "REFRESH_KEY", "", "key signing refresh tokens",
+		stringField(func(c *Config) *string { return &c.JWT.RefreshKey })},
+	{"jwt.token_lifetime", "SECRET_TIME", "15m", "access token lifetime, plain numbers are minutes",
+		durationField(func(c *Config) *time.Duration { return &c.JWT.TokenLifetime }, time.Minute)},
+	{"jwt.refresh_lifetime", "REFRESH_TIME", "10080m", "refresh token lifetime, plain numbers are minutes",
+		durationField(func(c *Config) *time.Duration { return &c.JWT.RefreshLifetime }, time.Minute)},
+	{"jwt.mfa_token_lifetime", "MFA_TOKEN_LIFETIME", "5m", "time to enter the second factor after the password",
+		durationField(func(c *Config) *time.Duration { return &c.JWT.MFATokenLifetime }, 0)},
+
+	{"cors.allowed_origins", "ALLOWED_ORIGINS", "*", "allowed origins separated by ';'",
+		listField(func(c *Config) *[]string { return &c.CORS.AllowedOrigins })},
+
+	{"health.cache_ttl", "HEALTH_CACHE_TTL", "5s", "how long health check results are cached",
+		durationField(func(c *Config) *time.Duration { return &c.Health.CacheTTL }, 0)},
+	{"health.check_timeout", "HEALTH_CHECK_TIMEOUT", "2s", "timeout of a single health check",
+		durationField(func(c *Config) *time.Duration { return &c.Health.CheckTimeout }, 0)},
+
+	{"tracing.exporter", "OTEL_TRACES_EXPORTER", "none", "traces exporter: none, stdout or otlp",
+		stringField(func(c *Config) *string { return &c.Tracing.Exporter })},
+
+	{"rate_limit.enabled", "RATE_LIMIT_ENABLED", "true", "throttle requests per client",
+		boolField(func(c *Config) *bool { return &c.RateLimit.Enabled })},
+	{"rate_limit.store", "RATE_LIMIT_STORE", "memory", "where buckets live: memory or mongo (shared by replicas)",
+		stringField(func(c *Config) *string { return &c.RateLimit.Store })},
+	{"rate_limit.auth", "RATE_LIMIT_AUTH", "10/m", "signup, login and refresh limit per IP, e.g. 10/m",
+		rateField(func(c *Config) *Rate { return &c.RateLimit.Auth })},
+	{"rate_limit.user", "RATE_LIMIT_USER", "60/m", "user routes limit per account",
+		rateField(func(c *Config) *Rate { return &c.RateLimit.User })},
+	{"rate_limit.todo", "RATE_LIMIT_TODO", "300/m", "todo routes limit per account",
+		rateField(func(c *Config) *Rate { return &c.RateLimit.Todo })},
+
+	{"login.max_attempts", "LOGIN_MAX_ATTEMPTS", "5", "consecutive failures before an account is locked",
+		intField(func(c *Config) *int { return &c.Login.MaxAttempts })},
+	{"login.lockout_duration", "LOGIN_LOCKOUT_DURATION", "15m", "first lockout, doubled for each following one",
+		durationField(func(c *Config) *time.Duration { return &c.Login.LockoutDuration }, 0)},
+	{"login.max_lockout_duration", "LOGIN_MAX_LOCKOUT_DURATION", "24h", "longest lockout",
+		durationField(func(c *Config) *time.Duration { return &c.Login.MaxLockoutDuration }, 0)},
+	{"login.failure_delay", "LOGIN_FAILURE_DELAY", "250ms", "delay of the first failed response, doubled per failure",
+		durationField(func(c *Config) *time.Duration { return &c.Login.FailureDelay }, 0)},
+	{"login.max_failure_delay", "LOGIN_MAX_FAILURE_DELAY", "4s", "longest delay of a failed response",
+		durationField(func(c *Config) *time.Duration { return &c.Login.MaxFailureDelay }, 0)},
+	{"login.ip_max_attempts", "LOGIN_IP_MAX_ATTEMPTS", "20", "failures from one IP before it is blocked",
+		intField(func(c *Config) *int { return &c.Login.IPMaxAttempts })},
+	{"login.ip_window", "LOGIN_IP_WINDOW", "15m", "window counting failures per IP",
+		durationField(func(c *Config) *time.Duration { return &c.Login.IPWindow }, 0)},
+
+	{"mailer.driver", "MAILER_DRIVER", "log", "how emails are delivered: log, file or smtp",
+		stringField(func(c *Config) *string { return &c.Mailer.Driver })},
+	{"mailer.from", "MAILER_FROM", "no-reply@todo-app.local", "sender address of emails",
+		stringField(func(c *Config) *string { return &c.Mailer.From })},
+	{"mailer.dir", "MAILER_DIR", "mail", "directory the file driver writes emails to",
+		stringField(func(c *Config) *string { return &c.Mailer.Dir })},
+	{"mailer.smtp_host", "SMTP_HOST", "", "SMTP server host",
+		stringField(func(c *Config) *string { return &c.Mailer.SMTPHost })},
+	{"mailer.smtp_port", "SMTP_PORT", "587", "SMTP server port",
+		intField(func(c *Config) *int { return &c.Mailer.SMTPPort })},
+	{"mailer.smtp_username", "SMTP_USERNAME", "", "SMTP username, empty to skip authentication",
+		stringField(func(c *Config) *string { return &c.Mailer.SMTPUsername })},
+	{"mailer.smtp_password", "SMTP_PASSWORD", "", "SMTP password",
+		stringField(func(c *Config) *string { return &c.Mailer.SMTPPassword })},
+
+	{"password.reset_token_ttl", "PASSWORD_RESET_TOKEN_TTL", "1h", "lifetime of password reset tokens",
+		durationField(func(c *Config) *time.Duration { return &c.Password.ResetTokenTTL }, 0)},
+	{"password.reset_url", "PASSWORD_RESET_URL", "http://localhost:3000/reset-password", "page linked from reset emails",
+		stringField(func(c *Config) *string { return &c.Password.ResetURL })},
+	{"password.min_length", "PASSWORD_MIN_LENGTH", "8", "minimum password length in characters",
+		intField(func(c *Config) *int { return &c.Password.MinLength })},
+	{"password.max_length", "PASSWORD_MAX_LENGTH", "72", "maximum password length in bytes, at most 72 with bcrypt",
+		intField(func(c *Config) *int { return &c.Password.MaxLength })},
+	{"password.require_lowercase", "PASSWORD_REQUIRE_LOWERCASE", "false", "require a lowercase letter",
+		boolField(func(c *Config) *bool { return &c.Password.RequireLowercase })},
+	{"password.require_uppercase", "PASSWORD_REQUIRE_UPPERCASE", "false", "require an uppercase letter",
+		boolField(func(c *Config) *bool { return &c.Password.RequireUppercase })},
+	{"password.require_digit", "PASSWORD_REQUIRE_DIGIT", "false", "require a digit",
+		boolField(func(c *Config) *bool { return &c.Password.RequireDigit })},
+	{"password.require_symbol", "PASSWORD_REQUIRE_SYMBOL", "false", "require a character that is neither a letter nor a digit",
+		boolField(func(c *Config) *bool { return &c.Password.RequireSymbol })},
+	{"password.reject_personal_info", "PASSWORD_REJECT_PERSONAL_INFO", "true", "reject passwords containing the email or name of the user",
+		boolField(func(c *Config) *bool { return &c.Password.RejectPersonalInfo })},
+	{"password.breached_file", "PASSWORD_BREACHED_FILE", "", "sorted SHA1:COUNT file of breached passwords, empty to skip the check",
+		stringField(func(c *Config) *string { return &c.Password.BreachedFile })},
+	{"password.breached_min_count", "PASSWORD_BREACHED_MIN_COUNT", "1", "breach occurrences from which a password is rejected",
+		intField(func(c *Config) *int { return &c.Password.BreachedMinCount })},
+	{"password.hasher", "PASSWORD_HASHER", "argon2id", "algorithm of new password hashes: argon2id or bcrypt",
+		stringField(func(c *Config) *string { return &c.Password.Hasher })},
+	{"password.bcrypt_cost", "PASSWORD_BCRYPT_COST", "12", "bcrypt cost factor",
+		intField(func(c *Config) *int { return &c.Password.BcryptCost })},
+	{"password.argon2_memory", "PASSWORD_ARGON2_MEMORY", "19456", "argon2id memory in KiB",
+		intField(func(c *Config) *int { return &c.Password.Argon2Memory })},
+	{"password.argon2_iterations", "PASSWORD_ARGON2_ITERATIONS", "2", "argon2id passes over the memory",
+		intField(func(c *Config) *int { return &c.Password.Argon2Iterations })},
+	{"password.argon2_parallelism", "PASSWORD_ARGON2_PARALLELISM", "1", "argon2id threads",
+		intField(func(c *Config) *int { return &c.Password.Argon2Parallelism })},
+
+	{"email.change_token_ttl", "EMAIL_CHANGE_TOKEN_TTL", "24h", "lifetime of the link confirming a new email",
+		durationField(func(c *Config) *time.Duration { return &c.Email.ChangeTokenTTL }, 0)},
+	{"email.verification_policy", "EMAIL_VERIFICATION_POLICY", "none", "restriction of unverified accounts: none, read_only or login_refused",
+		stringField(func(c *Config) *string { return &c.Email.VerificationPolicy })},
+	{"email.verification_token_ttl", "EMAIL_VERIFICATION_TOKEN_TTL", "48h", "lifetime of the verification link",
+		durationField(func(c *Config) *time.Duration { return &c.Email.VerificationTokenTTL }, 0)},
+	{"email.verification_resend_interval", "EMAIL_VERIFICATION_RESEND_INTERVAL", "1m", "minimum time between two verification emails",
+		durationField(func(c *Config) *time.Duration { return &c.Email.VerificationResendInterval }, 0)},
+
+	{"mfa.issuer", "MFA_ISSUER", "todo-app", "name shown by authenticator apps",
+		stringField(func(c *Config) *string { return &c.MFA.Issuer })},
+	{"mfa.skew", "MFA_SKEW", "1", "accepted 30s TOTP steps before and after the current one",
+		intField(func(c *Config) *int { return &c.MFA.Skew })},
+	{"mfa.recovery_codes", "MFA_RECOVERY_CODES", "10", "number of recovery codes generated",
+		intField(func(c *Config) *int { return &c.MFA.RecoveryCodes })},
+
+	{"oidc.providers", "OIDC_PROVIDERS", "", "names of the OpenID Connect providers separated by ';'",
+		providersField(func(c *Config) *[]OIDCProvider { return &c.OIDC.Providers })},
+	{"oidc.state_ttl", "OIDC_STATE_TTL", "10m", "time to complete a login at the provider",
+		durationField(func(c *Config) *time.Duration { return &c.OIDC.StateTTL }, 0)},
+
+	{"admin.emails", "ADMIN_EMAILS", "", "emails of the accounts made admins on startup separated by ';'",
+		listField(func(c *Config) *[]string { return &c.Admin.Emails })},
+
+	{"audit.retention", "AUDIT_RETENTION", "2160h", "how long audit events are kept, 0 keeps them forever",
+		durationField(func(c *Config) *time.Duration { return &c.Audit.Retention }, 0)},
+
+	{"todo.trash_retention", "TODO_TRASH_RETENTION", "720h", "how long deleted todos stay in the trash, 0 keeps them forever",
+		durationField(func(c *Config) *time.Duration { return &c.Todo.TrashRetention }, 0)},
+	{"todo.purge_interval", "TODO_PURGE_INTERVAL", "1h", "time between two purges of the expired trash",
+		durationField(func(c *Config) *time.Duration { return &c.Todo.PurgeInterval }, 0)},
+	{"todo.max_revisions", "TODO_MAX_REVISIONS", "50", "revisions kept per todo, 0 keeps them all",
+		intField(func(c *Config) *int { return &c.Todo.MaxRevisions })},
+}
+
+// providerAttributes are the settings of each OIDC provider, read from
+// oidc.<name>.<attribute> in the file or OIDC_<NAME>_<ATTRIBUTE>. They have
+// no flags since the provider names aren't known before parsing.
+var providerAttributes = []string{"issuer", "client_id", "client_secret", "scopes"}
+
+func providerFields(i int, name string) []field {
+	key := "oidc." + name + "."
+	env := "OIDC_" + strings.ToUpper(name) + "_"
+	provider := func(c *Config) *OIDCProvider { return &c.OIDC.Providers[i] }
+
+	return []field{
+		{key + "issuer", env + "ISSUER", "", "issuer URL, discovered through /.well-known/openid-configuration",
+			stringField(func(c *Config) *string { return &provider(c).Issuer })},
+		{key + "client_id", env + "CLIENT_ID", "", "client ID registered at the provider",
+			stringField(func(c *Config) *string { return &provider(c).ClientID })},
+		{key + "client_secret", env + "CLIENT_SECRET", "", "client secret, empty for public clients",
+			stringField(func(c *Config) *string { return &provider(c).ClientSecret })},
+		{key + "scopes", env + "SCOPES", "openid;email;profile", "requested scopes separated by ';'",
+			listField(func(c *Config) *[]string { return &provider(c).Scopes })},
+	}
+}
+
+// Load builds the configuration from, in increasing precedence, the
+// defaults, the file given by -config or CONFIG_FILE, the environment and
+// the command line flags, and validates the result.
+func Load(args []string) (*Config, error) {
+
+	fs := flag.NewFlagSet("todo-app-mongo", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML configuration file")
+	for _, f := range fields {
+		fs.String(f.key, "", fmt.Sprintf("%s (env %s, default %q)", f.usage, f.env, f.def))
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(fields))
+	for _, f := range fields {
+		values[f.key] = f.def
+	}
+
+	if *configFile != "" {
+		fileValues, err := readFile(*configFile)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range fileValues {
+			values[key] = value
+		}
+	}
+
+	for _, f := range fields {
+		if value := os.Getenv(f.env); value != "" {
+			values[f.key] = value
+		}
+	}
+
+	fs.Visit(func(fl *flag.Flag) {
+		if _, ok := values[fl.Name]; ok {
+			values[fl.Name] = fl.Value.String()
+		}
+	})
+
+	cfg := &Config{}
+	var errs []error
+	for _, f := range fields {
+		if err := f.set(cfg, values[f.key]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.key, err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	if err := loadProviders(cfg, values); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// loadProviders sets the attributes of the providers listed in
+// oidc.providers from the file values and the environment.
+func loadProviders(cfg *Config, values map[string]string) error {
+
+	known := map[string]bool{}
+	var errs []error
+
+	for i, p := range cfg.OIDC.Providers {
+		for _, f := range providerFields(i, p.Name) {
+			known[f.key] = true
+
+			value := f.def
+			if v, ok := values[f.key]; ok {
+				value = v
+			}
+			if v := os.Getenv(f.env); v != "" {
+				value = v
+			}
+
+			if err := f.set(cfg, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", f.key, err))
+			}
+		}
+	}
+
+	for key := range values {
+		if isProviderKey(key) && !known[key] {
+			name := strings.Split(key, ".")[1]
+			errs = append(errs, fmt.Errorf("%s: provider %q is not listed in oidc.providers", key, name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func isProviderKey(key string) bool {
+	parts := strings.Split(key, ".")
+	return len(parts) == 3 && parts[0] == "oidc" && slices.Contains(providerAttributes, parts[2])
+}
+
+func readFile(path string) (map[string]string, error) {
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	raw := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &raw)
+	case ".toml":
+		err = toml.Unmarshal(content, &raw)
+	default:
+		return nil, fmt.Errorf("unsupported config file format %q", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing config file: %w", err)
+	}
+
+	values := map[string]string{}
+	flatten("", raw, values)
+
+	known := map[string]bool{}
+	for _, f := range fields {
+		known[f.key] = true
+	}
+
+	var unknown []string
+	for key := range values {
+		if !known[key] && !isProviderKey(key) {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown config keys: %s", strings.Join(unknown, ", "))
+	}
+
+	return values, nil
+}
+
+func flatten(prefix string, raw map[string]interface{}, out map[string]string) {
+	for key, value := range raw {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flatten(key, v, out)
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			out[key] = strings.Join(items, ";")
+		default:
+			out[key] = fmt.Sprint(v)
+		}
+	}
+}
+
+func stringField(ptr func(c *Config) *string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		*ptr(c) = value
+		return nil
+	}
+}
+
+func intField(ptr func(c *Config) *int) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		*ptr(c) = n
+		return nil
+	}
+}
+
+func uintField(ptr func(c *Config) *uint64) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q", value)
+		}
+		*ptr(c) = n
+		return nil
+	}
+}
+
+func boolField(ptr func(c *Config) *bool) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		*ptr(c) = b
+		return nil
+	}
+}
+
+// durationField accepts Go durations ("15m", "1h30m"). When unit is set a
+// plain number is read in that unit, which keeps the older minute-based
+// variables working.
+func durationField(ptr func(c *Config) *time.Duration, unit time.Duration) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		if unit != 0 {
+			if n, err := strconv.Atoi(value); err == nil {
+				*ptr(c) = time.Duration(n) * unit
+				return nil
+			}
+		}
+
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		*ptr(c) = d
+		return nil
+	}
+}
+
+// rateField parses "requests/period" where period is s, m, h or a Go
+// duration, e.g. "10/m" or "5/30s".
+func rateField(ptr func(c *Config) *Rate) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		requests, period, ok := strings.Cut(value, "/")
+		if !ok {
+			return fmt.Errorf("invalid rate %q, expected requests/period", value)
+		}
+
+		n, err := strconv.Atoi(requests)
+		if err != nil {
+			return fmt.Errorf("invalid rate %q", value)
+		}
+
+		units := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+		d, ok := units[period]
+		if !ok {
+			if d, err = time.ParseDuration(period); err != nil {
+				return fmt.Errorf("invalid rate period %q", period)
+			}
+		}
+
+		*ptr(c) = Rate{Requests: n, Period: d}
+		return nil
+	}
+}
+
+func listField(ptr func(c *Config) *[]string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		var items []string
+		for _, item := range strings.Split(value, ";") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*ptr(c) = items
+		return nil
+	}
+}
+
+// providersField creates one provider per name; their attributes are set
+// by loadProviders.
+func providersField(ptr func(c *Config) *[]OIDCProvider) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		var names []string
+		if err := listField(func(*Config) *[]string { return &names })(c, value); err != nil {
+			return err
+		}
+
+		providers := make([]OIDCProvider, len(names))
+		for i, name := range names {
+			providers[i] = OIDCProvider{Name: name}
+		}
+		*ptr(c) = providers
+		return nil
+	}
+}
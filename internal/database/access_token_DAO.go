@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"time"
+	"todo-app-mongo/internal/entity"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// lastUsedPrecision limits how often using a token writes its last use.
+const lastUsedPrecision = time.Minute
+
+type AccessTokenDAOInterface interface {
+	Create(ctx context.Context, token *entity.AccessToken) error
+	GetByPrefix(ctx context.Context, prefix string) (*entity.AccessToken, error)
+	ListByUser(ctx context.Context, userID primitive.ObjectID) ([]*entity.AccessToken, error)
+	Delete(ctx context.Context, userID primitive.ObjectID, id string) error
+	DeleteByUser(ctx context.Context, userID primitive.ObjectID) error
+	Touch(ctx context.Context, id primitive.ObjectID, now time.Time) error
+}
+
+type accessTokenDAO struct {
+	collection *mongo.Collection
+}
+
+func NewAccessTokenDAO(db mongo.Database) *accessTokenDAO {
+	return &accessTokenDAO{
+		collection: db.Collection("access_tokens"),
+	}
+}
+
+func (a *accessTokenDAO) Create(ctx context.Context, token *entity.AccessToken) error {
+	_, err := a.collection.InsertOne(ctx, token)
+	return err
+}
+
+func (a *accessTokenDAO) GetByPrefix(ctx context.Context, prefix string) (*entity.AccessToken, error) {
+
+	var token *entity.AccessToken
+	err := a.collection.FindOne(ctx, bson.M{"prefix": prefix}).Decode(&token)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (a *accessTokenDAO) ListByUser(ctx context.Context, userID primitive.ObjectID) ([]*entity.AccessToken, error) {
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := a.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := []*entity.AccessToken{}
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Delete removes a token of the user. It returns mongo.ErrNoDocuments when
+// the user has no such token.
+func (a *accessTokenDAO) Delete(ctx context.Context, userID primitive.ObjectID, id string) error {
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return mongo.ErrNoDocuments
+	}
+
+	result, err := a.collection.DeleteOne(ctx, bson.M{"_id": objectID, "user_id": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// DeleteByUser removes every token of the user.
+func (a *accessTokenDAO) DeleteByUser(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := a.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+// Touch records a use of the token, at most once per lastUsedPrecision so
+// busy scripts don't cause a write per request.
+func (a *accessTokenDAO) Touch(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+
+	filter := bson.M{
+		"_id": id,
+		"$or": bson.A{
+			bson.M{"last_used_at": nil},
+			bson.M{"last_used_at": bson.M{"$lt": now.Add(-lastUsedPrecision)}},
+		},
+	}
+
+	_, err := a.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"last_used_at": now}})
+	return err
+}
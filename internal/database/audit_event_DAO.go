@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"time"
+	"todo-app-mongo/internal/entity"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditEventDAOInterface has no update or delete: events are only removed
+// by the TTL index once they expire.
+type AuditEventDAOInterface interface {
+	Create(ctx context.Context, event *entity.AuditEvent) error
+	Search(ctx context.Context, filter AuditFilter, limit int64, offset int64) ([]*entity.AuditEvent, int64, error)
+}
+
+// AuditFilter narrows Search, empty fields don't filter. From is inclusive
+// and To exclusive.
+type AuditFilter struct {
+	Action     string
+	Outcome    string
+	ActorID    primitive.ObjectID
+	ActorEmail string
+	TargetType string
+	TargetID   string
+	From       time.Time
+	To         time.Time
+}
+
+type auditEventDAO struct {
+	collection *mongo.Collection
+}
+
+func NewAuditEventDAO(db mongo.Database) *auditEventDAO {
+	return &auditEventDAO{
+		collection: db.Collection("audit_events"),
+	}
+}
+
+func (a *auditEventDAO) Create(ctx context.Context, event *entity.AuditEvent) error {
+	_, err := a.collection.InsertOne(ctx, event)
+	return err
+}
+
+// Search returns a page of the matching events, newest first, and how many
+// match in total.
+func (a *auditEventDAO) Search(ctx context.Context, filter AuditFilter, limit int64, offset int64) ([]*entity.AuditEvent, int64, error) {
+
+	query := bson.M{}
+	if filter.Action != "" {
+		query["action"] = filter.Action
+	}
+	if filter.Outcome != "" {
+		query["outcome"] = filter.Outcome
+	}
+	if !filter.ActorID.IsZero() {
+		query["actor_id"] = filter.ActorID
+	}
+	if filter.ActorEmail != "" {
+		query["actor_email"] = filter.ActorEmail
+	}
+	if filter.TargetType != "" {
+		query["target_type"] = filter.TargetType
+	}
+	if filter.TargetID != "" {
+		query["target_id"] = filter.TargetID
+	}
+	if !filter.From.IsZero() || !filter.To.IsZero() {
+		createdAt := bson.M{}
+		if !filter.From.IsZero() {
+			createdAt["$gte"] = filter.From
+		}
+		if !filter.To.IsZero() {
+			createdAt["$lt"] = filter.To
+		}
+		query["created_at"] = createdAt
+	}
+
+	opts := options.Find().
+		SetLimit(limit).
+		SetSkip(offset).
+		SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := a.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	events := []*entity.AuditEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, 0, err
+	}
+
+	total, err := a.collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return events, total, nil
+}
@@ -4,55 +4,137 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"os"
+	"strconv"
+	"sync"
 	"time"
+	"todo-app-mongo/internal/config"
 
-	_ "github.com/joho/godotenv/autoload"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 )
 
+const maxConnectBackoff = 30 * time.Second
+
 type Service interface {
-	Health() map[string]string
+	Transactor
+	Ping(ctx context.Context) error
+	Close(ctx context.Context) error
 	GetDB() *mongo.Database
 }
 
 type service struct {
 	db *mongo.Database
+
+	mu           sync.Mutex
+	transactions *bool
 }
 
-var (
-	connectionString = os.Getenv("DB_CONNECTION_STRING")
-)
+// New connects to MongoDB and pings it until it answers, waiting
+// cfg.ConnectBackoff (doubled after every failure) between attempts.
+func New(ctx context.Context, cfg config.Database) (Service, error) {
 
-func New() Service {
+	opts, err := clientOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	serverAPI := options.ServerAPI(options.ServerAPIVersion1)
-	opts := options.Client().ApplyURI(connectionString).SetServerAPIOptions(serverAPI)
+	client, err := mongo.Connect(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
 
-	client, err := mongo.Connect(context.Background(), opts)
+	if err := pingWithRetry(ctx, client, cfg); err != nil {
+		_ = client.Disconnect(context.Background())
+		return nil, err
+	}
 
+	return &service{
+		db: client.Database(cfg.Name),
+	}, nil
+}
+
+func clientOptions(cfg config.Database) (*options.ClientOptions, error) {
+
+	mode, err := readpref.ModeFromString(cfg.ReadPreference)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
 
+	readPreference, err := readpref.New(mode)
+	if err != nil {
+		return nil, err
 	}
-	return &service{
-		db: client.Database("eccom"),
+
+	writeConcern := writeconcern.Majority()
+	if cfg.WriteConcern != "majority" {
+		w, err := strconv.Atoi(cfg.WriteConcern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid write concern %q", cfg.WriteConcern)
+		}
+		writeConcern = &writeconcern.WriteConcern{W: w}
 	}
+
+	serverAPI := options.ServerAPI(options.ServerAPIVersion1)
+	opts := options.Client().
+		ApplyURI(cfg.ConnectionString).
+		SetServerAPIOptions(serverAPI).
+		SetMinPoolSize(cfg.MinPoolSize).
+		SetMaxPoolSize(cfg.MaxPoolSize).
+		SetConnectTimeout(cfg.ConnectTimeout).
+		SetServerSelectionTimeout(cfg.ServerSelectionTimeout).
+		SetRetryWrites(cfg.RetryWrites).
+		SetReadPreference(readPreference).
+		SetWriteConcern(writeConcern).
+		SetMonitor(otelmongo.NewMonitor())
+
+	if cfg.SocketTimeout > 0 {
+		opts.SetSocketTimeout(cfg.SocketTimeout)
+	}
+
+	return opts, nil
 }
 
-func (s *service) Health() map[string]string {
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-	defer cancel()
+func pingWithRetry(ctx context.Context, client *mongo.Client, cfg config.Database) error {
 
-	err := s.db.Client().Ping(ctx, nil)
-	if err != nil {
-		log.Fatalf(fmt.Sprintf("db down: %v", err))
+	backoff := cfg.ConnectBackoff
+
+	var err error
+	for attempt := 1; attempt <= cfg.ConnectAttempts; attempt++ {
+		if err = client.Ping(ctx, nil); err == nil {
+			return nil
+		}
+
+		if attempt == cfg.ConnectAttempts {
+			break
+		}
+
+		log.Printf("db ping failed (attempt %d/%d), retrying in %s: %v", attempt, cfg.ConnectAttempts, backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, maxConnectBackoff)
 	}
 
-	return map[string]string{
-		"message": "It's healthy",
+	return fmt.Errorf("db unreachable after %d attempts: %w", cfg.ConnectAttempts, err)
+}
+
+func (s *service) Ping(ctx context.Context) error {
+	if err := s.db.Client().Ping(ctx, nil); err != nil {
+		return fmt.Errorf("db down: %w", err)
 	}
+
+	return nil
+}
+
+func (s *service) Close(ctx context.Context) error {
+	return s.db.Client().Disconnect(ctx)
 }
 
 func (s *service) GetDB() *mongo.Database {
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type collectionIndexes struct {
+	collection string
+	models     []mongo.IndexModel
+}
+
+var indexes = []collectionIndexes{
+	{"todo_user", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "email", Value: 1}}},
+		{Keys: bson.D{{Key: "identities.provider", Value: 1}, {Key: "identities.subject", Value: 1}}},
+		{Keys: bson.D{{Key: "role", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "calendar.token_hash", Value: 1}}, Options: options.Index().SetSparse(true)},
+	}},
+	{"todos", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "scheduled_to", Value: 1}}},
+		{Keys: bson.D{{Key: "deleted_at", Value: 1}}},
+	}},
+	{"todo_revisions", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "todo_id", Value: 1}, {Key: "revision", Value: -1}}, Options: options.Index().SetUnique(true)},
+	}},
+	{"audit_events", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "target_type", Value: 1}, {Key: "target_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	}},
+	{"rate_limits", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	}},
+	{"user_tokens", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "purpose", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	}},
+	{"access_tokens", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "prefix", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	}},
+	{"oidc_states", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "state_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	}},
+}
+
+// EnsureIndexes creates the indexes the DAOs rely on. Creating an index
+// that already exists is a no-op, so it runs on every startup.
+func EnsureIndexes(ctx context.Context, db *mongo.Database) error {
+	for _, idx := range indexes {
+		if _, err := db.Collection(idx.collection).Indexes().CreateMany(ctx, idx.models); err != nil {
+			return fmt.Errorf("creating indexes on %s: %w", idx.collection, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"todo-app-mongo/internal/config"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type migration struct {
+	name string
+	// run applies the migration and returns how many documents changed.
+	// It must be a no-op once applied, migrations run on every startup.
+	run func(ctx context.Context, db *mongo.Database, cfg *config.Config) (int64, error)
+}
+
+var migrations = []migration{
+	{"verify accounts created before email verification", verifyExistingAccounts},
+	{"move admin actions to the audit log", moveAdminActions},
+	{"apply the audit retention to existing events", applyAuditRetention},
+}
+
+// Migrate brings documents written by older versions up to date. Like
+// EnsureIndexes it runs on every startup, before the API serves requests.
+func Migrate(ctx context.Context, db *mongo.Database, cfg *config.Config) error {
+	for _, m := range migrations {
+		changed, err := m.run(ctx, db, cfg)
+		if err != nil {
+			return fmt.Errorf("migration %q: %w", m.name, err)
+		}
+		if changed > 0 {
+			log.Printf("migration %q: %d document(s) changed", m.name, changed)
+		}
+	}
+
+	return nil
+}
+
+// verifyExistingAccounts marks the accounts created before email
+// verification existed as verified, so the login_refused policy doesn't
+// lock their owners out. Those documents have no email_verified field.
+func verifyExistingAccounts(ctx context.Context, db *mongo.Database, _ *config.Config) (int64, error) {
+
+	filter := bson.M{"email_verified": bson.M{"$exists": false}}
+	update := bson.A{bson.M{"$set": bson.M{"email_verified": true, "verified_at": "$created_at"}}}
+
+	result, err := db.Collection("todo_user").UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+// moveAdminActions copies the records of the admin API, kept in
+// admin_actions before the audit log existed, to audit_events and drops the
+// old collection. Records keep their ID, so a copy interrupted before the
+// drop is completed by the next startup.
+func moveAdminActions(ctx context.Context, db *mongo.Database, cfg *config.Config) (int64, error) {
+
+	actions := db.Collection("admin_actions")
+
+	count, err := actions.CountDocuments(ctx, bson.M{})
+	if err != nil || count == 0 {
+		return 0, err
+	}
+
+	event := bson.M{
+		// users.disable became admin.users.disable
+		"action":      bson.M{"$concat": bson.A{"admin.", "$action"}},
+		"outcome":     bson.M{"$literal": "success"},
+		"actor_id":    1,
+		"actor_email": 1,
+		"target_type": bson.M{"$cond": bson.A{bson.M{"$ifNull": bson.A{"$target_id", false}}, "user", "$$REMOVE"}},
+		"target_id":   bson.M{"$cond": bson.A{bson.M{"$ifNull": bson.A{"$target_id", false}}, bson.M{"$toString": "$target_id"}, "$$REMOVE"}},
+		"ip":          1,
+		"details":     1,
+		"created_at":  1,
+	}
+	if cfg.Audit.Retention > 0 {
+		event["expires_at"] = bson.M{"$add": bson.A{"$created_at", cfg.Audit.Retention.Milliseconds()}}
+	}
+
+	pipeline := bson.A{
+		bson.M{"$project": event},
+		bson.M{"$merge": bson.M{"into": "audit_events", "on": "_id", "whenMatched": "keepExisting", "whenNotMatched": "insert"}},
+	}
+
+	cursor, err := actions.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	if err := cursor.Close(ctx); err != nil {
+		return 0, err
+	}
+
+	if err := actions.Drop(ctx); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// applyAuditRetention makes every event expire audit.retention after it
+// happened, so a new retention also applies to the events recorded before
+// it, and 0 keeps them all.
+func applyAuditRetention(ctx context.Context, db *mongo.Database, cfg *config.Config) (int64, error) {
+
+	events := db.Collection("audit_events")
+
+	if cfg.Audit.Retention <= 0 {
+		result, err := events.UpdateMany(ctx, bson.M{"expires_at": bson.M{"$exists": true}}, bson.M{"$unset": bson.M{"expires_at": ""}})
+		if err != nil {
+			return 0, err
+		}
+		return result.ModifiedCount, nil
+	}
+
+	expiresAt := bson.M{"$add": bson.A{"$created_at", cfg.Audit.Retention.Milliseconds()}}
+	filter := bson.M{"$expr": bson.M{"$ne": bson.A{"$expires_at", expiresAt}}}
+	update := bson.A{bson.M{"$set": bson.M{"expires_at": expiresAt}}}
+
+	result, err := events.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"time"
+	"todo-app-mongo/internal/entity"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type OIDCStateDAOInterface interface {
+	Create(ctx context.Context, state *entity.OIDCState) error
+	Consume(ctx context.Context, provider string, stateHash string) (*entity.OIDCState, error)
+}
+
+type oidcStateDAO struct {
+	collection *mongo.Collection
+}
+
+func NewOIDCStateDAO(db mongo.Database) *oidcStateDAO {
+	return &oidcStateDAO{
+		collection: db.Collection("oidc_states"),
+	}
+}
+
+func (o *oidcStateDAO) Create(ctx context.Context, state *entity.OIDCState) error {
+	_, err := o.collection.InsertOne(ctx, state)
+	return err
+}
+
+// Consume deletes an unexpired state and returns it, so each login can
+// only be completed once.
+func (o *oidcStateDAO) Consume(ctx context.Context, provider string, stateHash string) (*entity.OIDCState, error) {
+
+	filter := bson.M{
+		"state_hash": stateHash,
+		"provider":   provider,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+
+	var state *entity.OIDCState
+	err := o.collection.FindOneAndDelete(ctx, filter).Decode(&state)
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"todo-app-mongo/internal/pkg/ratelimit"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type rateLimitDAO struct {
+	collection *mongo.Collection
+}
+
+// NewRateLimitDAO stores token buckets in Mongo so every replica shares the
+// same limits.
+func NewRateLimitDAO(db mongo.Database) ratelimit.Store {
+	return &rateLimitDAO{
+		collection: db.Collection("rate_limits"),
+	}
+}
+
+type rateLimitBucket struct {
+	Tokens  float64 `bson:"tokens"`
+	Allowed bool    `bson:"allowed"`
+}
+
+// Take refills and consumes the bucket in a single pipeline update, using
+// the server clock so replicas with skewed clocks agree.
+func (r *rateLimitDAO) Take(ctx context.Context, key string, rate ratelimit.Rate, n int) (ratelimit.Result, error) {
+
+	capacity := float64(rate.Requests)
+	// the pipeline counts in milliseconds, shorter periods would divide by 0
+	perMs := capacity / float64(max(rate.Period.Milliseconds(), 1))
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"tokens": bson.M{"$min": bson.A{
+				capacity,
+				bson.M{"$add": bson.A{
+					bson.M{"$ifNull": bson.A{"$tokens", capacity}},
+					bson.M{"$multiply": bson.A{
+						bson.M{"$subtract": bson.A{"$$NOW", bson.M{"$ifNull": bson.A{"$updated_at", "$$NOW"}}}},
+						perMs,
+					}},
+				}},
+			}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"allowed": bson.M{"$gte": bson.A{"$tokens", n}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"tokens":     bson.M{"$cond": bson.A{"$allowed", bson.M{"$subtract": bson.A{"$tokens", n}}, "$tokens"}},
+			"updated_at": "$$NOW",
+			"expires_at": bson.M{"$add": bson.A{"$$NOW", rate.Period.Milliseconds()}},
+		}}},
+	}
+
+	opts := options.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(options.After)
+
+	var b rateLimitBucket
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, opts).Decode(&b)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	return ratelimit.NewResult(rate, b.Tokens, n, b.Allowed), nil
+}
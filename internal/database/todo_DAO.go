@@ -2,6 +2,9 @@ package database
 
 import (
 	"context"
+	"errors"
+	"slices"
+	"time"
 	"todo-app-mongo/internal/entity"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -12,10 +15,46 @@ import (
 
 type TodoDAOInterface interface {
 	Create(ctx context.Context, todo *entity.Todo) error
-	Get(ctx context.Context, id string, userId string) (*entity.Todo, error)
+	Get(ctx context.Context, id string, userId primitive.ObjectID) (*entity.Todo, error)
 	GetAll(ctx context.Context, limit int64, page int64, search string, userId primitive.ObjectID) ([]*entity.Todo, int64, error)
-	Update(ctx context.Context, id string, todo *entity.Todo) error
+	Update(ctx context.Context, id string, todo *entity.Todo, version int64) error
 	Delete(ctx context.Context, id string) error
+	CountByUser(ctx context.Context, userId primitive.ObjectID) (*entity.TodoCounts, error)
+	Trash(ctx context.Context, id primitive.ObjectID, version int64, now time.Time) error
+	Untrash(ctx context.Context, id primitive.ObjectID) error
+	GetTrashed(ctx context.Context, id string, userId primitive.ObjectID) (*entity.Todo, error)
+	ListTrash(ctx context.Context, userId primitive.ObjectID) ([]*entity.Todo, error)
+	ListScheduled(ctx context.Context, userId primitive.ObjectID, from time.Time, to time.Time, completed *bool) ([]*entity.Todo, error)
+	TrashedBefore(ctx context.Context, before time.Time, limit int64) ([]*entity.Todo, error)
+	DeleteTrashed(ctx context.Context, id primitive.ObjectID, userId primitive.ObjectID) error
+	DeleteTrashedBefore(ctx context.Context, id primitive.ObjectID, before time.Time) error
+	GetMany(ctx context.Context, ids []primitive.ObjectID, userId primitive.ObjectID) ([]*entity.Todo, error)
+	BulkWrite(ctx context.Context, writes []TodoWrite) ([]error, error)
+	ForEach(ctx context.Context, userId primitive.ObjectID, fn func(todo *entity.Todo) error) error
+	ForEachScheduled(ctx context.Context, userId primitive.ObjectID, fn func(todo *entity.Todo) error) error
+}
+
+// ErrVersionConflict is returned by Update when the todo is no longer at
+// the version the caller read.
+var ErrVersionConflict = errors.New("todo was modified concurrently")
+
+type TodoWriteOp int
+
+const (
+	// TodoInsert creates the todo.
+	TodoInsert TodoWriteOp = iota
+	// TodoUpdate replaces the todo if it is still at Version, like Update.
+	TodoUpdate
+	// TodoTrash moves the todo to the trash at its DeletedAt if it is still
+	// at Version, like Trash.
+	TodoTrash
+)
+
+// TodoWrite is one write of a BulkWrite.
+type TodoWrite struct {
+	Op      TodoWriteOp
+	Todo    *entity.Todo
+	Version int64
 }
 
 type todoDAO struct {
@@ -33,15 +72,17 @@ func (t *todoDAO) Create(ctx context.Context, todo *entity.Todo) error {
 	return err
 }
 
-func (t *todoDAO) Get(ctx context.Context, id string, userId string) (*entity.Todo, error) {
+func (t *todoDAO) Get(ctx context.Context, id string, userId primitive.ObjectID) (*entity.Todo, error) {
 
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return nil, err
 	}
 
+	// a nil deleted_at also matches todos from before the trash, which
+	// have none
 	var todo *entity.Todo
-	err = t.collection.FindOne(ctx, bson.M{"_id": objectID, "user_id": userId}).Decode(&todo)
+	err = t.collection.FindOne(ctx, bson.M{"_id": objectID, "user_id": userId, "deleted_at": nil}).Decode(&todo)
 	if err != nil {
 		return nil, err
 	}
@@ -52,7 +93,7 @@ func (t *todoDAO) Get(ctx context.Context, id string, userId string) (*entity.To
 func (t *todoDAO) GetAll(ctx context.Context, limit int64, page int64, search string, userId primitive.ObjectID) ([]*entity.Todo, int64, error) {
 	var todos []*entity.Todo
 
-	filter := bson.M{"user_id": userId}
+	filter := bson.M{"user_id": userId, "deleted_at": nil}
 	if search != "" {
 		filter["$or"] = []bson.M{
 			{"title": bson.M{"$regex": primitive.Regex{Pattern: search, Options: "i"}}},
@@ -90,16 +131,28 @@ func (t *todoDAO) GetAll(ctx context.Context, limit int64, page int64, search st
 	return todos, totalPages, nil
 }
 
-func (t *todoDAO) Update(ctx context.Context, id string, todo *entity.Todo) error {
+// Update replaces the todo if it is still at version, and moves it to the
+// next one, updated now. Otherwise, or when the todo is gone or trashed, it returns
+// ErrVersionConflict.
+func (t *todoDAO) Update(ctx context.Context, id string, todo *entity.Todo, version int64) error {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
 		return err
 	}
 
 	todo.ID = objectID
+	todo.Version = version + 1
+	todo.UpdatedAt = time.Now()
 
-	_, err = t.collection.UpdateByID(ctx, objectID, bson.M{"$set": todo})
-	return err
+	result, err := t.collection.UpdateOne(ctx, versionFilter(objectID, version), bson.M{"$set": todo})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrVersionConflict
+	}
+
+	return nil
 }
 
 func (t *todoDAO) Delete(ctx context.Context, id string) error {
@@ -111,3 +164,398 @@ func (t *todoDAO) Delete(ctx context.Context, id string) error {
 	_, err = t.collection.DeleteOne(ctx, bson.M{"_id": objectID})
 	return err
 }
+
+func (t *todoDAO) CountByUser(ctx context.Context, userId primitive.ObjectID) (*entity.TodoCounts, error) {
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userId, "deleted_at": nil}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":       nil,
+			"total":     bson.M{"$sum": 1},
+			"completed": bson.M{"$sum": bson.M{"$cond": bson.A{"$completed", 1, 0}}},
+			"scheduled": bson.M{"$sum": bson.M{"$cond": bson.A{"$scheduled", 1, 0}}},
+		}}},
+	}
+
+	cursor, err := t.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	counts := &entity.TodoCounts{}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(counts); err != nil {
+			return nil, err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	counts.Trashed, err = t.collection.CountDocuments(ctx, bson.M{"user_id": userId, "deleted_at": bson.M{"$ne": nil}})
+	if err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// Trash moves the todo to the trash if it is still at version, and moves it
+// to the next one. Otherwise, or when the todo is gone or already trashed,
+// it returns ErrVersionConflict.
+func (t *todoDAO) Trash(ctx context.Context, id primitive.ObjectID, version int64, now time.Time) error {
+
+	update := bson.M{"$set": bson.M{"deleted_at": now}, "$inc": bson.M{"version": 1}}
+	result, err := t.collection.UpdateOne(ctx, versionFilter(id, version), update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrVersionConflict
+	}
+
+	return nil
+}
+
+// Untrash takes the todo out of the trash and moves it to the next version.
+// It returns mongo.ErrNoDocuments when the todo isn't there.
+func (t *todoDAO) Untrash(ctx context.Context, id primitive.ObjectID) error {
+
+	filter := bson.M{"_id": id, "deleted_at": bson.M{"$ne": nil}}
+	update := bson.M{"$set": bson.M{"deleted_at": nil}, "$inc": bson.M{"version": 1}}
+	result, err := t.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (t *todoDAO) GetTrashed(ctx context.Context, id string, userId primitive.ObjectID) (*entity.Todo, error) {
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var todo *entity.Todo
+	err = t.collection.FindOne(ctx, bson.M{"_id": objectID, "user_id": userId, "deleted_at": bson.M{"$ne": nil}}).Decode(&todo)
+	if err != nil {
+		return nil, err
+	}
+
+	return todo, nil
+}
+
+// ListTrash returns the trashed todos of the user, last deleted first.
+func (t *todoDAO) ListTrash(ctx context.Context, userId primitive.ObjectID) ([]*entity.Todo, error) {
+
+	opts := options.Find().SetSort(bson.D{{Key: "deleted_at", Value: -1}})
+
+	cursor, err := t.collection.Find(ctx, bson.M{"user_id": userId, "deleted_at": bson.M{"$ne": nil}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	todos := []*entity.Todo{}
+	if err := cursor.All(ctx, &todos); err != nil {
+		return nil, err
+	}
+
+	return todos, nil
+}
+
+// ListScheduled returns the scheduled todos of the user outside the trash
+// due from from to to, to excluded, soonest first. All-day todos are due
+// on their date in the time zone of from, so from and to are midnights
+// there. A non-nil completed only keeps the todos completed or not.
+func (t *todoDAO) ListScheduled(ctx context.Context, userId primitive.ObjectID, from time.Time, to time.Time, completed *bool) ([]*entity.Todo, error) {
+
+	filter := bson.M{
+		"user_id":    userId,
+		"deleted_at": nil,
+		"scheduled":  true,
+		"$or": []bson.M{
+			{"all_day": bson.M{"$ne": true}, "scheduled_to": bson.M{"$gte": from, "$lt": to}},
+			{"all_day": true, "scheduled_to": bson.M{"$gte": dateOf(from), "$lt": dateOf(to)}},
+		},
+	}
+	if completed != nil {
+		filter["completed"] = *completed
+	}
+
+	cursor, err := t.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "scheduled_to", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	todos := []*entity.Todo{}
+	if err := cursor.All(ctx, &todos); err != nil {
+		return nil, err
+	}
+
+	// all-day todos are stored at midnight UTC, which isn't the start of
+	// their day everywhere
+	loc := from.Location()
+	slices.SortStableFunc(todos, func(a, b *entity.Todo) int {
+		return a.ScheduledIn(loc).Compare(b.ScheduledIn(loc))
+	})
+
+	return todos, nil
+}
+
+// dateOf returns the date of t, in its time zone, as all-day todos store
+// it.
+func dateOf(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// TrashedBefore returns up to limit todos trashed before the time.
+func (t *todoDAO) TrashedBefore(ctx context.Context, before time.Time, limit int64) ([]*entity.Todo, error) {
+
+	cursor, err := t.collection.Find(ctx, bson.M{"deleted_at": bson.M{"$lt": before}}, options.Find().SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+
+	var todos []*entity.Todo
+	if err := cursor.All(ctx, &todos); err != nil {
+		return nil, err
+	}
+
+	return todos, nil
+}
+
+// DeleteTrashed permanently deletes the todo of the user if it is in the
+// trash. Otherwise it returns mongo.ErrNoDocuments.
+func (t *todoDAO) DeleteTrashed(ctx context.Context, id primitive.ObjectID, userId primitive.ObjectID) error {
+	return t.deleteOne(ctx, bson.M{"_id": id, "user_id": userId, "deleted_at": bson.M{"$ne": nil}})
+}
+
+// DeleteTrashedBefore permanently deletes the todo if it was trashed before
+// the time. Otherwise, e.g. when it was restored since, it returns
+// mongo.ErrNoDocuments.
+func (t *todoDAO) DeleteTrashedBefore(ctx context.Context, id primitive.ObjectID, before time.Time) error {
+	return t.deleteOne(ctx, bson.M{"_id": id, "deleted_at": bson.M{"$lt": before}})
+}
+
+func (t *todoDAO) deleteOne(ctx context.Context, filter bson.M) error {
+
+	result, err := t.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+func (t *todoDAO) GetMany(ctx context.Context, ids []primitive.ObjectID, userId primitive.ObjectID) ([]*entity.Todo, error) {
+
+	cursor, err := t.collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}, "user_id": userId, "deleted_at": nil})
+	if err != nil {
+		return nil, err
+	}
+
+	todos := []*entity.Todo{}
+	if err := cursor.All(ctx, &todos); err != nil {
+		return nil, err
+	}
+
+	return todos, nil
+}
+
+// ForEach calls fn with each todo of the user, oldest first, reading them
+// as it goes. It stops at the first error fn returns.
+func (t *todoDAO) ForEach(ctx context.Context, userId primitive.ObjectID, fn func(todo *entity.Todo) error) error {
+	return t.forEach(ctx, bson.M{"user_id": userId, "deleted_at": nil}, bson.D{{Key: "created_at", Value: 1}}, fn)
+}
+
+// ForEachScheduled is ForEach for the scheduled todos, soonest first.
+func (t *todoDAO) ForEachScheduled(ctx context.Context, userId primitive.ObjectID, fn func(todo *entity.Todo) error) error {
+	return t.forEach(ctx, bson.M{"user_id": userId, "deleted_at": nil, "scheduled": true}, bson.D{{Key: "scheduled_to", Value: 1}}, fn)
+}
+
+func (t *todoDAO) forEach(ctx context.Context, filter bson.M, sort bson.D, fn func(todo *entity.Todo) error) error {
+
+	cursor, err := t.collection.Find(ctx, filter, options.Find().SetSort(sort))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var todo entity.Todo
+		if err := cursor.Decode(&todo); err != nil {
+			return err
+		}
+		if err := fn(&todo); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+// BulkWrite runs the writes, in no particular order, and returns the error
+// of each: nil when it was applied, ErrVersionConflict for an update or a
+// trash that lost a race, mongo.ErrNoDocuments for a todo gone, or the
+// write error. In a transaction they go in one round trip, and a write
+// error leaves the writes that didn't match without an error: the
+// transaction is aborted anyway. Outside one, only the inserts do: the
+// result of a bulk write counts the matched updates without telling which,
+// and reading the todos back races with other requests, so each update is
+// told apart by its own result. The error returned last is for the whole
+// batch.
+func (t *todoDAO) BulkWrite(ctx context.Context, writes []TodoWrite) ([]error, error) {
+
+	errs := make([]error, len(writes))
+	inTransaction := mongo.SessionFromContext(ctx) != nil
+
+	var models []mongo.WriteModel
+	var batched []int
+	for i, w := range writes {
+		var model mongo.WriteModel
+		switch w.Op {
+		case TodoInsert:
+			model = mongo.NewInsertOneModel().SetDocument(w.Todo)
+		case TodoUpdate:
+			w.Todo.Version = w.Version + 1
+			w.Todo.UpdatedAt = time.Now()
+			model = mongo.NewUpdateOneModel().
+				SetFilter(versionFilter(w.Todo.ID, w.Version)).
+				SetUpdate(bson.M{"$set": w.Todo})
+		case TodoTrash:
+			w.Todo.Version = w.Version + 1
+			model = mongo.NewUpdateOneModel().
+				SetFilter(versionFilter(w.Todo.ID, w.Version)).
+				SetUpdate(bson.M{"$set": bson.M{"deleted_at": w.Todo.DeletedAt}, "$inc": bson.M{"version": 1}})
+		}
+
+		if w.Op != TodoInsert && !inTransaction {
+			errs[i] = t.writeOne(ctx, w, model.(*mongo.UpdateOneModel))
+			continue
+		}
+		models = append(models, model)
+		batched = append(batched, i)
+	}
+
+	if len(models) == 0 {
+		return errs, nil
+	}
+
+	result, err := t.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		for _, writeErr := range bulkErr.WriteErrors {
+			errs[batched[writeErr.Index]] = writeErr
+		}
+		// in a transaction a write error aborts it, so nothing can be
+		// read back, and the batch fails anyway
+		if inTransaction {
+			return errs, nil
+		}
+	} else if err != nil && len(batched) == len(writes) {
+		return nil, err
+	} else if err != nil {
+		// the updates outside the batch are already written, only the
+		// inserts failed
+		for _, i := range batched {
+			errs[i] = err
+		}
+		return errs, nil
+	}
+
+	if !inTransaction {
+		return errs, nil
+	}
+
+	// the result only counts the matched updates, so when some didn't
+	// match the todos are read back, which the transaction isolates from
+	// other requests, to tell which
+	var updated []primitive.ObjectID
+	for _, i := range batched {
+		if writes[i].Op != TodoInsert && errs[i] == nil {
+			updated = append(updated, writes[i].Todo.ID)
+		}
+	}
+	if result == nil || result.MatchedCount == int64(len(updated)) {
+		return errs, nil
+	}
+
+	cursor, err := t.collection.Find(ctx, bson.M{"_id": bson.M{"$in": updated}})
+	if err != nil {
+		return nil, err
+	}
+	var stored []*entity.Todo
+	if err := cursor.All(ctx, &stored); err != nil {
+		return nil, err
+	}
+	byID := map[primitive.ObjectID]*entity.Todo{}
+	for _, todo := range stored {
+		byID[todo.ID] = todo
+	}
+
+	for _, i := range batched {
+		w := writes[i]
+		if w.Op == TodoInsert || errs[i] != nil {
+			continue
+		}
+
+		todo, ok := byID[w.Todo.ID]
+		switch {
+		case w.Op == TodoUpdate && (!ok || todo.Version != w.Todo.Version):
+			errs[i] = ErrVersionConflict
+		case w.Op == TodoTrash && !ok:
+			errs[i] = mongo.ErrNoDocuments
+		case w.Op == TodoTrash && (todo.Version != w.Todo.Version || todo.DeletedAt == nil):
+			errs[i] = ErrVersionConflict
+		}
+	}
+
+	return errs, nil
+}
+
+// writeOne runs an update or a trash of BulkWrite on its own. One that
+// didn't match lost a race, or its todo is gone.
+func (t *todoDAO) writeOne(ctx context.Context, w TodoWrite, model *mongo.UpdateOneModel) error {
+
+	result, err := t.collection.UpdateOne(ctx, model.Filter, model.Update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 1 {
+		return nil
+	}
+	if w.Op == TodoUpdate {
+		return ErrVersionConflict
+	}
+
+	// mongo.ErrNoDocuments when the todo is gone
+	err = t.collection.FindOne(ctx, bson.M{"_id": w.Todo.ID}, options.FindOne().SetProjection(bson.M{"_id": 1})).Err()
+	if err != nil {
+		return err
+	}
+
+	return ErrVersionConflict
+}
+
+// versionFilter matches the todo while it is at version and not trashed:
+// writing a trashed todo would reset its deleted_at.
+func versionFilter(id primitive.ObjectID, version int64) bson.M {
+
+	filter := bson.M{"_id": id, "deleted_at": nil, "version": version}
+	if version == 0 {
+		// a missing version reads as 0
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+
+	return filter
+}
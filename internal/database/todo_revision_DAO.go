@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"time"
+	"todo-app-mongo/internal/entity"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// revisionAttempts bounds the retries when concurrent updates of a todo
+// pick the same revision number.
+const revisionAttempts = 3
+
+type TodoRevisionDAOInterface interface {
+	Create(ctx context.Context, todo *entity.Todo) (*entity.TodoRevision, error)
+	ListByTodo(ctx context.Context, todoID primitive.ObjectID) ([]*entity.TodoRevision, error)
+	Get(ctx context.Context, todoID primitive.ObjectID, revision int) (*entity.TodoRevision, error)
+	DeleteByTodo(ctx context.Context, todoIDs ...primitive.ObjectID) error
+}
+
+type todoRevisionDAO struct {
+	collection *mongo.Collection
+	keep       int
+}
+
+// NewTodoRevisionDAO keeps the keep latest revisions of each todo, or all
+// of them when it is 0.
+func NewTodoRevisionDAO(db mongo.Database, keep int) *todoRevisionDAO {
+	return &todoRevisionDAO{
+		collection: db.Collection("todo_revisions"),
+		keep:       keep,
+	}
+}
+
+// Create snapshots the todo as the next revision and deletes the revisions
+// no longer kept. When only the deletion fails, the revision is returned
+// along with the error.
+func (t *todoRevisionDAO) Create(ctx context.Context, todo *entity.Todo) (*entity.TodoRevision, error) {
+
+	var err error
+	for range revisionAttempts {
+		var number int
+		number, err = t.next(ctx, todo.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		revision := &entity.TodoRevision{
+			ID:        primitive.NewObjectID(),
+			TodoID:    todo.ID,
+			UserID:    todo.UserID,
+			Revision:  number,
+			Todo:      *todo,
+			CreatedAt: time.Now(),
+		}
+
+		_, err = t.collection.InsertOne(ctx, revision)
+		if err == nil {
+			return revision, t.prune(ctx, todo.ID, number)
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
+
+// ListByTodo returns the revisions of the todo, newest first.
+func (t *todoRevisionDAO) ListByTodo(ctx context.Context, todoID primitive.ObjectID) ([]*entity.TodoRevision, error) {
+
+	opts := options.Find().SetSort(bson.D{{Key: "revision", Value: -1}})
+
+	cursor, err := t.collection.Find(ctx, bson.M{"todo_id": todoID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := []*entity.TodoRevision{}
+	if err := cursor.All(ctx, &revisions); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+func (t *todoRevisionDAO) Get(ctx context.Context, todoID primitive.ObjectID, revision int) (*entity.TodoRevision, error) {
+
+	var todoRevision *entity.TodoRevision
+	err := t.collection.FindOne(ctx, bson.M{"todo_id": todoID, "revision": revision}).Decode(&todoRevision)
+	if err != nil {
+		return nil, err
+	}
+
+	return todoRevision, nil
+}
+
+func (t *todoRevisionDAO) DeleteByTodo(ctx context.Context, todoIDs ...primitive.ObjectID) error {
+	_, err := t.collection.DeleteMany(ctx, bson.M{"todo_id": bson.M{"$in": todoIDs}})
+	return err
+}
+
+// prune deletes the revisions older than the ones kept, latest being the
+// newest revision.
+func (t *todoRevisionDAO) prune(ctx context.Context, todoID primitive.ObjectID, latest int) error {
+
+	if t.keep == 0 || latest <= t.keep {
+		return nil
+	}
+
+	_, err := t.collection.DeleteMany(ctx, bson.M{"todo_id": todoID, "revision": bson.M{"$lte": latest - t.keep}})
+	return err
+}
+
+// next returns the number of the revision following the latest one.
+func (t *todoRevisionDAO) next(ctx context.Context, todoID primitive.ObjectID) (int, error) {
+
+	opts := options.FindOne().
+		SetSort(bson.D{{Key: "revision", Value: -1}}).
+		SetProjection(bson.M{"revision": 1})
+
+	var latest entity.TodoRevision
+	err := t.collection.FindOne(ctx, bson.M{"todo_id": todoID}, opts).Decode(&latest)
+	if err == mongo.ErrNoDocuments {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return latest.Revision + 1, nil
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrTransactionsUnsupported is returned by WithTransaction when MongoDB
+// runs standalone: transactions need a replica set or a sharded cluster.
+var ErrTransactionsUnsupported = errors.New("transactions are not supported by this deployment")
+
+// Transactor runs functions in a MongoDB transaction. DAOs called with the
+// context fn receives take part in it.
+type Transactor interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// WithTransaction commits what fn wrote if it returns nil and aborts it
+// otherwise. fn may run again when the transaction hits a transient error,
+// so it must not have effects outside the database.
+func (s *service) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+
+	supported, err := s.supportsTransactions(ctx)
+	if err != nil {
+		return err
+	}
+	if !supported {
+		return ErrTransactionsUnsupported
+	}
+
+	session, err := s.db.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (any, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// supportsTransactions asks the server whether it is a replica set member
+// or a mongos, once: the topology doesn't change while connected.
+func (s *service) supportsTransactions(ctx context.Context) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.transactions != nil {
+		return *s.transactions, nil
+	}
+
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := s.db.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return false, err
+	}
+
+	supported := hello.SetName != "" || hello.Msg == "isdbgrid"
+	s.transactions = &supported
+
+	return supported, nil
+}
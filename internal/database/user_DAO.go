@@ -2,20 +2,45 @@ package database
 
 import (
 	"context"
+	"regexp"
 	"time"
 	"todo-app-mongo/internal/entity"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type UserDAOInterface interface {
 	Create(ctx context.Context, user *entity.User) (*entity.User, error)
 	Update(ctx context.Context, user *entity.User) (*entity.User, error)
+	SetPassword(ctx context.Context, id primitive.ObjectID, hashedPassword string, now time.Time) error
+	RehashPassword(ctx context.Context, id primitive.ObjectID, oldHash string, newHash string) (bool, error)
+	SetMFA(ctx context.Context, id primitive.ObjectID, mfa entity.UserMFA, now time.Time) error
+	SetDisabled(ctx context.Context, id primitive.ObjectID, disabled bool, reason string, now time.Time) (bool, error)
+	SetRole(ctx context.Context, id primitive.ObjectID, role string, now time.Time) error
+	RecordLoginFailure(ctx context.Context, id primitive.ObjectID, now time.Time, maxAttempts int, lockFor func(lockCount int) time.Duration) (entity.LoginLockout, bool, error)
+	ResetLockout(ctx context.Context, id primitive.ObjectID) error
+	RevokeTokens(ctx context.Context, id primitive.ObjectID, at time.Time) error
+	LinkIdentity(ctx context.Context, id primitive.ObjectID, identity entity.UserIdentity) (bool, error)
+	UseTOTPStep(ctx context.Context, id primitive.ObjectID, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, id primitive.ObjectID, hash string) (bool, error)
 	Delete(ctx context.Context, email string) (*entity.User, error)
 	GetById(ctx context.Context, id string) (*entity.User, error)
 	GetByEmail(ctx context.Context, email string) (*entity.User, error)
+	GetByIdentity(ctx context.Context, provider string, subject string) (*entity.User, error)
+	GetByCalendarToken(ctx context.Context, tokenHash string) (*entity.User, error)
+	Search(ctx context.Context, filter UserFilter, limit int64, offset int64) ([]*entity.User, int64, error)
+	GrantRole(ctx context.Context, emails []string, role string) (int64, error)
+}
+
+// UserFilter narrows Search. Query matches the name or email, empty fields
+// don't filter.
+type UserFilter struct {
+	Query    string
+	Role     string
+	Disabled *bool
 }
 
 type userDAO struct {
@@ -39,9 +64,16 @@ func (u *userDAO) Create(ctx context.Context, user *entity.User) (*entity.User,
 	return user, nil
 }
 
+// Update saves the user, except the fields that requests racing on the same
+// account change with atomic operators of their own.
 func (u *userDAO) Update(ctx context.Context, user *entity.User) (*entity.User, error) {
 
-	_, err := u.collection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": user})
+	fields, err := userFields(user)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = u.collection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": fields})
 	if err != nil {
 		return nil, err
 	}
@@ -49,6 +81,239 @@ func (u *userDAO) Update(ctx context.Context, user *entity.User) (*entity.User,
 	return user, nil
 }
 
+// atomicUserFields are left out of Update, see SetPassword,
+// RehashPassword, SetMFA, SetDisabled, SetRole, RecordLoginFailure,
+// ResetLockout, UseTOTPStep, UseRecoveryCode, RevokeTokens and
+// LinkIdentity.
+var atomicUserFields = []string{
+	"hashed_password", "lockout", "mfa", "role", "disabled", "disabled_at", "disabled_reason",
+	"tokens_valid_after", "identities",
+}
+
+func userFields(user *entity.User) (bson.M, error) {
+
+	data, err := bson.Marshal(user)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields bson.M
+	if err := bson.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	for _, field := range atomicUserFields {
+		delete(fields, field)
+	}
+
+	return fields, nil
+}
+
+// SetPassword replaces the password hash of the user, an empty one removes
+// the password.
+func (u *userDAO) SetPassword(ctx context.Context, id primitive.ObjectID, hashedPassword string, now time.Time) error {
+
+	update := bson.M{"$set": bson.M{"hashed_password": hashedPassword, "updated_at": now}}
+
+	_, err := u.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// RehashPassword replaces oldHash with newHash, a hash of the same password
+// made with the current algorithm, and reports whether the password was
+// still oldHash, so a login doesn't undo a concurrent password change.
+func (u *userDAO) RehashPassword(ctx context.Context, id primitive.ObjectID, oldHash string, newHash string) (bool, error) {
+
+	filter := bson.M{"_id": id, "hashed_password": oldHash}
+
+	result, err := u.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"hashed_password": newHash}})
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// SetMFA saves the second factor settings of the user. The last accepted
+// time step is left to UseTOTPStep, so it never moves back.
+func (u *userDAO) SetMFA(ctx context.Context, id primitive.ObjectID, mfa entity.UserMFA, now time.Time) error {
+
+	data, err := bson.Marshal(mfa)
+	if err != nil {
+		return err
+	}
+
+	var mfaFields bson.M
+	if err := bson.Unmarshal(data, &mfaFields); err != nil {
+		return err
+	}
+
+	fields := bson.M{"updated_at": now}
+	for key, value := range mfaFields {
+		if key != "last_step" {
+			fields["mfa."+key] = value
+		}
+	}
+
+	_, err = u.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": fields})
+	return err
+}
+
+// SetDisabled disables the account for the reason, or enables it back, and
+// reports whether it wasn't already, so concurrent admins act once.
+func (u *userDAO) SetDisabled(ctx context.Context, id primitive.ObjectID, disabled bool, reason string, now time.Time) (bool, error) {
+
+	disabledAt := time.Time{}
+	if disabled {
+		disabledAt = now
+	}
+
+	filter := bson.M{"_id": id, "disabled": bson.M{"$ne": disabled}}
+	update := bson.M{"$set": bson.M{
+		"disabled":        disabled,
+		"disabled_at":     disabledAt,
+		"disabled_reason": reason,
+		"updated_at":      now,
+	}}
+
+	result, err := u.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// SetRole changes the role of the user.
+func (u *userDAO) SetRole(ctx context.Context, id primitive.ObjectID, role string, now time.Time) error {
+
+	_, err := u.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"role": role, "updated_at": now}})
+	return err
+}
+
+// RecordLoginFailure counts a failed login on the account and, once the
+// count reaches maxAttempts, locks it for lockFor(lock count). Concurrent
+// failures are all counted and only one of them locks the account. It
+// returns the lockout record and whether this failure locked the account.
+func (u *userDAO) RecordLoginFailure(ctx context.Context, id primitive.ObjectID, now time.Time, maxAttempts int, lockFor func(lockCount int) time.Duration) (entity.LoginLockout, bool, error) {
+
+	update := bson.M{
+		"$inc": bson.M{"lockout.failed_attempts": 1},
+		"$set": bson.M{"lockout.last_failure_at": now},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var user entity.User
+	err := u.collection.FindOneAndUpdate(ctx, bson.M{"_id": id}, update, opts).Decode(&user)
+	if err != nil {
+		return entity.LoginLockout{}, false, err
+	}
+
+	lockout := user.Lockout
+	if lockout.FailedAttempts < maxAttempts {
+		return lockout, false, nil
+	}
+
+	// the failures that reached the limit together race for the lock, the
+	// first one resets the count
+	filter := bson.M{
+		"_id":                     id,
+		"lockout.failed_attempts": bson.M{"$gte": maxAttempts},
+		"lockout.lock_count":      lockout.LockCount,
+	}
+	lockedUntil := now.Add(lockFor(lockout.LockCount))
+	lock := bson.M{
+		"$set": bson.M{"lockout.failed_attempts": 0, "lockout.locked_until": lockedUntil},
+		"$inc": bson.M{"lockout.lock_count": 1},
+	}
+
+	result, err := u.collection.UpdateOne(ctx, filter, lock)
+	if err != nil {
+		return lockout, false, err
+	}
+	if result.ModifiedCount == 0 {
+		return lockout, false, nil
+	}
+
+	lockout.FailedAttempts = 0
+	lockout.LockedUntil = lockedUntil
+	lockout.LockCount++
+
+	return lockout, true, nil
+}
+
+// UseTOTPStep records the time step of an accepted TOTP code and reports
+// whether no code of that step or a later one was accepted before, so a
+// code can't be replayed by concurrent requests. Accounts created before
+// two-factor authentication have no last step.
+func (u *userDAO) UseTOTPStep(ctx context.Context, id primitive.ObjectID, step int64) (bool, error) {
+
+	filter := bson.M{"_id": id, "$or": bson.A{
+		bson.M{"mfa.last_step": bson.M{"$lt": step}},
+		bson.M{"mfa.last_step": bson.M{"$exists": false}},
+	}}
+
+	result, err := u.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"mfa.last_step": step}})
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// UseRecoveryCode removes the hashed recovery code and reports whether it
+// was still there.
+func (u *userDAO) UseRecoveryCode(ctx context.Context, id primitive.ObjectID, hash string) (bool, error) {
+
+	filter := bson.M{"_id": id, "mfa.recovery_codes": hash}
+
+	result, err := u.collection.UpdateOne(ctx, filter, bson.M{"$pull": bson.M{"mfa.recovery_codes": hash}})
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// RevokeTokens revokes the JWTs of the user issued before at. A revocation
+// never moves back in time.
+func (u *userDAO) RevokeTokens(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+
+	_, err := u.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$max": bson.M{"tokens_valid_after": at}})
+	return err
+}
+
+// LinkIdentity adds the provider account to the identities of the user and
+// reports whether it wasn't linked yet, so concurrent logins link it once.
+func (u *userDAO) LinkIdentity(ctx context.Context, id primitive.ObjectID, identity entity.UserIdentity) (bool, error) {
+
+	filter := bson.M{
+		"_id": id,
+		"identities": bson.M{"$not": bson.M{"$elemMatch": bson.M{
+			"provider": identity.Provider,
+			"subject":  identity.Subject,
+		}}},
+	}
+	update := bson.M{
+		"$push": bson.M{"identities": identity},
+		"$set":  bson.M{"updated_at": identity.LinkedAt},
+	}
+
+	result, err := u.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// ResetLockout clears the failed logins of the account.
+func (u *userDAO) ResetLockout(ctx context.Context, id primitive.ObjectID) error {
+
+	_, err := u.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"lockout": entity.LoginLockout{}}})
+	return err
+}
+
 func (u *userDAO) Delete(ctx context.Context, email string) (*entity.User, error) {
 
 	user, err := u.GetByEmail(ctx, email)
@@ -90,3 +355,94 @@ func (u *userDAO) GetByEmail(ctx context.Context, email string) (*entity.User, e
 
 	return user, nil
 }
+
+func (u *userDAO) GetByIdentity(ctx context.Context, provider string, subject string) (*entity.User, error) {
+
+	filter := bson.M{"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": subject}}}
+
+	var user *entity.User
+	err := u.collection.FindOne(ctx, filter).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (u *userDAO) GetByCalendarToken(ctx context.Context, tokenHash string) (*entity.User, error) {
+
+	var user *entity.User
+	err := u.collection.FindOne(ctx, bson.M{"calendar.token_hash": tokenHash}).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Search returns a page of the users matching the filter, newest first,
+// and how many match in total.
+func (u *userDAO) Search(ctx context.Context, filter UserFilter, limit int64, offset int64) ([]*entity.User, int64, error) {
+
+	query := bson.M{}
+	if filter.Query != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(filter.Query), Options: "i"}
+		query["$or"] = []bson.M{
+			{"name": bson.M{"$regex": pattern}},
+			{"email": bson.M{"$regex": pattern}},
+		}
+	}
+	if filter.Role == entity.RoleUser {
+		// accounts created before roles have none
+		query["role"] = bson.M{"$in": bson.A{entity.RoleUser, "", nil}}
+	} else if filter.Role != "" {
+		query["role"] = filter.Role
+	}
+	if filter.Disabled != nil {
+		if *filter.Disabled {
+			query["disabled"] = true
+		} else {
+			query["disabled"] = bson.M{"$ne": true}
+		}
+	}
+
+	opts := options.Find().
+		SetLimit(limit).
+		SetSkip(offset).
+		SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := u.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	users := []*entity.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, 0, err
+	}
+
+	total, err := u.collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+// GrantRole gives the role to the verified accounts with one of the emails
+// and returns how many changed.
+func (u *userDAO) GrantRole(ctx context.Context, emails []string, role string) (int64, error) {
+
+	filter := bson.M{
+		"email":          bson.M{"$in": emails},
+		"email_verified": true,
+		"role":           bson.M{"$ne": role},
+	}
+
+	result, err := u.collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"role": role, "updated_at": time.Now()}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
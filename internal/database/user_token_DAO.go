@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"time"
+	"todo-app-mongo/internal/entity"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type UserTokenDAOInterface interface {
+	Create(ctx context.Context, token *entity.UserToken) error
+	GetValid(ctx context.Context, purpose string, tokenHash string) (*entity.UserToken, error)
+	Consume(ctx context.Context, purpose string, tokenHash string) (*entity.UserToken, error)
+	DeleteByUser(ctx context.Context, userID primitive.ObjectID, purpose string) error
+	LatestByUser(ctx context.Context, userID primitive.ObjectID, purpose string) (*entity.UserToken, error)
+}
+
+type userTokenDAO struct {
+	collection *mongo.Collection
+}
+
+func NewUserTokenDAO(db mongo.Database) *userTokenDAO {
+	return &userTokenDAO{
+		collection: db.Collection("user_tokens"),
+	}
+}
+
+func (u *userTokenDAO) Create(ctx context.Context, token *entity.UserToken) error {
+	_, err := u.collection.InsertOne(ctx, token)
+	return err
+}
+
+// GetValid returns an unused, unexpired token without consuming it.
+func (u *userTokenDAO) GetValid(ctx context.Context, purpose string, tokenHash string) (*entity.UserToken, error) {
+
+	var token *entity.UserToken
+	err := u.collection.FindOne(ctx, validTokenFilter(purpose, tokenHash, time.Now())).Decode(&token)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Consume marks an unused, unexpired token as used and returns it. The
+// lookup and the update are atomic, so a token can only be consumed once.
+func (u *userTokenDAO) Consume(ctx context.Context, purpose string, tokenHash string) (*entity.UserToken, error) {
+
+	now := time.Now()
+	filter := validTokenFilter(purpose, tokenHash, now)
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var token *entity.UserToken
+	err := u.collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"used_at": now}}, opts).Decode(&token)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (u *userTokenDAO) DeleteByUser(ctx context.Context, userID primitive.ObjectID, purpose string) error {
+	_, err := u.collection.DeleteMany(ctx, bson.M{"user_id": userID, "purpose": purpose})
+	return err
+}
+
+func (u *userTokenDAO) LatestByUser(ctx context.Context, userID primitive.ObjectID, purpose string) (*entity.UserToken, error) {
+
+	opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	var token *entity.UserToken
+	err := u.collection.FindOne(ctx, bson.M{"user_id": userID, "purpose": purpose}, opts).Decode(&token)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func validTokenFilter(purpose string, tokenHash string, now time.Time) bson.M {
+	return bson.M{
+		"token_hash": tokenHash,
+		"purpose":    purpose,
+		"used_at":    nil,
+		"expires_at": bson.M{"$gt": now},
+	}
+}
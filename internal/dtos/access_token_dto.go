@@ -0,0 +1,70 @@
+package dtos
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+	"todo-app-mongo/internal/entity"
+)
+
+const maxAccessTokenNameLength = 100
+
+// CreateAccessTokenDTO creates a personal access token. Without ExpiresAt
+// the token never expires.
+type CreateAccessTokenDTO struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type AccessTokenResponseDTO struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// CreatedAccessTokenResponseDTO is the only response carrying the token
+// itself.
+type CreatedAccessTokenResponseDTO struct {
+	AccessTokenResponseDTO
+	Token string `json:"token"`
+}
+
+func (d *CreateAccessTokenDTO) Validate(now time.Time) error {
+
+	if d.Name == "" || len(d.Name) > maxAccessTokenNameLength {
+		return fmt.Errorf("name is required and must be at most %d characters long", maxAccessTokenNameLength)
+	}
+
+	if len(d.Scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	for _, scope := range d.Scopes {
+		if !slices.Contains(entity.Scopes, scope) {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+
+	if d.ExpiresAt != nil && !d.ExpiresAt.After(now) {
+		return errors.New("expiresAt must be in the future")
+	}
+
+	return nil
+}
+
+func NewAccessTokenResponseDTO(token *entity.AccessToken) AccessTokenResponseDTO {
+	return AccessTokenResponseDTO{
+		ID:         token.ID.Hex(),
+		Name:       token.Name,
+		Prefix:     token.Prefix,
+		Scopes:     token.Scopes,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		CreatedAt:  token.CreatedAt,
+	}
+}
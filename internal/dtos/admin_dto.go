@@ -0,0 +1,84 @@
+package dtos
+
+import (
+	"time"
+	"todo-app-mongo/internal/entity"
+)
+
+// AdminUserResponseDTO is a user as staff see it in the admin API.
+type AdminUserResponseDTO struct {
+	ID             string     `json:"id"`
+	Name           string     `json:"name"`
+	Email          string     `json:"email"`
+	EmailVerified  bool       `json:"emailVerified"`
+	MFAEnabled     bool       `json:"mfaEnabled"`
+	Role           string     `json:"role"`
+	Providers      []string   `json:"providers"`
+	Disabled       bool       `json:"disabled"`
+	DisabledAt     *time.Time `json:"disabledAt,omitempty"`
+	DisabledReason string     `json:"disabledReason,omitempty"`
+	Removed        bool       `json:"removed"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
+
+type DisableUserDTO struct {
+	Reason string `json:"reason"`
+}
+
+type ChangeRoleDTO struct {
+	Role string `json:"role" binding:"required"`
+}
+
+type TodoCountsResponseDTO struct {
+	Total     int64 `json:"total"`
+	Completed int64 `json:"completed"`
+	Pending   int64 `json:"pending"`
+	Scheduled int64 `json:"scheduled"`
+	Trashed   int64 `json:"trashed"`
+}
+
+func NewAdminUserResponseDTO(user *entity.User) AdminUserResponseDTO {
+
+	providers := []string{}
+	for _, identity := range user.Identities {
+		providers = append(providers, identity.Provider)
+	}
+
+	dto := AdminUserResponseDTO{
+		ID:             user.ID.Hex(),
+		Name:           user.Name,
+		Email:          user.Email,
+		EmailVerified:  user.EmailVerified,
+		MFAEnabled:     user.MFA.Enabled,
+		Role:           user.EffectiveRole(),
+		Providers:      providers,
+		Disabled:       user.Disabled,
+		DisabledReason: user.DisabledReason,
+		Removed:        user.Removed,
+		CreatedAt:      user.CreatedAt,
+	}
+	if user.Disabled {
+		dto.DisabledAt = &user.DisabledAt
+	}
+
+	return dto
+}
+
+func NewAdminUserResponseDTOs(users []*entity.User) []AdminUserResponseDTO {
+	dtos := make([]AdminUserResponseDTO, len(users))
+	for i, user := range users {
+		dtos[i] = NewAdminUserResponseDTO(user)
+	}
+
+	return dtos
+}
+
+func NewTodoCountsResponseDTO(counts *entity.TodoCounts) TodoCountsResponseDTO {
+	return TodoCountsResponseDTO{
+		Total:     counts.Total,
+		Completed: counts.Completed,
+		Pending:   counts.Total - counts.Completed,
+		Scheduled: counts.Scheduled,
+		Trashed:   counts.Trashed,
+	}
+}
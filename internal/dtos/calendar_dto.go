@@ -0,0 +1,29 @@
+package dtos
+
+import (
+	"time"
+	"todo-app-mongo/internal/entity"
+)
+
+// CalendarFeedResponseDTO tells whether the calendar feed is on. Its URL
+// can't be shown again, only replaced.
+type CalendarFeedResponseDTO struct {
+	Enabled   bool       `json:"enabled"`
+	CreatedAt *time.Time `json:"createdAt"`
+}
+
+// CreatedCalendarFeedResponseDTO is the only response carrying the feed
+// URL.
+type CreatedCalendarFeedResponseDTO struct {
+	CalendarFeedResponseDTO
+	URL string `json:"url"`
+}
+
+func NewCalendarFeedResponseDTO(calendar entity.UserCalendar) CalendarFeedResponseDTO {
+	if calendar.TokenHash == "" {
+		return CalendarFeedResponseDTO{}
+	}
+
+	createdAt := calendar.CreatedAt
+	return CalendarFeedResponseDTO{Enabled: true, CreatedAt: &createdAt}
+}
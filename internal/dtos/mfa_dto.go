@@ -0,0 +1,27 @@
+package dtos
+
+type MFASetupResponseDTO struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth:// provisioning URI to render as a QR code.
+	URI string `json:"uri"`
+}
+
+type MFACodeDTO struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFALoginDTO completes a login with the challenge returned by /user/login
+// and either a TOTP code or a recovery code.
+type MFALoginDTO struct {
+	MFAToken string `json:"mfaToken" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type MFADisableDTO struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type RecoveryCodesResponseDTO struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
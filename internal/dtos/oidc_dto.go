@@ -0,0 +1,5 @@
+package dtos
+
+type OIDCProvidersResponseDTO struct {
+	Providers []string `json:"providers"`
+}
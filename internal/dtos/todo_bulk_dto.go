@@ -0,0 +1,65 @@
+package dtos
+
+import "todo-app-mongo/internal/entity"
+
+const (
+	BulkCreate   = "create"
+	BulkUpdate   = "update"
+	BulkComplete = "complete"
+	BulkDelete   = "delete"
+	BulkTag      = "tag"
+)
+
+// BulkTodoDTO is a batch of todo operations. Atomic applies all of them or
+// none, which needs MongoDB to run as a replica set.
+type BulkTodoDTO struct {
+	Atomic     bool                   `json:"atomic"`
+	Operations []BulkTodoOperationDTO `json:"operations" binding:"required,min=1,max=100"`
+}
+
+// BulkTodoOperationDTO is one operation of a batch:
+//   - create takes Todo
+//   - update takes ID and Todo, which replaces the todo like PUT
+//   - complete takes ID and Completed, true when omitted
+//   - delete takes ID and moves the todo to the trash
+//   - tag takes ID, AddTags and RemoveTags
+type BulkTodoOperationDTO struct {
+	Op         string   `json:"op"`
+	ID         string   `json:"id"`
+	Todo       *TodoDTO `json:"todo"`
+	Completed  *bool    `json:"completed"`
+	AddTags    []string `json:"addTags"`
+	RemoveTags []string `json:"removeTags"`
+}
+
+// BulkTodoResultDTO is the outcome of the operation at Index, with the
+// status its own request would have answered.
+type BulkTodoResultDTO struct {
+	Index  int          `json:"index"`
+	Op     string       `json:"op"`
+	ID     string       `json:"id,omitempty"`
+	Status int          `json:"status"`
+	Error  string       `json:"error,omitempty"`
+	Todo   *entity.Todo `json:"todo,omitempty"`
+}
+
+type BulkTodoResponseDTO struct {
+	Atomic    bool                `json:"atomic"`
+	Succeeded int                 `json:"succeeded"`
+	Failed    int                 `json:"failed"`
+	Results   []BulkTodoResultDTO `json:"results"`
+}
+
+func NewBulkTodoResponseDTO(atomic bool, results []BulkTodoResultDTO) BulkTodoResponseDTO {
+
+	response := BulkTodoResponseDTO{Atomic: atomic, Results: results}
+	for _, result := range results {
+		if result.Status < 300 {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+	}
+
+	return response
+}
@@ -1,6 +1,9 @@
 package dtos
 
 import (
+	"errors"
+	"slices"
+	"strings"
 	"time"
 	"todo-app-mongo/internal/entity"
 
@@ -11,47 +14,107 @@ type TodoDTO struct {
 	Title       string `json:"title" binding:"required"`
 	Description string `json:"description" binding:"required"`
 	Scheduled   bool   `json:"scheduled"`
+	// ScheduledTo is an RFC 3339 time, or a date when AllDay.
 	ScheduledTo string `json:"scheduled_to"`
+	AllDay      bool   `json:"all_day"`
+	Completed   bool   `json:"completed"`
+	// Tags are stored trimmed and lowercased, without repeats.
+	Tags []string `json:"tags" binding:"max=20,dive,max=32"`
 }
 
-func (t *TodoDTO) ToModel() *entity.Todo {
+func (t *TodoDTO) ToModel() (*entity.Todo, error) {
+
+	scheduledTo, err := t.schedule()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
 	model := &entity.Todo{
 		ID:          primitive.NewObjectID(),
 		Title:       t.Title,
 		Description: t.Description,
 		Scheduled:   t.Scheduled,
-		CreatedAt:   time.Now(),
+		ScheduledTo: scheduledTo,
+		AllDay:      t.AllDay,
+		Completed:   t.Completed,
+		Tags:        NormalizeTags(t.Tags),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Version:     1,
 	}
 
-	if t.ScheduledTo != "" {
-		scheduledTo, _ := time.Parse(time.RFC3339, t.ScheduledTo)
-		model.ScheduledTo = scheduledTo
+	if t.Completed {
+		model.CompletedAt = now
 	}
 
-	return model
+	return model, nil
 }
 
 func (t *TodoDTO) FromModel(todo *entity.Todo) {
 	t.Title = todo.Title
 	t.Description = todo.Description
 	t.Scheduled = todo.Scheduled
+	t.ScheduledTo = todo.FormatSchedule()
+	t.AllDay = todo.AllDay
+	t.Completed = todo.Completed
+	t.Tags = todo.Tags
+}
+
+// ApplyTo returns a copy of the todo with every editable field replaced,
+// omitted ones included. The fields the server manages are kept, except
+// CompletedAt which follows Completed.
+func (t *TodoDTO) ApplyTo(todo *entity.Todo) (*entity.Todo, error) {
 
-	if !todo.ScheduledTo.IsZero() {
-		t.ScheduledTo = todo.ScheduledTo.Format(time.RFC3339)
+	scheduledTo, err := t.schedule()
+	if err != nil {
+		return nil, err
 	}
+
+	model := *todo
+	model.Title = t.Title
+	model.Description = t.Description
+	model.Scheduled = t.Scheduled
+	model.ScheduledTo = scheduledTo
+	model.AllDay = t.AllDay
+	model.Completed = t.Completed
+	model.Tags = NormalizeTags(t.Tags)
+
+	switch {
+	case !t.Completed:
+		model.CompletedAt = time.Time{}
+	case !todo.Completed:
+		model.CompletedAt = time.Now()
+	}
+
+	return &model, nil
 }
 
-func (t *TodoDTO) ToModelUpdate() *entity.Todo {
-	model := &entity.Todo{
-		Title:       t.Title,
-		Description: t.Description,
-		Scheduled:   t.Scheduled,
+// schedule parses ScheduledTo. All-day todos need one.
+func (t *TodoDTO) schedule() (time.Time, error) {
+
+	scheduledTo, err := entity.ParseSchedule(t.ScheduledTo, t.AllDay)
+	if err != nil {
+		return time.Time{}, err
 	}
+	if scheduledTo.IsZero() && t.AllDay {
+		return time.Time{}, errors.New("scheduled_to is required for an all-day todo")
+	}
+
+	return scheduledTo, nil
+}
+
+// NormalizeTags trims and lowercases the tags and drops the empty and
+// repeated ones, keeping the order.
+func NormalizeTags(tags []string) []string {
 
-	if t.ScheduledTo != "" {
-		scheduledTo, _ := time.Parse(time.RFC3339, t.ScheduledTo)
-		model.ScheduledTo = scheduledTo
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
 	}
 
-	return model
+	return normalized
 }
@@ -0,0 +1,48 @@
+package dtos
+
+// Statuses of the rows of an import.
+const (
+	ImportImported   = "imported"
+	ImportImportable = "importable"
+	ImportDuplicate  = "duplicate"
+	ImportInvalid    = "invalid"
+	ImportFailed     = "failed"
+)
+
+// ImportRowDTO is the outcome of a row: imported (importable in a dry
+// run) with the ID of the new todo, skipped as a duplicate, or invalid or
+// failed with the error.
+type ImportRowDTO struct {
+	Row    int    `json:"row"`
+	Status string `json:"status"`
+	ID     string `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ImportTodosResponseDTO struct {
+	DryRun     bool           `json:"dryRun"`
+	Imported   int            `json:"imported"`
+	Duplicates int            `json:"duplicates"`
+	Invalid    int            `json:"invalid"`
+	Failed     int            `json:"failed"`
+	Rows       []ImportRowDTO `json:"rows"`
+}
+
+func NewImportTodosResponseDTO(dryRun bool, rows []ImportRowDTO) ImportTodosResponseDTO {
+
+	response := ImportTodosResponseDTO{DryRun: dryRun, Rows: rows}
+	for _, row := range rows {
+		switch row.Status {
+		case ImportImported, ImportImportable:
+			response.Imported++
+		case ImportDuplicate:
+			response.Duplicates++
+		case ImportInvalid:
+			response.Invalid++
+		case ImportFailed:
+			response.Failed++
+		}
+	}
+
+	return response
+}
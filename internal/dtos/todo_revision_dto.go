@@ -0,0 +1,24 @@
+package dtos
+
+import (
+	"time"
+	"todo-app-mongo/internal/entity"
+)
+
+// TodoRevisionResponseDTO is a past version of a todo, replaced at
+// ReplacedAt by the version after it, and the fields that one changed.
+type TodoRevisionResponseDTO struct {
+	Revision   int                  `json:"revision"`
+	ReplacedAt time.Time            `json:"replacedAt"`
+	Todo       entity.Todo          `json:"todo"`
+	Changes    []entity.FieldChange `json:"changes"`
+}
+
+func NewTodoRevisionResponseDTO(revision *entity.TodoRevision, changes []entity.FieldChange) TodoRevisionResponseDTO {
+	return TodoRevisionResponseDTO{
+		Revision:   revision.Revision,
+		ReplacedAt: revision.CreatedAt,
+		Todo:       revision.Todo,
+		Changes:    changes,
+	}
+}
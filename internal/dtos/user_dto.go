@@ -5,9 +5,9 @@ import (
 	"regexp"
 	"time"
 	"todo-app-mongo/internal/entity"
+	"todo-app-mongo/internal/pkg/security"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type UserLoginDTO struct {
@@ -15,9 +15,13 @@ type UserLoginDTO struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// UserLoginResponseDTO carries the tokens, or only MFAToken when the
+// account has a second factor to check with /user/login/mfa.
 type UserLoginResponseDTO struct {
-	Token        string `json:"token"`
-	RefreshToken string `json:"refreshToken"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+	MFARequired  bool   `json:"mfaRequired,omitempty"`
+	MFAToken     string `json:"mfaToken,omitempty"`
 }
 
 type UserRequestDTO struct {
@@ -27,13 +31,61 @@ type UserRequestDTO struct {
 	ConfirmPassword string `json:"confirmPassword" binding:"required"`
 }
 
+type ForgotPasswordDTO struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type ResetPasswordDTO struct {
+	Token           string `json:"token" binding:"required"`
+	Password        string `json:"password" binding:"required"`
+	ConfirmPassword string `json:"confirmPassword" binding:"required"`
+}
+
+type ChangePasswordDTO struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	Password        string `json:"password" binding:"required"`
+	ConfirmPassword string `json:"confirmPassword" binding:"required"`
+}
+
+type ChangeEmailDTO struct {
+	Email           string `json:"email" binding:"required"`
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+}
+
+// UserPatchDTO updates profile fields; omitted fields are left unchanged.
+type UserPatchDTO struct {
+	Name *string `json:"name"`
+	// Timezone is an IANA time zone, like Europe/Paris. Empty means UTC.
+	Timezone *string `json:"timezone"`
+}
+
 type UserResponseDTO struct {
-	ID    string `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"emailVerified"`
+	MFAEnabled    bool   `json:"mfaEnabled"`
+	Role          string `json:"role"`
+	Timezone      string `json:"timezone"`
 }
 
-func (u *UserRequestDTO) ToUserModel() (*entity.User, error) {
+type ResendVerificationDTO struct {
+	Email string `json:"email" binding:"required"`
+}
+
+func NewUserResponseDTO(user *entity.User) UserResponseDTO {
+	return UserResponseDTO{
+		ID:            user.ID.Hex(),
+		Name:          user.Name,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		MFAEnabled:    user.MFA.Enabled,
+		Role:          user.EffectiveRole(),
+		Timezone:      user.Location().String(),
+	}
+}
+
+func (u *UserRequestDTO) ToUserModel(policy *security.PasswordPolicy, hasher security.PasswordHasher) (*entity.User, error) {
 
 	if !u.validateName() {
 		return nil, errors.New("name is required")
@@ -43,11 +95,11 @@ func (u *UserRequestDTO) ToUserModel() (*entity.User, error) {
 		return nil, errors.New("email is required")
 	}
 
-	if !u.validatePassword() {
-		return nil, errors.New("password is required and must be at least 6 characters long")
+	if err := u.validatePassword(policy); err != nil {
+		return nil, err
 	}
 
-	hashedPassword, err := u.hashPassword()
+	hashedPassword, err := hasher.Hash(u.Password)
 	if err != nil {
 		return nil, err
 	}
@@ -57,6 +109,7 @@ func (u *UserRequestDTO) ToUserModel() (*entity.User, error) {
 		Name:           u.Name,
 		Email:          u.Email,
 		HashedPassword: hashedPassword,
+		Role:           entity.RoleUser,
 		CreatedAt:      time.Now(),
 		UpdatedAt:      time.Now(),
 	}, nil
@@ -68,39 +121,95 @@ func (u *UserRequestDTO) validateName() bool {
 }
 
 func (u *UserRequestDTO) validateEmail() bool {
+	return validateEmail(u.Email)
+}
 
-	if u.Email == "" {
-		return false
+func (u *UserRequestDTO) validatePassword(policy *security.PasswordPolicy) error {
+	return validatePassword(policy, u.Password, u.ConfirmPassword, u.Email, u.Name)
+}
+
+// ToHashedPassword validates the new password of the user and hashes it.
+func (r *ChangePasswordDTO) ToHashedPassword(policy *security.PasswordPolicy, hasher security.PasswordHasher, user *entity.User) (string, error) {
+
+	if err := validatePassword(policy, r.Password, r.ConfirmPassword, user.Email, user.Name); err != nil {
+		return "", err
 	}
 
-	emailRegex := `^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`
-	match, _ := regexp.MatchString(emailRegex, u.Email)
-	return match
+	return hasher.Hash(r.Password)
 }
 
-func (u *UserRequestDTO) validatePassword() bool {
+func (r *ChangeEmailDTO) Validate() error {
 
-	if u.Password == "" {
-		return false
+	if !validateEmail(r.Email) {
+		return errors.New("email is invalid")
 	}
 
-	if u.Password != u.ConfirmPassword {
-		return false
+	return nil
+}
+
+// ApplyTo copies the provided fields to the user and reports whether
+// anything was set.
+func (p *UserPatchDTO) ApplyTo(user *entity.User) (bool, error) {
+
+	changed := false
+
+	if p.Name != nil {
+		if *p.Name == "" {
+			return false, errors.New("name must not be empty")
+		}
+		user.Name = *p.Name
+		changed = true
 	}
 
-	if len(u.Password) < 6 {
-		return false
+	if p.Timezone != nil {
+		if !validateTimezone(*p.Timezone) {
+			return false, errors.New("timezone must be an IANA time zone, like Europe/Paris")
+		}
+		user.Timezone = *p.Timezone
+		changed = true
 	}
 
-	return true
+	return changed, nil
 }
 
-func (u *UserRequestDTO) hashPassword() (string, error) {
+// ToHashedPassword validates the new password of the user and hashes it.
+func (r *ResetPasswordDTO) ToHashedPassword(policy *security.PasswordPolicy, hasher security.PasswordHasher, user *entity.User) (string, error) {
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
-	if err != nil {
+	if err := validatePassword(policy, r.Password, r.ConfirmPassword, user.Email, user.Name); err != nil {
 		return "", err
 	}
 
-	return string(hashedPassword), nil
+	return hasher.Hash(r.Password)
+}
+
+func validateEmail(email string) bool {
+
+	if email == "" {
+		return false
+	}
+
+	emailRegex := `^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`
+	match, _ := regexp.MatchString(emailRegex, email)
+	return match
+}
+
+func validateTimezone(timezone string) bool {
+	if timezone == "" {
+		return true
+	}
+
+	// Local is the server's zone, not one users can mean
+	_, err := time.LoadLocation(timezone)
+	return err == nil && timezone != "Local"
+}
+
+// validatePassword returns a *security.PasswordPolicyError listing the
+// broken rules when the password doesn't meet the policy.
+func validatePassword(policy *security.PasswordPolicy, password string, confirmPassword string, email string, name string) error {
+
+	if password != confirmPassword {
+		return errors.New("passwords do not match")
+	}
+
+	return policy.Check(password, email, name)
 }
@@ -0,0 +1,43 @@
+package entity
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Scopes a personal access token can be granted.
+const (
+	ScopeTodosRead  = "todos:read"
+	ScopeTodosWrite = "todos:write"
+)
+
+var Scopes = []string{ScopeTodosRead, ScopeTodosWrite}
+
+// AccessToken is a personal access token a user created for scripts. The
+// plain token is only shown on creation: it is looked up by its Prefix and
+// checked against TokenHash.
+type AccessToken struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id"`
+	UserID     primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Name       string             `json:"name" bson:"name"`
+	Prefix     string             `json:"prefix" bson:"prefix"`
+	TokenHash  string             `json:"-" bson:"token_hash"`
+	Scopes     []string           `json:"scopes" bson:"scopes"`
+	ExpiresAt  *time.Time         `json:"expires_at" bson:"expires_at"`
+	LastUsedAt *time.Time         `json:"last_used_at" bson:"last_used_at"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+}
+
+func (a *AccessToken) IsExpired(now time.Time) bool {
+	return a.ExpiresAt != nil && !now.Before(*a.ExpiresAt)
+}
+
+func (a *AccessToken) HasScope(scope string) bool {
+	for _, s := range a.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
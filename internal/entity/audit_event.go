@@ -0,0 +1,84 @@
+package entity
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Audit actions.
+const (
+	AuditUserCreate         = "user.create"
+	AuditUserLogin          = "user.login"
+	AuditUserLoginMFA       = "user.login.mfa"
+	AuditUserLogout         = "user.logout"
+	AuditUserRefresh        = "user.refresh"
+	AuditUserUpdate         = "user.update"
+	AuditUserDelete         = "user.delete"
+	AuditPasswordChange     = "user.password.change"
+	AuditPasswordReset      = "user.password.reset"
+	AuditEmailChange        = "user.email.change"
+	AuditMFAEnable          = "user.mfa.enable"
+	AuditMFADisable         = "user.mfa.disable"
+	AuditRecoveryCodesReset = "user.mfa.recovery_codes"
+	AuditAccessTokenCreate  = "user.token.create"
+	AuditAccessTokenDelete  = "user.token.delete"
+	AuditCalendarRotate     = "user.calendar.rotate"
+	AuditCalendarDisable    = "user.calendar.disable"
+
+	AuditTodoCreate  = "todo.create"
+	AuditTodoUpdate  = "todo.update"
+	AuditTodoDelete  = "todo.delete"
+	AuditTodoRestore = "todo.restore"
+	AuditTodoUntrash = "todo.untrash"
+	AuditTodoPurge   = "todo.purge"
+
+	AuditAdminSearchUsers    = "admin.users.search"
+	AuditAdminViewUser       = "admin.users.view"
+	AuditAdminViewTodoCounts = "admin.users.todo_counts"
+	AuditAdminDisableUser    = "admin.users.disable"
+	AuditAdminEnableUser     = "admin.users.enable"
+	AuditAdminLogoutUser     = "admin.users.logout"
+	AuditAdminChangeRole     = "admin.users.role"
+	AuditAdminSearchAudit    = "admin.audit.search"
+)
+
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+const (
+	AuditTargetUser = "user"
+	AuditTargetTodo = "todo"
+)
+
+// AuditEvent records who did what, from where and what it changed. The
+// actor is unknown for failed logins with an unregistered email, in which
+// case only ActorEmail is set, and missing for background jobs, which have
+// no request either. Details holds the parameters of the action, e.g. why
+// it failed.
+type AuditEvent struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id"`
+	Action        string             `json:"action" bson:"action"`
+	Outcome       string             `json:"outcome" bson:"outcome"`
+	ActorID       primitive.ObjectID `json:"actor_id,omitempty" bson:"actor_id,omitempty"`
+	ActorEmail    string             `json:"actor_email" bson:"actor_email"`
+	TargetType    string             `json:"target_type,omitempty" bson:"target_type,omitempty"`
+	TargetID      string             `json:"target_id,omitempty" bson:"target_id,omitempty"`
+	IP            string             `json:"ip" bson:"ip"`
+	UserAgent     string             `json:"user_agent" bson:"user_agent"`
+	AccessTokenID string             `json:"access_token_id,omitempty" bson:"access_token_id,omitempty"`
+	Changes       []FieldChange      `json:"changes,omitempty" bson:"changes,omitempty"`
+	Details       map[string]string  `json:"details,omitempty" bson:"details,omitempty"`
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+	ExpiresAt     *time.Time         `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+}
+
+// FieldChange is the value of a field before and after an action. Before
+// is nil for created documents and After for deleted ones.
+type FieldChange struct {
+	Field  string `json:"field" bson:"field"`
+	Before any    `json:"before" bson:"before"`
+	After  any    `json:"after" bson:"after"`
+}
@@ -0,0 +1,20 @@
+package entity
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OIDCState remembers a login started at an OpenID Connect provider until
+// the provider redirects back. Only the hash of the state parameter is
+// stored; abandoned logins are removed by a TTL index.
+type OIDCState struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id"`
+	StateHash    string             `json:"-" bson:"state_hash"`
+	Provider     string             `json:"provider" bson:"provider"`
+	Nonce        string             `json:"-" bson:"nonce"`
+	CodeVerifier string             `json:"-" bson:"code_verifier"`
+	ExpiresAt    time.Time          `json:"expires_at" bson:"expires_at"`
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
+}
@@ -1,6 +1,7 @@
 package entity
 
 import (
+	"errors"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -10,10 +11,99 @@ type Todo struct {
 	ID          primitive.ObjectID `json:"id" bson:"_id"`
 	Title       string             `json:"title" bson:"title"`
 	Description string             `json:"description" bson:"description"`
+	Tags        []string           `json:"tags" bson:"tags"`
 	Scheduled   bool               `json:"scheduled" bson:"scheduled"`
 	ScheduledTo time.Time          `json:"scheduled_to" bson:"scheduled_to"`
+	AllDay      bool               `json:"all_day" bson:"all_day"`
 	Completed   bool               `json:"completed" bson:"completed"`
 	CompletedAt time.Time          `json:"completed_at" bson:"completed_at"`
 	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
 	UserID      primitive.ObjectID `json:"user_id" bson:"user_id"`
+	// Version goes up by one on each update. Todos from before versions
+	// have none, read as 0.
+	Version int64 `json:"version" bson:"version"`
+	// DeletedAt is set while the todo is in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty" bson:"deleted_at"`
+}
+
+// DateLayout is how the schedule of all-day todos is written.
+const DateLayout = "2006-01-02"
+
+var (
+	ErrInvalidScheduleTime = errors.New("scheduled_to must be an RFC 3339 time with an offset, like 2026-01-02T15:04:05+01:00")
+	ErrInvalidScheduleDate = errors.New("scheduled_to of an all-day todo must be a date, like 2026-01-02")
+)
+
+// ParseSchedule reads the schedule of a todo: an RFC 3339 time, or for
+// all-day todos a date, kept as midnight UTC whatever the time zone. That
+// midnight, as todos are returned, is read back as the date. An empty value,
+// or the zero time todos without a schedule are returned with, is no
+// schedule: the zero time.
+func ParseSchedule(value string, allDay bool) (time.Time, error) {
+
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := parseSchedule(value, allDay)
+	if err != nil || t.IsZero() {
+		return time.Time{}, err
+	}
+
+	return t, nil
+}
+
+func parseSchedule(value string, allDay bool) (time.Time, error) {
+
+	if allDay {
+		if date, err := time.Parse(DateLayout, value); err == nil {
+			return date, nil
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil || !t.Equal(t.UTC().Truncate(24*time.Hour)) {
+			return time.Time{}, ErrInvalidScheduleDate
+		}
+		return t.UTC(), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, ErrInvalidScheduleTime
+	}
+
+	return t, nil
+}
+
+// FormatSchedule writes the schedule as ParseSchedule reads it, or "" when
+// there is none.
+func (t *Todo) FormatSchedule() string {
+	switch {
+	case t.ScheduledTo.IsZero():
+		return ""
+	case t.AllDay:
+		return t.ScheduledTo.UTC().Format(DateLayout)
+	default:
+		return t.ScheduledTo.Format(time.RFC3339Nano)
+	}
+}
+
+// ScheduledIn returns when the todo is scheduled in loc: its time, or the
+// start of its day there when it lasts all day.
+func (t *Todo) ScheduledIn(loc *time.Location) time.Time {
+	if !t.AllDay {
+		return t.ScheduledTo.In(loc)
+	}
+
+	year, month, day := t.ScheduledTo.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+// TodoCounts summarizes the todos of a user. Trashed todos are only
+// counted in Trashed.
+type TodoCounts struct {
+	Total     int64 `json:"total" bson:"total"`
+	Completed int64 `json:"completed" bson:"completed"`
+	Scheduled int64 `json:"scheduled" bson:"scheduled"`
+	Trashed   int64 `json:"trashed" bson:"trashed"`
 }
@@ -0,0 +1,18 @@
+package entity
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TodoRevision is a todo as it was before an update, taken at CreatedAt.
+// The revisions of a todo are numbered from 1.
+type TodoRevision struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	TodoID    primitive.ObjectID `json:"todo_id" bson:"todo_id"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Revision  int                `json:"revision" bson:"revision"`
+	Todo      Todo               `json:"todo" bson:"todo"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
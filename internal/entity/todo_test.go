@@ -0,0 +1,88 @@
+package entity
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		allDay bool
+		want   time.Time
+		err    error
+	}{
+		{"empty", "", false, time.Time{}, nil},
+		{"empty all day", "", true, time.Time{}, nil},
+		{"zero time", "0001-01-01T00:00:00Z", false, time.Time{}, nil},
+		{"zero time all day", "0001-01-01T00:00:00Z", true, time.Time{}, nil},
+		{"time", "2026-01-02T15:04:05+01:00", false, time.Date(2026, 1, 2, 14, 4, 5, 0, time.UTC), nil},
+		{"time in UTC", "2026-01-02T15:04:05Z", false, time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC), nil},
+		{"time without offset", "2026-01-02T15:04:05", false, time.Time{}, ErrInvalidScheduleTime},
+		{"date of a timed todo", "2026-01-02", false, time.Time{}, ErrInvalidScheduleTime},
+		{"garbage", "tomorrow", false, time.Time{}, ErrInvalidScheduleTime},
+		{"date", "2026-01-02", true, time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), nil},
+		{"midnight UTC", "2026-01-02T00:00:00Z", true, time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), nil},
+		{"midnight UTC with an offset", "2026-01-02T01:00:00+01:00", true, time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), nil},
+		{"time of an all-day todo", "2026-01-02T15:04:05Z", true, time.Time{}, ErrInvalidScheduleDate},
+		{"local midnight of an all-day todo", "2026-01-02T00:00:00+01:00", true, time.Time{}, ErrInvalidScheduleDate},
+		{"invalid date", "2026-02-30", true, time.Time{}, ErrInvalidScheduleDate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSchedule(tt.value, tt.allDay)
+			if err != tt.err {
+				t.Fatalf("error %v, want %v", err, tt.err)
+			}
+			if !got.Equal(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			if tt.want.IsZero() && !got.IsZero() {
+				t.Fatalf("got %v, want the zero time", got)
+			}
+		})
+	}
+}
+
+func TestFormatSchedule(t *testing.T) {
+	tests := []struct {
+		name string
+		todo Todo
+		want string
+	}{
+		{"none", Todo{}, ""},
+		{"time", Todo{ScheduledTo: time.Date(2026, 1, 2, 15, 4, 5, 0, time.FixedZone("", 3600))}, "2026-01-02T15:04:05+01:00"},
+		{"date", Todo{ScheduledTo: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), AllDay: true}, "2026-01-02"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.todo.FormatSchedule()
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+
+			parsed, err := ParseSchedule(got, tt.todo.AllDay)
+			if err != nil || !parsed.Equal(tt.todo.ScheduledTo) {
+				t.Fatalf("read back as %v (%v)", parsed, err)
+			}
+		})
+	}
+}
+
+func TestScheduledIn(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*3600)
+	date := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	allDay := Todo{ScheduledTo: date, AllDay: true}
+	if got := allDay.ScheduledIn(tokyo); !got.Equal(time.Date(2026, 1, 2, 0, 0, 0, 0, tokyo)) {
+		t.Fatalf("all-day todo starts at %v in Tokyo", got)
+	}
+
+	timed := Todo{ScheduledTo: date}
+	if got := timed.ScheduledIn(tokyo); !got.Equal(date) || got.Location() != tokyo {
+		t.Fatalf("timed todo at %v in Tokyo", got)
+	}
+}
@@ -1,25 +1,158 @@
 package entity
 
 import (
+	"crypto/subtle"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type User struct {
 	ID             primitive.ObjectID `json:"id" bson:"_id"`
 	Name           string             `json:"name" bson:"name"`
 	Email          string             `json:"email" bson:"email"`
-	HashedPassword string             `json:"hashed_password" bson:"hashed_password"`
+	EmailVerified  bool               `json:"email_verified" bson:"email_verified"`
+	VerifiedAt     time.Time          `json:"verified_at" bson:"verified_at"`
+	HashedPassword string             `json:"-" bson:"hashed_password"`
 	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt      time.Time          `json:"updated_at" bson:"updated_at"`
 	Removed        bool               `json:"removed" bson:"removed"`
 	RemovedAt      time.Time          `json:"removed_at" bson:"removed_at"`
+	Lockout        LoginLockout       `json:"lockout" bson:"lockout"`
+	MFA            UserMFA            `json:"mfa" bson:"mfa"`
+	Identities     []UserIdentity     `json:"identities" bson:"identities"`
+	Calendar       UserCalendar       `json:"calendar" bson:"calendar"`
+	Timezone       string             `json:"timezone" bson:"timezone"`
+	Role           string             `json:"role" bson:"role"`
+	Disabled       bool               `json:"disabled" bson:"disabled"`
+	DisabledAt     time.Time          `json:"disabled_at" bson:"disabled_at"`
+	DisabledReason string             `json:"disabled_reason" bson:"disabled_reason"`
+	// TokensValidAfter revokes the JWTs issued before it, e.g. on a password
+	// change or when the user is logged out.
+	TokensValidAfter time.Time `json:"-" bson:"tokens_valid_after"`
 }
 
-func (u *User) ComparePassword(password string) bool {
+// Roles. Support staff can look accounts up, disable them and log them
+// out; admins can also change roles.
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+var Roles = []string{RoleUser, RoleSupport, RoleAdmin}
+
+// EffectiveRole is the role of the user, accounts created before roles
+// existed being plain users.
+func (u *User) EffectiveRole() string {
+	if u.Role == "" {
+		return RoleUser
+	}
+
+	return u.Role
+}
+
+// Location is the time zone of the user, UTC when none was chosen or it is
+// no longer known.
+func (u *User) Location() *time.Location {
+	if u.Timezone == "" {
+		return time.UTC
+	}
+
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+
+	return loc
+}
+
+// TokenRevoked reports whether a JWT issued at issuedAtMs (Unix
+// milliseconds) was revoked. Tokens older than the account were issued to a
+// previous owner of the email.
+func (u *User) TokenRevoked(issuedAtMs int64) bool {
+	return issuedAtMs < u.CreatedAt.UnixMilli() || issuedAtMs < u.TokensValidAfter.UnixMilli()
+}
+
+// IsStaff reports whether the user has access to the admin API.
+func (u *User) IsStaff() bool {
+	return u.EffectiveRole() != RoleUser
+}
+
+// UserIdentity links the user to an account at an OpenID Connect provider,
+// identified by the provider's subject.
+type UserIdentity struct {
+	Provider string    `json:"provider" bson:"provider"`
+	Subject  string    `json:"subject" bson:"subject"`
+	Email    string    `json:"email" bson:"email"`
+	LinkedAt time.Time `json:"linked_at" bson:"linked_at"`
+}
+
+// UserCalendar holds the secret of the calendar feed URL, hashed. The feed
+// is off while TokenHash is empty.
+type UserCalendar struct {
+	TokenHash string    `json:"-" bson:"token_hash,omitempty"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// UserMFA holds the TOTP second factor. PendingSecret is set on enrollment
+// and only becomes Secret once a code generated from it is confirmed.
+// LastStep is the time step of the last accepted code, so codes can't be
+// replayed.
+type UserMFA struct {
+	Enabled       bool      `json:"enabled" bson:"enabled"`
+	Secret        string    `json:"-" bson:"secret"`
+	PendingSecret string    `json:"-" bson:"pending_secret"`
+	LastStep      int64     `json:"last_step" bson:"last_step"`
+	RecoveryCodes []string  `json:"-" bson:"recovery_codes"`
+	EnabledAt     time.Time `json:"enabled_at" bson:"enabled_at"`
+}
+
+// UseRecoveryCode removes the hashed recovery code and reports whether it
+// was there.
+func (m *UserMFA) UseRecoveryCode(hash string) bool {
+	for i, code := range m.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(code), []byte(hash)) == 1 {
+			m.RecoveryCodes = append(m.RecoveryCodes[:i], m.RecoveryCodes[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// LoginLockout tracks consecutive failed logins. Once FailedAttempts reaches
+// the limit the account is locked until LockedUntil, and every new lock
+// lasts longer than the previous one.
+type LoginLockout struct {
+	FailedAttempts int       `json:"failed_attempts" bson:"failed_attempts"`
+	LastFailureAt  time.Time `json:"last_failure_at" bson:"last_failure_at"`
+	LockedUntil    time.Time `json:"locked_until" bson:"locked_until"`
+	LockCount      int       `json:"lock_count" bson:"lock_count"`
+}
+
+func (l *LoginLockout) IsLocked(now time.Time) bool {
+	return now.Before(l.LockedUntil)
+}
+
+// Fail records a failed attempt and locks the account for lockFor(LockCount)
+// when maxAttempts is reached. It reports whether the account got locked.
+func (l *LoginLockout) Fail(now time.Time, maxAttempts int, lockFor func(lockCount int) time.Duration) bool {
+	l.FailedAttempts++
+	l.LastFailureAt = now
+
+	if l.FailedAttempts < maxAttempts {
+		return false
+	}
+
+	l.LockedUntil = now.Add(lockFor(l.LockCount))
+	l.LockCount++
+	l.FailedAttempts = 0
+
+	return true
+}
 
-	err := bcrypt.CompareHashAndPassword([]byte(u.HashedPassword), []byte(password))
-	return err == nil
+// Reset clears the record after a successful login.
+func (l *LoginLockout) Reset() {
+	*l = LoginLockout{}
 }
@@ -0,0 +1,26 @@
+package entity
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	TokenPurposePasswordReset = "password_reset"
+	TokenPurposeEmailChange   = "email_change"
+	TokenPurposeVerification  = "email_verification"
+)
+
+// UserToken is a single-use secret sent to a user by email. Only the hash
+// of the secret is stored; expired tokens are removed by a TTL index.
+type UserToken struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Purpose   string             `json:"purpose" bson:"purpose"`
+	TokenHash string             `json:"-" bson:"token_hash"`
+	Email     string             `json:"email" bson:"email"`
+	ExpiresAt time.Time          `json:"expires_at" bson:"expires_at"`
+	UsedAt    *time.Time         `json:"used_at" bson:"used_at"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"slices"
+	"strings"
+	"time"
+	"todo-app-mongo/internal/database"
+	"todo-app-mongo/internal/dtos"
+	"todo-app-mongo/internal/entity"
+	"todo-app-mongo/internal/pkg/audit"
+	"todo-app-mongo/internal/pkg/security"
+	"todo-app-mongo/internal/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type AccessTokenHandler struct {
+	userDAO        database.UserDAOInterface
+	accessTokenDAO database.AccessTokenDAOInterface
+	audit          *audit.Recorder
+}
+
+func NewAccessTokenHandler(userDAO database.UserDAOInterface, accessTokenDAO database.AccessTokenDAOInterface, audit *audit.Recorder) *AccessTokenHandler {
+	return &AccessTokenHandler{userDAO: userDAO, accessTokenDAO: accessTokenDAO, audit: audit}
+}
+
+// @Summary Create a personal access token
+// @Description Create a scoped token for scripts, sent as a Bearer token. It is only shown in this response
+// @Security Bearer
+// @Tags tokens
+// @Accept json
+// @Produce json
+// @Param body body dtos.CreateAccessTokenDTO true "Name, scopes and optional expiry"
+// @Success 201 {object} dtos.CreatedAccessTokenResponseDTO "Token created"
+// @Failure 400 {object} utils.ErrorHandler
+// @Router /user/tokens [post]
+func (a *AccessTokenHandler) Create(c *gin.Context) {
+
+	var dto dtos.CreateAccessTokenDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		utils.DefaultErrorResponse(c, 400, "Invalid request body")
+		return
+	}
+
+	now := time.Now()
+	if err := dto.Validate(now); err != nil {
+		utils.DefaultErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	user, err := a.userDAO.GetByEmail(c, c.GetString("email"))
+	if err != nil {
+		utils.DefaultErrorResponse(c, 404, "User not found")
+		return
+	}
+
+	plain, prefix, hash, err := security.NewAccessToken()
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	scopes := slices.Clone(dto.Scopes)
+	slices.Sort(scopes)
+
+	token := &entity.AccessToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		Name:      dto.Name,
+		Prefix:    prefix,
+		TokenHash: hash,
+		Scopes:    slices.Compact(scopes),
+		ExpiresAt: dto.ExpiresAt,
+		CreatedAt: now,
+	}
+
+	if err := a.accessTokenDAO.Create(c, token); err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	event := userEvent(entity.AuditAccessTokenCreate, user)
+	event.Details = map[string]string{"token_id": token.ID.Hex(), "name": token.Name, "scopes": strings.Join(token.Scopes, " ")}
+	a.audit.Record(c, event)
+
+	c.JSON(201, dtos.CreatedAccessTokenResponseDTO{
+		AccessTokenResponseDTO: dtos.NewAccessTokenResponseDTO(token),
+		Token:                  plain,
+	})
+}
+
+// @Summary List personal access tokens
+// @Description List the tokens of the logged user, newest first
+// @Security Bearer
+// @Tags tokens
+// @Produce json
+// @Success 200 {array} dtos.AccessTokenResponseDTO
+// @Router /user/tokens [get]
+func (a *AccessTokenHandler) List(c *gin.Context) {
+
+	user, err := a.userDAO.GetByEmail(c, c.GetString("email"))
+	if err != nil {
+		utils.DefaultErrorResponse(c, 404, "User not found")
+		return
+	}
+
+	tokens, err := a.accessTokenDAO.ListByUser(c, user.ID)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	response := make([]dtos.AccessTokenResponseDTO, len(tokens))
+	for i, token := range tokens {
+		response[i] = dtos.NewAccessTokenResponseDTO(token)
+	}
+
+	c.JSON(200, response)
+}
+
+// @Summary Revoke a personal access token
+// @Description Delete a token of the logged user; it stops working immediately
+// @Security Bearer
+// @Tags tokens
+// @Produce json
+// @Param id path string true "Token ID"
+// @Success 200
+// @Failure 404 {object} utils.ErrorHandler
+// @Router /user/tokens/{id} [delete]
+func (a *AccessTokenHandler) Delete(c *gin.Context) {
+
+	user, err := a.userDAO.GetByEmail(c, c.GetString("email"))
+	if err != nil {
+		utils.DefaultErrorResponse(c, 404, "User not found")
+		return
+	}
+
+	err = a.accessTokenDAO.Delete(c, user.ID, c.Param("id"))
+	if err == mongo.ErrNoDocuments {
+		utils.DefaultErrorResponse(c, 404, "Token not found")
+		return
+	}
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	event := userEvent(entity.AuditAccessTokenDelete, user)
+	event.Details = map[string]string{"token_id": c.Param("id")}
+	a.audit.Record(c, event)
+
+	c.JSON(200, gin.H{
+		"message": "Token revoked",
+		"success": true,
+	})
+}
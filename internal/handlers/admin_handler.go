@@ -0,0 +1,513 @@
+package handlers
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"time"
+	"todo-app-mongo/internal/database"
+	"todo-app-mongo/internal/dtos"
+	"todo-app-mongo/internal/entity"
+	"todo-app-mongo/internal/pkg/audit"
+	"todo-app-mongo/internal/pkg/security"
+	"todo-app-mongo/internal/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	adminPageSize    = 20
+	adminMaxPageSize = 100
+)
+
+// AdminHandler serves the admin API used by support staff and admins.
+// Every action, lookups included, is recorded in the audit log.
+type AdminHandler struct {
+	userDAO      database.UserDAOInterface
+	todoDAO      database.TodoDAOInterface
+	auditDAO     database.AuditEventDAOInterface
+	accessTokens database.AccessTokenDAOInterface
+	userJWT      security.UserJWTInterface
+	audit        *audit.Recorder
+}
+
+func NewAdminHandler(userDAO database.UserDAOInterface, todoDAO database.TodoDAOInterface, auditDAO database.AuditEventDAOInterface, accessTokens database.AccessTokenDAOInterface, userJWT security.UserJWTInterface, audit *audit.Recorder) *AdminHandler {
+	return &AdminHandler{userDAO: userDAO, todoDAO: todoDAO, auditDAO: auditDAO, accessTokens: accessTokens, userJWT: userJWT, audit: audit}
+}
+
+// @Summary Search users
+// @Description List the users, newest first, optionally filtered by name or email, role and status
+// @Security Bearer
+// @Tags admin
+// @Produce json
+// @Param search query string false "Part of the name or email"
+// @Param role query string false "Role" Enums(user, support, admin)
+// @Param disabled query bool false "Only disabled or enabled accounts"
+// @Param limit query int false "Limit" default(20)
+// @Param offset query int false "Offset" default(0)
+// @Success 200 {object} dtos.PageDTO{data=[]dtos.AdminUserResponseDTO}
+// @Failure 400 {object} utils.ErrorHandler
+// @Failure 403 {object} utils.ErrorHandler
+// @Router /admin/users [get]
+func (a *AdminHandler) ListUsers(c *gin.Context) {
+
+	actor, ok := a.actor(c)
+	if !ok {
+		return
+	}
+
+	filter := database.UserFilter{Query: c.Query("search"), Role: c.Query("role")}
+	if filter.Role != "" && !slices.Contains(entity.Roles, filter.Role) {
+		utils.DefaultErrorResponse(c, 400, "Invalid role")
+		return
+	}
+	if d := c.Query("disabled"); d != "" {
+		disabled, err := strconv.ParseBool(d)
+		if err != nil {
+			utils.DefaultErrorResponse(c, 400, "Invalid disabled filter")
+			return
+		}
+		filter.Disabled = &disabled
+	}
+
+	limit, offset, ok := adminPage(c)
+	if !ok {
+		return
+	}
+
+	users, total, err := a.userDAO.Search(c, filter, limit, offset)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	a.record(c, actor, entity.AuditAdminSearchUsers, nil, map[string]string{
+		"search":   filter.Query,
+		"role":     filter.Role,
+		"disabled": c.Query("disabled"),
+	})
+
+	totalPages := int64(math.Ceil(float64(total) / float64(limit)))
+	c.JSON(200, dtos.NewPageDTO(total, offset, totalPages, dtos.NewAdminUserResponseDTOs(users)))
+}
+
+// @Summary Get a user
+// @Description Get any user by ID
+// @Security Bearer
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} dtos.AdminUserResponseDTO
+// @Failure 403 {object} utils.ErrorHandler
+// @Failure 404 {object} utils.ErrorHandler
+// @Router /admin/users/{id} [get]
+func (a *AdminHandler) GetUser(c *gin.Context) {
+
+	actor, ok := a.actor(c)
+	if !ok {
+		return
+	}
+
+	user, ok := a.target(c)
+	if !ok {
+		return
+	}
+
+	a.record(c, actor, entity.AuditAdminViewUser, user, nil)
+
+	c.JSON(200, dtos.NewAdminUserResponseDTO(user))
+}
+
+// @Summary Count the todos of a user
+// @Description How many todos any user has, without their content
+// @Security Bearer
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} dtos.TodoCountsResponseDTO
+// @Failure 403 {object} utils.ErrorHandler
+// @Failure 404 {object} utils.ErrorHandler
+// @Router /admin/users/{id}/todos/count [get]
+func (a *AdminHandler) TodoCounts(c *gin.Context) {
+
+	actor, ok := a.actor(c)
+	if !ok {
+		return
+	}
+
+	user, ok := a.target(c)
+	if !ok {
+		return
+	}
+
+	counts, err := a.todoDAO.CountByUser(c, user.ID)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	a.record(c, actor, entity.AuditAdminViewTodoCounts, user, nil)
+
+	c.JSON(200, dtos.NewTodoCountsResponseDTO(counts))
+}
+
+// @Summary Disable a user
+// @Description Refuse the logins, sessions and personal access tokens of the user until enabled again. Support staff can't disable staff accounts
+// @Security Bearer
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param body body dtos.DisableUserDTO false "Reason"
+// @Success 200 {object} dtos.AdminUserResponseDTO
+// @Failure 400 {object} utils.ErrorHandler
+// @Failure 403 {object} utils.ErrorHandler
+// @Failure 404 {object} utils.ErrorHandler
+// @Failure 409 {object} utils.ErrorHandler
+// @Router /admin/users/{id}/disable [post]
+func (a *AdminHandler) Disable(c *gin.Context) {
+
+	var dto dtos.DisableUserDTO
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&dto); err != nil {
+			utils.DefaultErrorResponse(c, 400, "Invalid request body")
+			return
+		}
+	}
+
+	actor, user, ok := a.manageable(c)
+	if !ok {
+		return
+	}
+
+	if user.Disabled {
+		utils.DefaultErrorResponse(c, 409, "Account already disabled")
+		return
+	}
+
+	now := time.Now()
+	user.Disabled = true
+	user.DisabledAt = now
+	user.DisabledReason = dto.Reason
+	user.UpdatedAt = now
+
+	changed, err := a.userDAO.SetDisabled(c, user.ID, true, dto.Reason, now)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+	if !changed {
+		utils.DefaultErrorResponse(c, 409, "Account already disabled")
+		return
+	}
+
+	if err := revokeTokens(c, a.userDAO, a.userJWT, user); err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	a.record(c, actor, entity.AuditAdminDisableUser, user, map[string]string{"reason": dto.Reason})
+
+	c.JSON(200, dtos.NewAdminUserResponseDTO(user))
+}
+
+// @Summary Enable a user
+// @Description Let a disabled user log in again
+// @Security Bearer
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} dtos.AdminUserResponseDTO
+// @Failure 403 {object} utils.ErrorHandler
+// @Failure 404 {object} utils.ErrorHandler
+// @Failure 409 {object} utils.ErrorHandler
+// @Router /admin/users/{id}/enable [post]
+func (a *AdminHandler) Enable(c *gin.Context) {
+
+	actor, user, ok := a.manageable(c)
+	if !ok {
+		return
+	}
+
+	if !user.Disabled {
+		utils.DefaultErrorResponse(c, 409, "Account not disabled")
+		return
+	}
+
+	user.Disabled = false
+	user.DisabledAt = time.Time{}
+	user.DisabledReason = ""
+	user.UpdatedAt = time.Now()
+
+	changed, err := a.userDAO.SetDisabled(c, user.ID, false, "", user.UpdatedAt)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+	if !changed {
+		utils.DefaultErrorResponse(c, 409, "Account not disabled")
+		return
+	}
+
+	a.record(c, actor, entity.AuditAdminEnableUser, user, nil)
+
+	c.JSON(200, dtos.NewAdminUserResponseDTO(user))
+}
+
+// @Summary Log a user out
+// @Description Revoke every access and refresh token issued to the user and delete their personal access tokens
+// @Security Bearer
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200
+// @Failure 403 {object} utils.ErrorHandler
+// @Failure 404 {object} utils.ErrorHandler
+// @Router /admin/users/{id}/logout [post]
+func (a *AdminHandler) Logout(c *gin.Context) {
+
+	actor, user, ok := a.manageable(c)
+	if !ok {
+		return
+	}
+
+	if err := revokeAllAccess(c, a.userDAO, a.userJWT, a.accessTokens, user); err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	a.record(c, actor, entity.AuditAdminLogoutUser, user, nil)
+
+	c.JSON(200, gin.H{
+		"message": "User logged out",
+		"success": true,
+	})
+}
+
+// @Summary Change the role of a user
+// @Description Make the user a plain user, support staff or an admin. The user is logged out so new tokens carry the role
+// @Security Bearer
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param body body dtos.ChangeRoleDTO true "Role"
+// @Success 200 {object} dtos.AdminUserResponseDTO
+// @Failure 400 {object} utils.ErrorHandler
+// @Failure 403 {object} utils.ErrorHandler
+// @Failure 404 {object} utils.ErrorHandler
+// @Router /admin/users/{id}/role [put]
+func (a *AdminHandler) ChangeRole(c *gin.Context) {
+
+	var dto dtos.ChangeRoleDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		utils.DefaultErrorResponse(c, 400, "Invalid request body")
+		return
+	}
+
+	if !slices.Contains(entity.Roles, dto.Role) {
+		utils.DefaultErrorResponse(c, 400, "Invalid role")
+		return
+	}
+
+	actor, user, ok := a.manageable(c)
+	if !ok {
+		return
+	}
+
+	previous := user.EffectiveRole()
+	if previous != dto.Role {
+		user.Role = dto.Role
+		user.UpdatedAt = time.Now()
+
+		if err := a.userDAO.SetRole(c, user.ID, user.Role, user.UpdatedAt); err != nil {
+			utils.DefaultErrorResponse(c, 500, "Internal server error")
+			return
+		}
+
+		if err := revokeTokens(c, a.userDAO, a.userJWT, user); err != nil {
+			utils.DefaultErrorResponse(c, 500, "Internal server error")
+			return
+		}
+	}
+
+	a.record(c, actor, entity.AuditAdminChangeRole, user, map[string]string{"from": previous, "to": dto.Role})
+
+	c.JSON(200, dtos.NewAdminUserResponseDTO(user))
+}
+
+// @Summary Search the audit log
+// @Description List audit events, newest first. The actor is an email or a user ID; from and to are RFC 3339 times, from inclusive and to exclusive
+// @Security Bearer
+// @Tags admin
+// @Produce json
+// @Param action query string false "Action, e.g. todo.delete"
+// @Param outcome query string false "Outcome" Enums(success, failure)
+// @Param actor query string false "Actor email or ID"
+// @Param target_type query string false "Target type" Enums(user, todo)
+// @Param target_id query string false "Target ID"
+// @Param from query string false "Earliest time"
+// @Param to query string false "Latest time"
+// @Param limit query int false "Limit" default(20)
+// @Param offset query int false "Offset" default(0)
+// @Success 200 {object} dtos.PageDTO{data=[]entity.AuditEvent}
+// @Failure 400 {object} utils.ErrorHandler
+// @Failure 403 {object} utils.ErrorHandler
+// @Router /admin/audit [get]
+func (a *AdminHandler) SearchAudit(c *gin.Context) {
+
+	actor, ok := a.actor(c)
+	if !ok {
+		return
+	}
+
+	filter := database.AuditFilter{
+		Action:     c.Query("action"),
+		Outcome:    c.Query("outcome"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+	}
+
+	if filter.Outcome != "" && filter.Outcome != entity.AuditSuccess && filter.Outcome != entity.AuditFailure {
+		utils.DefaultErrorResponse(c, 400, "Invalid outcome")
+		return
+	}
+
+	if by := c.Query("actor"); by != "" {
+		if id, err := primitive.ObjectIDFromHex(by); err == nil {
+			filter.ActorID = id
+		} else {
+			filter.ActorEmail = by
+		}
+	}
+
+	for param, t := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := c.Query(param); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				utils.DefaultErrorResponse(c, 400, param+" must be an RFC 3339 time")
+				return
+			}
+			*t = parsed
+		}
+	}
+
+	limit, offset, ok := adminPage(c)
+	if !ok {
+		return
+	}
+
+	events, total, err := a.auditDAO.Search(c, filter, limit, offset)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	a.record(c, actor, entity.AuditAdminSearchAudit, nil, map[string]string{
+		"action":      filter.Action,
+		"outcome":     filter.Outcome,
+		"actor":       c.Query("actor"),
+		"target_type": filter.TargetType,
+		"target_id":   filter.TargetID,
+		"from":        c.Query("from"),
+		"to":          c.Query("to"),
+	})
+
+	totalPages := int64(math.Ceil(float64(total) / float64(limit)))
+	c.JSON(200, dtos.NewPageDTO(total, offset, totalPages, events))
+}
+
+// actor loads the staff member making the request.
+func (a *AdminHandler) actor(c *gin.Context) (*entity.User, bool) {
+
+	actor, err := a.userDAO.GetByEmail(c, c.GetString("email"))
+	if err != nil {
+		utils.DefaultErrorResponse(c, 401, "Unauthorized")
+		return nil, false
+	}
+
+	return actor, true
+}
+
+// target loads the user named by the id path parameter.
+func (a *AdminHandler) target(c *gin.Context) (*entity.User, bool) {
+
+	user, err := a.userDAO.GetById(c, c.Param("id"))
+	if err != nil {
+		utils.DefaultErrorResponse(c, 404, "User not found")
+		return nil, false
+	}
+
+	return user, true
+}
+
+// manageable loads the actor and the target of an action changing the
+// target. Staff can't act on their own account, and only admins can act
+// on other staff.
+func (a *AdminHandler) manageable(c *gin.Context) (*entity.User, *entity.User, bool) {
+
+	actor, ok := a.actor(c)
+	if !ok {
+		return nil, nil, false
+	}
+
+	user, ok := a.target(c)
+	if !ok {
+		return nil, nil, false
+	}
+
+	if user.ID == actor.ID {
+		utils.DefaultErrorResponse(c, 400, "You can't do this to your own account")
+		return nil, nil, false
+	}
+	if user.IsStaff() && actor.EffectiveRole() != entity.RoleAdmin {
+		utils.DefaultErrorResponse(c, 403, "Only admins can manage staff accounts")
+		return nil, nil, false
+	}
+
+	return actor, user, true
+}
+
+// record writes the action of the staff member to the audit log.
+func (a *AdminHandler) record(c *gin.Context, actor *entity.User, action string, target *entity.User, details map[string]string) {
+
+	event := &entity.AuditEvent{
+		Action:     action,
+		ActorID:    actor.ID,
+		ActorEmail: actor.Email,
+		Details:    details,
+	}
+	if target != nil {
+		event.TargetType = entity.AuditTargetUser
+		event.TargetID = target.ID.Hex()
+	}
+
+	a.audit.Record(c, event)
+}
+
+// adminPage reads the limit and offset query parameters.
+func adminPage(c *gin.Context) (int64, int64, bool) {
+
+	limit, offset := int64(adminPageSize), int64(0)
+
+	if l := c.Query("limit"); l != "" {
+		n, err := strconv.ParseInt(l, 10, 64)
+		if err != nil || n < 1 || n > adminMaxPageSize {
+			utils.DefaultErrorResponse(c, 400, "limit must be between 1 and "+strconv.Itoa(adminMaxPageSize))
+			return 0, 0, false
+		}
+		limit = n
+	}
+
+	if o := c.Query("offset"); o != "" {
+		n, err := strconv.ParseInt(o, 10, 64)
+		if err != nil || n < 0 {
+			utils.DefaultErrorResponse(c, 400, "Invalid offset")
+			return 0, 0, false
+		}
+		offset = n
+	}
+
+	return limit, offset, true
+}
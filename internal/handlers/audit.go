@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"todo-app-mongo/internal/entity"
+)
+
+// userEvent starts the audit event of an action of the user on their own
+// account.
+func userEvent(action string, user *entity.User) *entity.AuditEvent {
+	return &entity.AuditEvent{
+		Action:     action,
+		ActorID:    user.ID,
+		ActorEmail: user.Email,
+		TargetType: entity.AuditTargetUser,
+		TargetID:   user.ID.Hex(),
+	}
+}
+
+// failedEvent is the audit event of a refused request. The user is nil
+// when unknown, e.g. a login with an unregistered email.
+func failedEvent(action string, user *entity.User, email string, reason string) *entity.AuditEvent {
+
+	event := &entity.AuditEvent{ActorEmail: email}
+	if user != nil {
+		event = userEvent(action, user)
+	}
+
+	event.Action = action
+	event.Outcome = entity.AuditFailure
+	event.Details = map[string]string{"reason": reason}
+
+	return event
+}
+
+// todoEvent starts the audit event of an action of the user on one of
+// their todos.
+func todoEvent(action string, user *entity.User, todo *entity.Todo) *entity.AuditEvent {
+	return &entity.AuditEvent{
+		Action:     action,
+		ActorID:    user.ID,
+		ActorEmail: user.Email,
+		TargetType: entity.AuditTargetTodo,
+		TargetID:   todo.ID.Hex(),
+	}
+}
+
+// profile is what the audit log keeps of the user on profile changes, so
+// hashes and secrets stay out of it.
+func profile(user *entity.User) map[string]any {
+	if user == nil {
+		return nil
+	}
+
+	return map[string]any{
+		"name":           user.Name,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+		"timezone":       user.Timezone,
+	}
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+	"todo-app-mongo/internal/database"
+	"todo-app-mongo/internal/dtos"
+	"todo-app-mongo/internal/entity"
+	"todo-app-mongo/internal/pkg/audit"
+	"todo-app-mongo/internal/pkg/security"
+	"todo-app-mongo/internal/pkg/todoio"
+	"todo-app-mongo/internal/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// calendarRefresh is how often calendar apps are asked to fetch the feed.
+const calendarRefresh = time.Hour
+
+type CalendarHandler struct {
+	userDAO   database.UserDAOInterface
+	todoDAO   database.TodoDAOInterface
+	audit     *audit.Recorder
+	publicURL string
+}
+
+func NewCalendarHandler(userDAO database.UserDAOInterface, todoDAO database.TodoDAOInterface, audit *audit.Recorder, publicURL string) *CalendarHandler {
+	return &CalendarHandler{userDAO: userDAO, todoDAO: todoDAO, audit: audit, publicURL: publicURL}
+}
+
+// @Summary Calendar feed status
+// @Description Tell whether the calendar feed of the logged user is on. Its URL is only shown when created
+// @Security Bearer
+// @Tags calendar
+// @Produce json
+// @Success 200 {object} dtos.CalendarFeedResponseDTO
+// @Router /user/calendar [get]
+func (h *CalendarHandler) Get(c *gin.Context) {
+
+	user, err := h.userDAO.GetByEmail(c, c.GetString("email"))
+	if err != nil {
+		utils.DefaultErrorResponse(c, 404, "User not found")
+		return
+	}
+
+	c.JSON(200, dtos.NewCalendarFeedResponseDTO(user.Calendar))
+}
+
+// @Summary Create or rotate the calendar feed
+// @Description Turn the calendar feed on with a new secret URL, to subscribe to from calendar apps without logging in. A previous URL stops working. The URL is only shown in this response
+// @Security Bearer
+// @Tags calendar
+// @Produce json
+// @Success 201 {object} dtos.CreatedCalendarFeedResponseDTO "Feed created"
+// @Failure 404 {object} utils.ErrorHandler
+// @Router /user/calendar [post]
+func (h *CalendarHandler) Rotate(c *gin.Context) {
+
+	user, err := h.userDAO.GetByEmail(c, c.GetString("email"))
+	if err != nil {
+		utils.DefaultErrorResponse(c, 404, "User not found")
+		return
+	}
+
+	token, hash, err := security.NewOpaqueToken()
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	rotated := user.Calendar.TokenHash != ""
+	now := time.Now()
+	user.Calendar = entity.UserCalendar{TokenHash: hash, CreatedAt: now}
+	user.UpdatedAt = now
+
+	if _, err := h.userDAO.Update(c, user); err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	event := userEvent(entity.AuditCalendarRotate, user)
+	if rotated {
+		event.Details = map[string]string{"rotated": "true"}
+	}
+	h.audit.Record(c, event)
+
+	c.JSON(201, dtos.CreatedCalendarFeedResponseDTO{
+		CalendarFeedResponseDTO: dtos.NewCalendarFeedResponseDTO(user.Calendar),
+		URL:                     h.publicURL + "/calendar/" + token + ".ics",
+	})
+}
+
+// @Summary Turn the calendar feed off
+// @Description Revoke the calendar feed URL; subscribed calendars stop updating
+// @Security Bearer
+// @Tags calendar
+// @Produce json
+// @Success 200
+// @Failure 404 {object} utils.ErrorHandler
+// @Router /user/calendar [delete]
+func (h *CalendarHandler) Disable(c *gin.Context) {
+
+	user, err := h.userDAO.GetByEmail(c, c.GetString("email"))
+	if err != nil {
+		utils.DefaultErrorResponse(c, 404, "User not found")
+		return
+	}
+
+	if user.Calendar.TokenHash == "" {
+		utils.DefaultErrorResponse(c, 404, "Calendar feed is not enabled")
+		return
+	}
+
+	user.Calendar = entity.UserCalendar{}
+	user.UpdatedAt = time.Now()
+
+	if _, err := h.userDAO.Update(c, user); err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	h.audit.Record(c, userEvent(entity.AuditCalendarDisable, user))
+
+	c.JSON(200, gin.H{
+		"message": "Calendar feed disabled",
+		"success": true,
+	})
+}
+
+// @Summary Calendar feed
+// @Description iCalendar (RFC 5545) feed of the scheduled todos of the user owning the secret token, the trash excluded: a VTODO per todo, due at its schedule, with STATUS:COMPLETED once done, and a VEVENT at the same time for apps showing only events. All-day todos are on a date. Times are in the time zone of the user, described by a VTIMEZONE, from a year ago to two years ahead, and in UTC outside of that range or without a time zone. Todos don't repeat, so the feed has no recurrence rules. No login needed, the token is the credential
+// @Tags calendar
+// @Produce text/calendar
+// @Param token path string true "Feed token, followed by .ics"
+// @Success 200 {file} file
+// @Failure 404 {object} utils.ErrorHandler
+// @Router /calendar/{token}.ics [get]
+func (h *CalendarHandler) Feed(c *gin.Context) {
+
+	token, ok := strings.CutSuffix(c.Param("file"), ".ics")
+	if !ok || token == "" {
+		utils.DefaultErrorResponse(c, 404, "Calendar not found")
+		return
+	}
+
+	user, err := h.userDAO.GetByCalendarToken(c, security.HashOpaqueToken(token))
+	if err != nil || user.Removed || user.Disabled {
+		utils.DefaultErrorResponse(c, 404, "Calendar not found")
+		return
+	}
+
+	c.Header("Content-Type", todoio.ContentType(todoio.FormatICS)+"; charset=utf-8")
+	c.Header("Content-Disposition", `inline; filename="todos.ics"`)
+	c.Header("Cache-Control", "private, no-cache")
+
+	encoder := todoio.NewFeedEncoder(c.Writer, "Todos", user.Location(), calendarRefresh)
+	streamTodos(c, encoder, "Error reading the calendar", func(fn func(todo *entity.Todo) error) error {
+		return h.todoDAO.ForEachScheduled(c, user.ID, fn)
+	})
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+	"todo-app-mongo/internal/config"
+	"todo-app-mongo/internal/database"
+	"todo-app-mongo/internal/dtos"
+	"todo-app-mongo/internal/entity"
+	"todo-app-mongo/internal/pkg/audit"
+	"todo-app-mongo/internal/pkg/mailer"
+	"todo-app-mongo/internal/pkg/security"
+	"todo-app-mongo/internal/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type EmailHandler struct {
+	userDAO      database.UserDAOInterface
+	userTokenDAO database.UserTokenDAOInterface
+	userJWT      security.UserJWTInterface
+	loginGuard   *security.LoginGuard
+	mailer       mailer.Mailer
+	hasher       security.PasswordHasher
+	audit        *audit.Recorder
+	publicURL    string
+	cfg          config.Email
+}
+
+func NewEmailHandler(userDAO database.UserDAOInterface, userTokenDAO database.UserTokenDAOInterface, userJWT security.UserJWTInterface, loginGuard *security.LoginGuard, mailer mailer.Mailer, hasher security.PasswordHasher, audit *audit.Recorder, publicURL string, cfg config.Email) *EmailHandler {
+	return &EmailHandler{userDAO: userDAO, userTokenDAO: userTokenDAO, userJWT: userJWT, loginGuard: loginGuard, mailer: mailer, hasher: hasher, audit: audit, publicURL: publicURL, cfg: cfg}
+}
+
+// @Summary Change email
+// @Description Request a new email address for the logged user. The change is applied once the link sent to the new address is opened. Wrong passwords count towards the account lockout
+// @Security Bearer
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param body body dtos.ChangeEmailDTO true "New email and current password"
+// @Success 202
+// @Failure 400 {object} utils.ErrorHandler
+// @Failure 409 {object} utils.ErrorHandler
+// @Failure 429 {object} utils.ErrorHandler "Too many failed attempts"
+// @Router /user/email [put]
+func (e *EmailHandler) Change(c *gin.Context) {
+
+	var dto dtos.ChangeEmailDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		utils.DefaultErrorResponse(c, 400, "Invalid request body")
+		return
+	}
+
+	if err := dto.Validate(); err != nil {
+		utils.DefaultErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	user, err := e.userDAO.GetByEmail(c, c.GetString("email"))
+	if err != nil {
+		utils.DefaultErrorResponse(c, 404, "User not found")
+		return
+	}
+
+	if !checkPassword(c, e.loginGuard, e.userDAO, e.hasher, e.audit, entity.AuditEmailChange, user, dto.CurrentPassword) {
+		return
+	}
+
+	if dto.Email == user.Email {
+		utils.DefaultErrorResponse(c, 400, "New email is the same as the current one")
+		return
+	}
+
+	if _, err := e.userDAO.GetByEmail(c, dto.Email); err == nil {
+		utils.DefaultErrorResponse(c, 409, "Email already in use")
+		return
+	}
+
+	token, err := issueUserToken(c, e.userTokenDAO, user, entity.TokenPurposeEmailChange, dto.Email, e.cfg.ChangeTokenTTL)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	link, err := withToken(e.publicURL+"/user/email/confirm", token)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	err = e.mailer.Send(c, mailer.Message{
+		To:      dto.Email,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen the link below to use this address for your account. It expires in %s.\n\n%s",
+			user.Name, e.cfg.ChangeTokenTTL, link),
+	})
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Could not send the confirmation email")
+		return
+	}
+
+	err = e.mailer.Send(c, mailer.Message{
+		To:      user.Email,
+		Subject: "Email change requested",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to move your account to %s. "+
+			"If this wasn't you, change your password right away.", user.Name, dto.Email),
+	})
+	if err != nil {
+		log.Printf("sending email change notice: %v", err)
+	}
+
+	c.JSON(202, gin.H{
+		"message": "Check the new address to confirm the change",
+		"success": true,
+	})
+}
+
+// @Summary Confirm email change
+// @Description Apply a pending email change with the token sent to the new address. Existing sessions are revoked
+// @Tags user
+// @Produce json
+// @Param token query string true "Confirmation token"
+// @Success 200
+// @Failure 400 {object} utils.ErrorHandler
+// @Failure 409 {object} utils.ErrorHandler
+// @Router /user/email/confirm [get]
+func (e *EmailHandler) ConfirmChange(c *gin.Context) {
+
+	tokenString := c.Query("token")
+	if tokenString == "" {
+		utils.DefaultErrorResponse(c, 400, "Invalid request")
+		return
+	}
+
+	token, err := e.userTokenDAO.Consume(c, entity.TokenPurposeEmailChange, security.HashOpaqueToken(tokenString))
+	if err != nil {
+		utils.DefaultErrorResponse(c, 400, "Invalid or expired token")
+		return
+	}
+
+	user, err := e.userDAO.GetById(c, token.UserID.Hex())
+	if err != nil || user.Removed {
+		utils.DefaultErrorResponse(c, 400, "Invalid or expired token")
+		return
+	}
+
+	if other, err := e.userDAO.GetByEmail(c, token.Email); err == nil && other.ID != user.ID {
+		utils.DefaultErrorResponse(c, 409, "Email already in use")
+		return
+	}
+
+	// the link was opened from the new mailbox, which proves ownership
+	now := time.Now()
+	before := profile(user)
+	previousEmail := user.Email
+	user.Email = token.Email
+	user.EmailVerified = true
+	user.VerifiedAt = now
+	user.UpdatedAt = now
+
+	if _, err := e.userDAO.Update(c, user); err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	// tokens carry the email, revoke the old one so it can't be reused if
+	// the address is registered again; accounts refuse tokens older than
+	// themselves anyway
+	e.userJWT.RevokeAll(previousEmail)
+	if err := revokeTokens(c, e.userDAO, e.userJWT, user); err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	event := userEvent(entity.AuditEmailChange, user)
+	event.Changes = audit.Diff(before, profile(user))
+	e.audit.Record(c, event)
+
+	c.JSON(200, gin.H{
+		"message": "Email changed, please log in again",
+		"success": true,
+	})
+}
+
+// @Summary Verify email
+// @Description Mark the account email as verified with the token sent on signup
+// @Tags user
+// @Produce json
+// @Param token query string true "Verification token"
+// @Success 200
+// @Failure 400 {object} utils.ErrorHandler
+// @Router /user/verify [get]
+func (e *EmailHandler) Verify(c *gin.Context) {
+
+	tokenString := c.Query("token")
+	if tokenString == "" {
+		utils.DefaultErrorResponse(c, 400, "Invalid request")
+		return
+	}
+
+	token, err := e.userTokenDAO.Consume(c, entity.TokenPurposeVerification, security.HashOpaqueToken(tokenString))
+	if err != nil {
+		utils.DefaultErrorResponse(c, 400, "Invalid or expired token")
+		return
+	}
+
+	user, err := e.userDAO.GetById(c, token.UserID.Hex())
+	if err != nil || user.Removed || user.Email != token.Email {
+		utils.DefaultErrorResponse(c, 400, "Invalid or expired token")
+		return
+	}
+
+	if !user.EmailVerified {
+		now := time.Now()
+		user.EmailVerified = true
+		user.VerifiedAt = now
+		user.UpdatedAt = now
+
+		if _, err := e.userDAO.Update(c, user); err != nil {
+			utils.DefaultErrorResponse(c, 500, "Internal server error")
+			return
+		}
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Email verified",
+		"success": true,
+	})
+}
+
+// @Summary Resend verification email
+// @Description Send a new verification link. The answer is the same whether the email is registered or not, and emails are throttled per account
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param body body dtos.ResendVerificationDTO true "Account email"
+// @Success 202
+// @Failure 400 {object} utils.ErrorHandler
+// @Router /user/verify/resend [post]
+func (e *EmailHandler) Resend(c *gin.Context) {
+
+	var dto dtos.ResendVerificationDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		utils.DefaultErrorResponse(c, 400, "Invalid request body")
+		return
+	}
+
+	user, err := e.userDAO.GetByEmail(c, dto.Email)
+	if err == nil && !user.Removed && !user.EmailVerified {
+		go e.resendVerification(user)
+	}
+
+	c.JSON(202, gin.H{
+		"message": "If the email is registered and not verified yet you will receive a new link",
+		"success": true,
+	})
+}
+
+// RefusesLogin reports whether the verification policy keeps the user from
+// logging in.
+func (e *EmailHandler) RefusesLogin(user *entity.User) bool {
+	return e.cfg.VerificationPolicy == config.VerificationPolicyLoginRefused && !user.EmailVerified
+}
+
+// SendVerification emails a new verification link to the user.
+func (e *EmailHandler) SendVerification(ctx context.Context, user *entity.User) error {
+
+	token, err := issueUserToken(ctx, e.userTokenDAO, user, entity.TokenPurposeVerification, user.Email, e.cfg.VerificationTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	link, err := withToken(e.publicURL+"/user/verify", token)
+	if err != nil {
+		return err
+	}
+
+	return e.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen the link below to confirm this is your email address. It expires in %s.\n\n%s",
+			user.Name, e.cfg.VerificationTokenTTL, link),
+	})
+}
+
+// resendVerification sends a new link unless one was sent less than
+// VerificationResendInterval ago.
+func (e *EmailHandler) resendVerification(user *entity.User) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	latest, err := e.userTokenDAO.LatestByUser(ctx, user.ID, entity.TokenPurposeVerification)
+	if err == nil && time.Since(latest.CreatedAt) < e.cfg.VerificationResendInterval {
+		return
+	}
+
+	if err := e.SendVerification(ctx, user); err != nil {
+		log.Printf("sending verification email: %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"todo-app-mongo/internal/pkg/security"
+	"todo-app-mongo/internal/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// validationErrorResponse answers 400 with the error message, listing each
+// broken rule when a password was refused by the policy.
+func validationErrorResponse(c *gin.Context, err error) {
+
+	var policyErr *security.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		utils.DefaultErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	details := make([]utils.ErrorDetail, len(policyErr.Violations))
+	for i, v := range policyErr.Violations {
+		details[i] = utils.ErrorDetail{Field: "password", Rule: v.Rule, Message: v.Message}
+	}
+
+	utils.DetailedErrorResponse(c, 400, "Password does not meet the requirements", details)
+}
+
+// invalidTodoMessage describes the first rule a todo DTO breaks.
+func invalidTodoMessage(err error) string {
+
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) || len(fieldErrs) == 0 {
+		return "Invalid todo"
+	}
+
+	fieldErr := fieldErrs[0]
+	field := strings.ToLower(fieldErr.Field())
+	switch {
+	case fieldErr.Tag() == "required":
+		return "Todo " + field + " is required"
+	case fieldErr.Tag() == "max" && fieldErr.Kind() == reflect.Slice:
+		return "Todo " + field + " has more than " + fieldErr.Param() + " items"
+	case fieldErr.Tag() == "max":
+		return "Todo " + field + " is longer than " + fieldErr.Param() + " characters"
+	default:
+		return "Invalid todo " + field
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+	"todo-app-mongo/internal/entity"
+	"todo-app-mongo/internal/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// todoETag identifies a version of a todo. It is a strong validator: each
+// update moves the todo to a new version.
+func todoETag(todo *entity.Todo) string {
+	return `"` + todo.ID.Hex() + "-" + strconv.FormatInt(todo.Version, 10) + `"`
+}
+
+// etagMatches tells whether an If-Match or If-None-Match header lists the
+// ETag. If-Match compares strongly, so weak ETags never match it.
+func etagMatches(header string, etag string, weak bool) bool {
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ifMatch checks the If-Match precondition of a write against the current
+// todo. It answers 412 when the client edited another version.
+func ifMatch(c *gin.Context, todo *entity.Todo) bool {
+
+	header := c.GetHeader("If-Match")
+	if header == "" || etagMatches(header, todoETag(todo), false) {
+		return true
+	}
+
+	utils.DefaultErrorResponse(c, 412, "Todo was modified, reload it")
+	return false
+}
+
+// versionConflict answers a write that lost the race against another one
+// after its precondition passed: 412 when the client sent If-Match, 409
+// otherwise.
+func versionConflict(c *gin.Context) {
+	if c.GetHeader("If-Match") != "" {
+		utils.DefaultErrorResponse(c, 412, "Todo was modified, reload it")
+		return
+	}
+
+	utils.DefaultErrorResponse(c, 409, "Todo was modified concurrently, try again")
+}
@@ -2,33 +2,60 @@ package handlers
 
 import (
 	"net/http"
-	"todo-app-mongo/internal/database"
+	"todo-app-mongo/internal/pkg/health"
 
 	"github.com/gin-gonic/gin"
 )
 
 type HealthHandlerInterface interface {
 	HealthHandler(c *gin.Context)
+	LivenessHandler(c *gin.Context)
+	ReadinessHandler(c *gin.Context)
 	HelloWorldHandler(c *gin.Context)
 }
 
 type healthHandler struct {
-	db database.Service
+	registry *health.Registry
 }
 
-func NewHealthController(db database.Service) HealthHandlerInterface {
-	return &healthHandler{db: db}
+func NewHealthController(registry *health.Registry) HealthHandlerInterface {
+	return &healthHandler{registry: registry}
 }
 
 // @Summary Health check
-// @Description Check if the server is healthy
+// @Description Check if the server is healthy, same as /readyz
 // @Tags health
 // @Accept json
 // @Produce json
-// @Success 200 {object} string
+// @Success 200 {object} health.Report
+// @Failure 503 {object} health.Report
 // @Router /health [get]
 func (h *healthHandler) HealthHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, h.db.Health())
+	h.ReadinessHandler(c)
+}
+
+// @Summary Liveness probe
+// @Description Check if the process is alive
+// @Tags health
+// @Accept json
+// @Produce json
+// @Success 200 {object} health.Report
+// @Failure 503 {object} health.Report
+// @Router /livez [get]
+func (h *healthHandler) LivenessHandler(c *gin.Context) {
+	h.respond(c, h.registry.Run(c, health.Liveness))
+}
+
+// @Summary Readiness probe
+// @Description Check if the server and its dependencies can take traffic
+// @Tags health
+// @Accept json
+// @Produce json
+// @Success 200 {object} health.Report
+// @Failure 503 {object} health.Report
+// @Router /readyz [get]
+func (h *healthHandler) ReadinessHandler(c *gin.Context) {
+	h.respond(c, h.registry.Run(c, health.Readiness))
 }
 
 // @Summary HelloWorld
@@ -45,3 +72,12 @@ func (h *healthHandler) HelloWorldHandler(c *gin.Context) {
 
 	c.JSON(http.StatusOK, body)
 }
+
+func (h *healthHandler) respond(c *gin.Context, report *health.Report) {
+	if !report.Healthy() {
+		c.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
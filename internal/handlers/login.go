@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"time"
+	"todo-app-mongo/internal/database"
+	"todo-app-mongo/internal/dtos"
+	"todo-app-mongo/internal/entity"
+	"todo-app-mongo/internal/pkg/audit"
+	"todo-app-mongo/internal/pkg/security"
+	"todo-app-mongo/internal/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkPassword verifies the current password before a sensitive change.
+// Wrong passwords count towards the account lockout and the IP limit like
+// failed logins, so a stolen session can't be used to guess the password.
+// On failure the response is written, a failed action recorded and false
+// returned.
+func checkPassword(c *gin.Context, guard *security.LoginGuard, userDAO database.UserDAOInterface, hasher security.PasswordHasher, recorder *audit.Recorder, action string, user *entity.User, password string) bool {
+
+	ip := c.ClientIP()
+	if wait, blocked := guard.IPBlocked(ip); blocked {
+		recorder.Record(c, failedEvent(action, user, user.Email, "ip_blocked"))
+		retryAfter(c, wait)
+		utils.DefaultErrorResponse(c, 429, "Too many failed attempts")
+		return false
+	}
+
+	now := time.Now()
+	if user.Lockout.IsLocked(now) {
+		recorder.Record(c, failedEvent(action, user, user.Email, "locked"))
+		retryAfter(c, user.Lockout.LockedUntil.Sub(now))
+		utils.DefaultErrorResponse(c, 429, "Account temporarily locked, try again later")
+		return false
+	}
+
+	if hasher.Verify(password, user.HashedPassword) {
+		return true
+	}
+
+	guard.RecordIPFailure(ip)
+	_, delay, err := guard.FailAccount(c, userDAO, user, now)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return false
+	}
+
+	recorder.Record(c, failedEvent(action, user, user.Email, "invalid_password"))
+
+	time.Sleep(delay)
+
+	utils.DefaultErrorResponse(c, 400, "Current password is incorrect")
+	return false
+}
+
+// revokeTokens logs the user out everywhere: the JWTs issued so far stop
+// working on every replica.
+func revokeTokens(ctx context.Context, userDAO database.UserDAOInterface, userJWT security.UserJWTInterface, user *entity.User) error {
+
+	now := time.Now()
+	if err := userDAO.RevokeTokens(ctx, user.ID, now); err != nil {
+		return err
+	}
+
+	user.TokensValidAfter = now
+	userJWT.RevokeAll(user.Email)
+
+	return nil
+}
+
+// revokeAllAccess revokes the JWTs of the user and deletes its personal
+// access tokens, for when the account may have been in the wrong hands.
+func revokeAllAccess(ctx context.Context, userDAO database.UserDAOInterface, userJWT security.UserJWTInterface, accessTokenDAO database.AccessTokenDAOInterface, user *entity.User) error {
+
+	if err := revokeTokens(ctx, userDAO, userJWT, user); err != nil {
+		return err
+	}
+
+	return accessTokenDAO.DeleteByUser(ctx, user.ID)
+}
+
+// loginResponse completes a login whose first factor was checked: accounts
+// with two-factor authentication get a challenge for /user/login/mfa, the
+// others their tokens.
+func loginResponse(c *gin.Context, userJWT security.UserJWTInterface, user *entity.User) {
+
+	if user.MFA.Enabled {
+		mfaToken, err := userJWT.GenerateMFAToken(user.Email)
+		if err != nil {
+			utils.DefaultErrorResponse(c, 500, "Internal server error")
+			return
+		}
+
+		c.JSON(200, dtos.UserLoginResponseDTO{
+			MFARequired: true,
+			MFAToken:    mfaToken,
+		})
+		return
+	}
+
+	token, err := userJWT.GenerateToken(user.Email, user.EffectiveRole())
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	refreshToken, err := userJWT.GenerateRefreshToken(user.Email)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	c.JSON(200, dtos.UserLoginResponseDTO{
+		Token:        token,
+		RefreshToken: refreshToken,
+	})
+}
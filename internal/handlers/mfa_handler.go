@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"context"
+	"regexp"
+	"time"
+	"todo-app-mongo/internal/config"
+	"todo-app-mongo/internal/database"
+	"todo-app-mongo/internal/dtos"
+	"todo-app-mongo/internal/entity"
+	"todo-app-mongo/internal/pkg/audit"
+	"todo-app-mongo/internal/pkg/security"
+	"todo-app-mongo/internal/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+var totpCodeRegex = regexp.MustCompile(`^[0-9]{6}$`)
+
+type MFAHandler struct {
+	userDAO    database.UserDAOInterface
+	userJWT    security.UserJWTInterface
+	loginGuard *security.LoginGuard
+	hasher     security.PasswordHasher
+	audit      *audit.Recorder
+	cfg        config.MFA
+}
+
+func NewMFAHandler(userDAO database.UserDAOInterface, userJWT security.UserJWTInterface, loginGuard *security.LoginGuard, hasher security.PasswordHasher, audit *audit.Recorder, cfg config.MFA) *MFAHandler {
+	return &MFAHandler{userDAO: userDAO, userJWT: userJWT, loginGuard: loginGuard, hasher: hasher, audit: audit, cfg: cfg}
+}
+
+// @Summary Start TOTP enrollment
+// @Description Generate a TOTP secret for the logged user. It is only enabled once a code is confirmed with /user/mfa/totp/confirm
+// @Security Bearer
+// @Tags mfa
+// @Produce json
+// @Success 200 {object} dtos.MFASetupResponseDTO "Secret and provisioning URI"
+// @Failure 409 {object} utils.ErrorHandler
+// @Router /user/mfa/totp [post]
+func (m *MFAHandler) Setup(c *gin.Context) {
+
+	user, err := m.userDAO.GetByEmail(c, c.GetString("email"))
+	if err != nil {
+		utils.DefaultErrorResponse(c, 404, "User not found")
+		return
+	}
+
+	if user.MFA.Enabled {
+		utils.DefaultErrorResponse(c, 409, "Two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := security.NewTOTPSecret()
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	user.MFA.PendingSecret = secret
+	user.UpdatedAt = time.Now()
+
+	if err := m.userDAO.SetMFA(c, user.ID, user.MFA, user.UpdatedAt); err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	c.JSON(200, dtos.MFASetupResponseDTO{
+		Secret: secret,
+		URI:    security.TOTPURI(m.cfg.Issuer, user.Email, secret),
+	})
+}
+
+// @Summary Confirm TOTP enrollment
+// @Description Enable two-factor authentication with a code from the authenticator app. The recovery codes are only shown in this response
+// @Security Bearer
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param body body dtos.MFACodeDTO true "TOTP code"
+// @Success 200 {object} dtos.RecoveryCodesResponseDTO "Recovery codes"
+// @Failure 400 {object} utils.ErrorHandler
+// @Router /user/mfa/totp/confirm [post]
+func (m *MFAHandler) Confirm(c *gin.Context) {
+
+	var dto dtos.MFACodeDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		utils.DefaultErrorResponse(c, 400, "Invalid request body")
+		return
+	}
+
+	user, err := m.userDAO.GetByEmail(c, c.GetString("email"))
+	if err != nil {
+		utils.DefaultErrorResponse(c, 404, "User not found")
+		return
+	}
+
+	if user.MFA.Enabled {
+		utils.DefaultErrorResponse(c, 409, "Two-factor authentication is already enabled")
+		return
+	}
+	if user.MFA.PendingSecret == "" {
+		utils.DefaultErrorResponse(c, 400, "Start the two-factor setup first")
+		return
+	}
+
+	now := time.Now()
+	step, valid := security.ValidateTOTP(user.MFA.PendingSecret, dto.Code, now, m.cfg.Skew, 0)
+	if valid {
+		valid, err = m.userDAO.UseTOTPStep(c, user.ID, step)
+		if err != nil {
+			utils.DefaultErrorResponse(c, 500, "Internal server error")
+			return
+		}
+	}
+	if !valid {
+		utils.DefaultErrorResponse(c, 400, "Invalid code")
+		return
+	}
+
+	codes, hashes, err := security.NewRecoveryCodes(m.cfg.RecoveryCodes)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	user.MFA = entity.UserMFA{
+		Enabled:       true,
+		Secret:        user.MFA.PendingSecret,
+		LastStep:      step,
+		RecoveryCodes: hashes,
+		EnabledAt:     now,
+	}
+	user.UpdatedAt = now
+
+	if err := m.userDAO.SetMFA(c, user.ID, user.MFA, now); err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	m.audit.Record(c, userEvent(entity.AuditMFAEnable, user))
+
+	c.JSON(200, dtos.RecoveryCodesResponseDTO{RecoveryCodes: codes})
+}
+
+// @Summary Disable TOTP
+// @Description Turn two-factor authentication off. Needs the password and a TOTP or recovery code. Wrong passwords count towards the account lockout
+// @Security Bearer
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param body body dtos.MFADisableDTO true "Password and code"
+// @Success 200
+// @Failure 400 {object} utils.ErrorHandler
+// @Failure 429 {object} utils.ErrorHandler "Too many failed attempts"
+// @Router /user/mfa/totp [delete]
+func (m *MFAHandler) Disable(c *gin.Context) {
+
+	var dto dtos.MFADisableDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		utils.DefaultErrorResponse(c, 400, "Invalid request body")
+		return
+	}
+
+	user, err := m.userDAO.GetByEmail(c, c.GetString("email"))
+	if err != nil {
+		utils.DefaultErrorResponse(c, 404, "User not found")
+		return
+	}
+
+	if !user.MFA.Enabled {
+		utils.DefaultErrorResponse(c, 400, "Two-factor authentication is not enabled")
+		return
+	}
+
+	if !checkPassword(c, m.loginGuard, m.userDAO, m.hasher, m.audit, entity.AuditMFADisable, user, dto.Password) {
+		return
+	}
+
+	valid, err := m.verifySecondFactor(c, user, dto.Code, time.Now())
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+	if !valid {
+		m.audit.Record(c, failedEvent(entity.AuditMFADisable, user, user.Email, "invalid_code"))
+		utils.DefaultErrorResponse(c, 400, "Invalid code")
+		return
+	}
+
+	user.MFA = entity.UserMFA{}
+	user.UpdatedAt = time.Now()
+
+	if err := m.userDAO.SetMFA(c, user.ID, user.MFA, user.UpdatedAt); err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	m.audit.Record(c, userEvent(entity.AuditMFADisable, user))
+
+	c.JSON(200, gin.H{
+		"message": "Two-factor authentication disabled",
+		"success": true,
+	})
+}
+
+// @Summary Regenerate recovery codes
+// @Description Replace every recovery code with new ones. Needs a TOTP code
+// @Security Bearer
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param body body dtos.MFACodeDTO true "TOTP code"
+// @Success 200 {object} dtos.RecoveryCodesResponseDTO "Recovery codes"
+// @Failure 400 {object} utils.ErrorHandler
+// @Router /user/mfa/recovery-codes [post]
+func (m *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+
+	var dto dtos.MFACodeDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		utils.DefaultErrorResponse(c, 400, "Invalid request body")
+		return
+	}
+
+	user, err := m.userDAO.GetByEmail(c, c.GetString("email"))
+	if err != nil {
+		utils.DefaultErrorResponse(c, 404, "User not found")
+		return
+	}
+
+	if !user.MFA.Enabled {
+		utils.DefaultErrorResponse(c, 400, "Two-factor authentication is not enabled")
+		return
+	}
+
+	now := time.Now()
+	valid, err := m.verifyTOTP(c, user, dto.Code, now)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+	if !valid {
+		utils.DefaultErrorResponse(c, 400, "Invalid code")
+		return
+	}
+
+	codes, hashes, err := security.NewRecoveryCodes(m.cfg.RecoveryCodes)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	user.MFA.RecoveryCodes = hashes
+	user.UpdatedAt = now
+
+	if err := m.userDAO.SetMFA(c, user.ID, user.MFA, now); err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	m.audit.Record(c, userEvent(entity.AuditRecoveryCodesReset, user))
+
+	c.JSON(200, dtos.RecoveryCodesResponseDTO{RecoveryCodes: codes})
+}
+
+// @Summary Login second step
+// @Description Exchange the challenge returned by /user/login and a TOTP or recovery code for the tokens. Wrong codes count towards the account lockout
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param body body dtos.MFALoginDTO true "Challenge and code"
+// @Success 200 {object} dtos.UserLoginResponseDTO "User logged in"
+// @Failure 400 {object} utils.ErrorHandler
+// @Failure 401 {object} utils.ErrorHandler
+// @Failure 429 {object} utils.ErrorHandler "Too many failed attempts"
+// @Router /user/login/mfa [post]
+func (m *MFAHandler) Login(c *gin.Context) {
+
+	var dto dtos.MFALoginDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		utils.DefaultErrorResponse(c, 400, "Invalid request body")
+		return
+	}
+
+	claims, err := m.userJWT.ValidateMFAToken(dto.MFAToken)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 401, "Invalid or expired challenge, log in again")
+		return
+	}
+
+	user, err := m.userDAO.GetByEmail(c, claims.Email)
+	if err != nil || !user.MFA.Enabled || user.Disabled || user.TokenRevoked(claims.IssuedAtMs) {
+		utils.DefaultErrorResponse(c, 401, "Invalid or expired challenge, log in again")
+		return
+	}
+
+	now := time.Now()
+
+	if user.Lockout.IsLocked(now) {
+		m.audit.Record(c, failedEvent(entity.AuditUserLoginMFA, user, user.Email, "locked"))
+		retryAfter(c, user.Lockout.LockedUntil.Sub(now))
+		utils.DefaultErrorResponse(c, 429, "Account temporarily locked, try again later")
+		return
+	}
+
+	valid, err := m.verifySecondFactor(c, user, dto.Code, now)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+	if !valid {
+		locked, delay, err := m.loginGuard.FailAccount(c, m.userDAO, user, now)
+		if err != nil {
+			utils.DefaultErrorResponse(c, 500, "Internal server error")
+			return
+		}
+
+		// a locked account has to start over from the password
+		if locked {
+			m.userJWT.LogOff(dto.MFAToken)
+		}
+
+		m.audit.Record(c, failedEvent(entity.AuditUserLoginMFA, user, user.Email, "invalid_code"))
+
+		time.Sleep(delay)
+
+		utils.DefaultErrorResponse(c, 400, "Invalid code")
+		return
+	}
+
+	// the challenge is single use
+	m.userJWT.LogOff(dto.MFAToken)
+
+	// the used code is already recorded, saving the user would bring back
+	// the recovery codes other logins used meanwhile
+	user.Lockout.Reset()
+	if err := m.userDAO.ResetLockout(c, user.ID); err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	token, err := m.userJWT.GenerateToken(user.Email, user.EffectiveRole())
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	refreshToken, err := m.userJWT.GenerateRefreshToken(user.Email)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	m.audit.Record(c, userEvent(entity.AuditUserLoginMFA, user))
+
+	c.JSON(200, dtos.UserLoginResponseDTO{
+		Token:        token,
+		RefreshToken: refreshToken,
+	})
+}
+
+// verifySecondFactor accepts a TOTP code or an unused recovery code. The
+// use is recorded on the user at once, so concurrent requests can't accept
+// the same code twice.
+func (m *MFAHandler) verifySecondFactor(ctx context.Context, user *entity.User, code string, now time.Time) (bool, error) {
+
+	if totpCodeRegex.MatchString(code) {
+		return m.verifyTOTP(ctx, user, code, now)
+	}
+
+	hash := security.HashRecoveryCode(code)
+	if !user.MFA.UseRecoveryCode(hash) {
+		return false, nil
+	}
+
+	return m.userDAO.UseRecoveryCode(ctx, user.ID, hash)
+}
+
+// verifyTOTP accepts a TOTP code of a later time step than the last one
+// accepted.
+func (m *MFAHandler) verifyTOTP(ctx context.Context, user *entity.User, code string, now time.Time) (bool, error) {
+
+	step, valid := security.ValidateTOTP(user.MFA.Secret, code, now, m.cfg.Skew, user.MFA.LastStep)
+	if !valid {
+		return false, nil
+	}
+
+	valid, err := m.userDAO.UseTOTPStep(ctx, user.ID, step)
+	if valid {
+		user.MFA.LastStep = step
+	}
+
+	return valid, err
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"todo-app-mongo/internal/config"
+	"todo-app-mongo/internal/dtos"
+	"todo-app-mongo/internal/entity"
+	"todo-app-mongo/internal/pkg/audit"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (f *fakeUserDAO) SetMFA(_ context.Context, id primitive.ObjectID, mfa entity.UserMFA, now time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, user := range f.users {
+		if user.ID == id {
+			mfa.LastStep = user.MFA.LastStep
+			user.MFA = mfa
+			user.UpdatedAt = now
+		}
+	}
+
+	return nil
+}
+
+// UseTOTPStep accepts steps after the last one, a user without one
+// accepts any.
+func (f *fakeUserDAO) UseTOTPStep(_ context.Context, id primitive.ObjectID, step int64) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, user := range f.users {
+		if user.ID == id && user.MFA.LastStep < step {
+			user.MFA.LastStep = step
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// totpCode generates the code an authenticator app shows for the secret.
+func totpCode(t *testing.T, secret string, now time.Time) string {
+	t.Helper()
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(now.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%06d", value%1_000_000)
+}
+
+// TestMFAConfirmWithoutMFADocument enrolls an account stored before two-factor
+// authentication, whose document has no mfa field.
+func TestMFAConfirmWithoutMFADocument(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	id := primitive.NewObjectID()
+	data, err := bson.Marshal(bson.M{"_id": id, "email": "jane@example.com", "email_verified": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var user entity.User
+	if err := bson.Unmarshal(data, &user); err != nil {
+		t.Fatal(err)
+	}
+
+	users := &fakeUserDAO{users: []*entity.User{&user}}
+	cfg := config.MFA{Issuer: "Todo", Skew: 1, RecoveryCodes: 4}
+	handler := NewMFAHandler(users, nil, nil, nil, audit.NewRecorder(&fakeAuditEventDAO{}, 0), cfg)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("email", "jane@example.com") })
+	router.POST("/user/mfa/totp", handler.Setup)
+	router.POST("/user/mfa/totp/confirm", handler.Confirm)
+	router.POST("/user/mfa/recovery-codes", handler.RegenerateRecoveryCodes)
+
+	post := func(target string, body any) *httptest.ResponseRecorder {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, target, bytes.NewReader(payload)))
+		return w
+	}
+
+	w := post("/user/mfa/totp", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("setup: status %d: %s", w.Code, w.Body)
+	}
+	var setup dtos.MFASetupResponseDTO
+	if err := json.Unmarshal(w.Body.Bytes(), &setup); err != nil {
+		t.Fatal(err)
+	}
+
+	code := totpCode(t, setup.Secret, time.Now())
+
+	w = post("/user/mfa/totp/confirm", dtos.MFACodeDTO{Code: code})
+	if w.Code != http.StatusOK {
+		t.Fatalf("confirm: status %d: %s", w.Code, w.Body)
+	}
+	var recovery dtos.RecoveryCodesResponseDTO
+	if err := json.Unmarshal(w.Body.Bytes(), &recovery); err != nil {
+		t.Fatal(err)
+	}
+	if len(recovery.RecoveryCodes) != cfg.RecoveryCodes {
+		t.Fatalf("got %d recovery codes", len(recovery.RecoveryCodes))
+	}
+
+	stored, err := users.GetByEmail(context.Background(), "jane@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.MFA.Enabled || stored.MFA.Secret != setup.Secret || stored.MFA.PendingSecret != "" || stored.MFA.LastStep == 0 {
+		t.Fatalf("mfa %+v", stored.MFA)
+	}
+
+	// the confirmed code can't be used again
+	if w := post("/user/mfa/recovery-codes", dtos.MFACodeDTO{Code: code}); w.Code != http.StatusBadRequest {
+		t.Fatalf("replay: status %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"log"
+	"strings"
+	"time"
+	"todo-app-mongo/internal/database"
+	"todo-app-mongo/internal/dtos"
+	"todo-app-mongo/internal/entity"
+	"todo-app-mongo/internal/pkg/audit"
+	"todo-app-mongo/internal/pkg/security"
+	"todo-app-mongo/internal/pkg/sso"
+	"todo-app-mongo/internal/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type OIDCHandler struct {
+	userDAO      database.UserDAOInterface
+	stateDAO     database.OIDCStateDAOInterface
+	accessTokens database.AccessTokenDAOInterface
+	userJWT      security.UserJWTInterface
+	providers    *sso.Providers
+	audit        *audit.Recorder
+	stateTTL     time.Duration
+}
+
+func NewOIDCHandler(userDAO database.UserDAOInterface, stateDAO database.OIDCStateDAOInterface, accessTokens database.AccessTokenDAOInterface, userJWT security.UserJWTInterface, providers *sso.Providers, audit *audit.Recorder, stateTTL time.Duration) *OIDCHandler {
+	return &OIDCHandler{userDAO: userDAO, stateDAO: stateDAO, accessTokens: accessTokens, userJWT: userJWT, providers: providers, audit: audit, stateTTL: stateTTL}
+}
+
+// @Summary List identity providers
+// @Description Names of the OpenID Connect providers users can log in with
+// @Tags auth
+// @Produce json
+// @Success 200 {object} dtos.OIDCProvidersResponseDTO
+// @Router /auth/oidc [get]
+func (o *OIDCHandler) Providers(c *gin.Context) {
+	c.JSON(200, dtos.OIDCProvidersResponseDTO{Providers: o.providers.Names()})
+}
+
+// @Summary Log in with an identity provider
+// @Description Redirect to the provider to log in with the authorization code flow and PKCE
+// @Tags auth
+// @Param provider path string true "Provider name"
+// @Success 302
+// @Failure 404 {object} utils.ErrorHandler
+// @Failure 502 {object} utils.ErrorHandler
+// @Router /auth/oidc/{provider} [get]
+func (o *OIDCHandler) Login(c *gin.Context) {
+
+	provider, err := o.providers.Get(c.Param("provider"))
+	if err != nil {
+		utils.DefaultErrorResponse(c, 404, "Unknown identity provider")
+		return
+	}
+
+	state, stateHash, err := security.NewOpaqueToken()
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+	nonce, _, err := security.NewOpaqueToken()
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+	// 43 URL-safe characters, a valid PKCE verifier
+	codeVerifier, _, err := security.NewOpaqueToken()
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	authURL, err := provider.AuthURL(c, state, nonce, codeVerifier)
+	if err != nil {
+		log.Printf("oidc login: %v", err)
+		utils.DefaultErrorResponse(c, 502, "Identity provider unavailable")
+		return
+	}
+
+	now := time.Now()
+	err = o.stateDAO.Create(c, &entity.OIDCState{
+		ID:           primitive.NewObjectID(),
+		StateHash:    stateHash,
+		Provider:     c.Param("provider"),
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    now.Add(o.stateTTL),
+		CreatedAt:    now,
+	})
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	c.Redirect(302, authURL)
+}
+
+// @Summary Identity provider callback
+// @Description Where the provider redirects after the login. The account is found by its link to the provider, linked by verified email or created, and the tokens are returned like /user/login
+// @Tags auth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param code query string true "Authorization code"
+// @Param state query string true "State"
+// @Success 200 {object} dtos.UserLoginResponseDTO "User logged in"
+// @Failure 400 {object} utils.ErrorHandler
+// @Failure 401 {object} utils.ErrorHandler
+// @Failure 403 {object} utils.ErrorHandler
+// @Router /auth/oidc/{provider}/callback [get]
+func (o *OIDCHandler) Callback(c *gin.Context) {
+
+	provider, err := o.providers.Get(c.Param("provider"))
+	if err != nil {
+		utils.DefaultErrorResponse(c, 404, "Unknown identity provider")
+		return
+	}
+
+	// the error comes from the query string, anyone can make it up, so it
+	// is only logged
+	if providerErr := c.Query("error"); providerErr != "" {
+		log.Printf("oidc callback: %s answered %q", c.Param("provider"), providerErr)
+		utils.DefaultErrorResponse(c, 400, "Login refused by the identity provider")
+		return
+	}
+
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		utils.DefaultErrorResponse(c, 400, "Invalid request")
+		return
+	}
+
+	loginState, err := o.stateDAO.Consume(c, c.Param("provider"), security.HashOpaqueToken(state))
+	if err != nil {
+		utils.DefaultErrorResponse(c, 400, "Invalid or expired login, start again")
+		return
+	}
+
+	identity, err := provider.Exchange(c, code, loginState.Nonce, loginState.CodeVerifier)
+	if err != nil {
+		log.Printf("oidc callback: %v", err)
+		event := failedEvent(entity.AuditUserLogin, nil, "", "identity_not_verified")
+		event.Details["provider"] = c.Param("provider")
+		o.audit.Record(c, event)
+		utils.DefaultErrorResponse(c, 401, "Could not verify the login with the identity provider")
+		return
+	}
+
+	user, status, message := o.findOrLinkUser(c, identity)
+	if user == nil {
+		event := failedEvent(entity.AuditUserLogin, nil, identity.Email, "account_refused")
+		event.Details["provider"] = identity.Provider
+		event.Details["message"] = message
+		o.audit.Record(c, event)
+		utils.DefaultErrorResponse(c, status, message)
+		return
+	}
+
+	event := userEvent(entity.AuditUserLogin, user)
+	event.Details = map[string]string{"method": "oidc", "provider": identity.Provider}
+	if user.MFA.Enabled {
+		event.Details["mfa"] = "required"
+	}
+	o.audit.Record(c, event)
+
+	loginResponse(c, o.userJWT, user)
+}
+
+// findOrLinkUser returns the user linked to the identity. Otherwise an
+// account with the same email is linked, or a new one created, provided the
+// provider verified the email. On failure the user is nil and the status
+// and message describe why.
+func (o *OIDCHandler) findOrLinkUser(c *gin.Context, identity *sso.Identity) (*entity.User, int, string) {
+
+	user, err := o.userDAO.GetByIdentity(c, identity.Provider, identity.Subject)
+	if err == nil {
+		if user.Removed {
+			return nil, 403, "Account removed"
+		}
+		if user.Disabled {
+			return nil, 403, "Account disabled"
+		}
+		return user, 0, ""
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, 500, "Internal server error"
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, 403, "The identity provider did not share a verified email address"
+	}
+
+	now := time.Now()
+	link := entity.UserIdentity{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+		LinkedAt: now,
+	}
+
+	user, err = o.userDAO.GetByEmail(c, identity.Email)
+	if err == nil {
+		if user.Removed {
+			return nil, 403, "Account removed"
+		}
+		if user.Disabled {
+			return nil, 403, "Account disabled"
+		}
+
+		before := profile(user)
+
+		if !user.EmailVerified {
+			// whoever signed up with this email never proved owning it, so
+			// their password, sessions and access tokens go and the
+			// provider's user takes over the account
+			user.HashedPassword = ""
+			user.EmailVerified = true
+			user.VerifiedAt = now
+			user.UpdatedAt = now
+
+			if err := o.userDAO.SetPassword(c, user.ID, "", now); err != nil {
+				return nil, 500, "Internal server error"
+			}
+			if _, err := o.userDAO.Update(c, user); err != nil {
+				return nil, 500, "Internal server error"
+			}
+			if err := revokeAllAccess(c, o.userDAO, o.userJWT, o.accessTokens, user); err != nil {
+				return nil, 500, "Internal server error"
+			}
+		}
+
+		// a concurrent login may have linked it already, which is fine
+		if _, err := o.userDAO.LinkIdentity(c, user.ID, link); err != nil {
+			return nil, 500, "Internal server error"
+		}
+		user.Identities = append(user.Identities, link)
+
+		event := userEvent(entity.AuditUserUpdate, user)
+		event.Changes = audit.Diff(before, profile(user))
+		event.Details = map[string]string{"linked_provider": identity.Provider}
+		o.audit.Record(c, event)
+
+		return user, 0, ""
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, 500, "Internal server error"
+	}
+
+	name := identity.Name
+	if name == "" {
+		name, _, _ = strings.Cut(identity.Email, "@")
+	}
+
+	// no password: the account logs in through the provider until one is
+	// set with the password reset
+	user, err = o.userDAO.Create(c, &entity.User{
+		ID:            primitive.NewObjectID(),
+		Name:          name,
+		Email:         identity.Email,
+		EmailVerified: true,
+		VerifiedAt:    now,
+		Identities:    []entity.UserIdentity{link},
+		Role:          entity.RoleUser,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	})
+	if err != nil {
+		return nil, 500, "Internal server error"
+	}
+
+	event := userEvent(entity.AuditUserCreate, user)
+	event.Changes = audit.Diff(nil, profile(user))
+	event.Details = map[string]string{"provider": identity.Provider}
+	o.audit.Record(c, event)
+
+	return user, 0, ""
+}
@@ -0,0 +1,418 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"todo-app-mongo/internal/config"
+	"todo-app-mongo/internal/database"
+	"todo-app-mongo/internal/dtos"
+	"todo-app-mongo/internal/entity"
+	"todo-app-mongo/internal/pkg/audit"
+	"todo-app-mongo/internal/pkg/security"
+	"todo-app-mongo/internal/pkg/sso"
+	"todo-app-mongo/internal/pkg/sso/ssotest"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// fakeUserDAO keeps users in memory. The methods the OIDC handler doesn't
+// use panic through the nil embedded interface.
+type fakeUserDAO struct {
+	database.UserDAOInterface
+
+	mu    sync.Mutex
+	users []*entity.User
+}
+
+func (f *fakeUserDAO) find(match func(user *entity.User) bool) (*entity.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, user := range f.users {
+		if match(user) {
+			clone := *user
+			clone.Identities = append([]entity.UserIdentity{}, user.Identities...)
+			return &clone, nil
+		}
+	}
+
+	return nil, mongo.ErrNoDocuments
+}
+
+func (f *fakeUserDAO) Create(_ context.Context, user *entity.User) (*entity.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	clone := *user
+	f.users = append(f.users, &clone)
+	return user, nil
+}
+
+// Update leaves the fields changed atomically alone, like the real one.
+func (f *fakeUserDAO) Update(_ context.Context, user *entity.User) (*entity.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, stored := range f.users {
+		if stored.ID == user.ID {
+			clone := *user
+			clone.HashedPassword = stored.HashedPassword
+			clone.MFA = stored.MFA
+			clone.Role = stored.Role
+			clone.Disabled = stored.Disabled
+			clone.DisabledAt = stored.DisabledAt
+			clone.DisabledReason = stored.DisabledReason
+			clone.Identities = stored.Identities
+			clone.TokensValidAfter = stored.TokensValidAfter
+			clone.Lockout = stored.Lockout
+			f.users[i] = &clone
+		}
+	}
+
+	return user, nil
+}
+
+func (f *fakeUserDAO) SetPassword(_ context.Context, id primitive.ObjectID, hashedPassword string, now time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, user := range f.users {
+		if user.ID == id {
+			user.HashedPassword = hashedPassword
+			user.UpdatedAt = now
+		}
+	}
+
+	return nil
+}
+
+func (f *fakeUserDAO) GetByEmail(_ context.Context, email string) (*entity.User, error) {
+	return f.find(func(user *entity.User) bool { return user.Email == email })
+}
+
+func (f *fakeUserDAO) GetByIdentity(_ context.Context, provider string, subject string) (*entity.User, error) {
+	return f.find(func(user *entity.User) bool {
+		for _, identity := range user.Identities {
+			if identity.Provider == provider && identity.Subject == subject {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (f *fakeUserDAO) LinkIdentity(_ context.Context, id primitive.ObjectID, link entity.UserIdentity) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, user := range f.users {
+		if user.ID != id {
+			continue
+		}
+		for _, identity := range user.Identities {
+			if identity.Provider == link.Provider && identity.Subject == link.Subject {
+				return false, nil
+			}
+		}
+		user.Identities = append(user.Identities, link)
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (f *fakeUserDAO) RevokeTokens(_ context.Context, id primitive.ObjectID, at time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, user := range f.users {
+		if user.ID == id && at.After(user.TokensValidAfter) {
+			user.TokensValidAfter = at
+		}
+	}
+
+	return nil
+}
+
+type fakeOIDCStateDAO struct {
+	mu     sync.Mutex
+	states map[string]*entity.OIDCState
+}
+
+func (f *fakeOIDCStateDAO) Create(_ context.Context, state *entity.OIDCState) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.states[state.StateHash] = state
+	return nil
+}
+
+func (f *fakeOIDCStateDAO) Consume(_ context.Context, provider string, stateHash string) (*entity.OIDCState, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	state, found := f.states[stateHash]
+	if !found || state.Provider != provider || !state.ExpiresAt.After(time.Now()) {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	delete(f.states, stateHash)
+	return state, nil
+}
+
+type fakeAccessTokenDAO struct {
+	database.AccessTokenDAOInterface
+
+	deletedFor []primitive.ObjectID
+}
+
+func (f *fakeAccessTokenDAO) DeleteByUser(_ context.Context, userID primitive.ObjectID) error {
+	f.deletedFor = append(f.deletedFor, userID)
+	return nil
+}
+
+type fakeAuditEventDAO struct {
+	database.AuditEventDAOInterface
+
+	mu     sync.Mutex
+	events []*entity.AuditEvent
+}
+
+func (f *fakeAuditEventDAO) Create(_ context.Context, event *entity.AuditEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.events = append(f.events, event)
+	return nil
+}
+
+type oidcTest struct {
+	router       *gin.Engine
+	idp          *ssotest.Provider
+	users        *fakeUserDAO
+	accessTokens *fakeAccessTokenDAO
+	events       *fakeAuditEventDAO
+}
+
+func newOIDCTest(t *testing.T, users ...*entity.User) *oidcTest {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	idp, err := ssotest.NewProvider("client", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(idp.Close)
+
+	providers := sso.New(config.OIDC{Providers: []config.OIDCProvider{{
+		Name:         "stub",
+		Issuer:       idp.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Scopes:       []string{"openid", "email"},
+	}}}, "https://todo.example.com")
+
+	test := &oidcTest{
+		router:       gin.New(),
+		idp:          idp,
+		users:        &fakeUserDAO{users: users},
+		accessTokens: &fakeAccessTokenDAO{},
+		events:       &fakeAuditEventDAO{},
+	}
+
+	userJWT := security.NewUserJWT(config.JWT{
+		SecretKey:        "secret",
+		RefreshKey:       "refresh",
+		TokenLifetime:    time.Hour,
+		RefreshLifetime:  time.Hour,
+		MFATokenLifetime: time.Minute,
+	})
+	states := &fakeOIDCStateDAO{states: map[string]*entity.OIDCState{}}
+	handler := NewOIDCHandler(test.users, states, test.accessTokens, userJWT, providers, audit.NewRecorder(test.events, 0), time.Minute)
+
+	test.router.GET("/auth/oidc/:provider", handler.Login)
+	test.router.GET("/auth/oidc/:provider/callback", handler.Callback)
+
+	return test
+}
+
+func (o *oidcTest) get(target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	o.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w
+}
+
+// authorize starts a login and approves it at the provider, returning the
+// callback query.
+func (o *oidcTest) authorize(t *testing.T, claims map[string]any) url.Values {
+	t.Helper()
+
+	w := o.get("/auth/oidc/stub")
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body)
+	}
+
+	callback, err := o.idp.Authorize(w.Header().Get("Location"), claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return callback
+}
+
+func (o *oidcTest) login(t *testing.T, claims map[string]any) *httptest.ResponseRecorder {
+	t.Helper()
+	return o.get("/auth/oidc/stub/callback?" + o.authorize(t, claims).Encode())
+}
+
+func janeClaims(verified bool) map[string]any {
+	return map[string]any{"sub": "42", "email": "jane@example.com", "email_verified": verified, "name": "Jane"}
+}
+
+func assertLoggedIn(t *testing.T, w *httptest.ResponseRecorder) {
+	t.Helper()
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("callback: status %d: %s", w.Code, w.Body)
+	}
+
+	var response dtos.UserLoginResponseDTO
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Token == "" || response.RefreshToken == "" {
+		t.Fatalf("no tokens in %s", w.Body)
+	}
+}
+
+func TestOIDCLoginCreatesUser(t *testing.T) {
+	test := newOIDCTest(t)
+
+	assertLoggedIn(t, test.login(t, janeClaims(true)))
+
+	user, err := test.users.GetByEmail(context.Background(), "jane@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.EmailVerified || user.HashedPassword != "" || user.Name != "Jane" || user.Role != entity.RoleUser {
+		t.Fatalf("created user %+v", user)
+	}
+	if len(user.Identities) != 1 || user.Identities[0].Provider != "stub" || user.Identities[0].Subject != "42" {
+		t.Fatalf("identities %+v", user.Identities)
+	}
+
+	// the next login finds the user by the identity, even with another email
+	claims := janeClaims(true)
+	claims["email"] = "jane@new.example.com"
+	assertLoggedIn(t, test.login(t, claims))
+
+	if len(test.users.users) != 1 {
+		t.Fatalf("%d users, want 1", len(test.users.users))
+	}
+}
+
+func TestOIDCLoginRefusesUnverifiedEmail(t *testing.T) {
+	test := newOIDCTest(t, &entity.User{ID: primitive.NewObjectID(), Email: "jane@example.com", EmailVerified: true})
+
+	w := test.login(t, janeClaims(false))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want 403", w.Code)
+	}
+
+	user, _ := test.users.GetByEmail(context.Background(), "jane@example.com")
+	if len(user.Identities) != 0 {
+		t.Fatal("identity linked from an unverified email")
+	}
+}
+
+func TestOIDCLoginLinksVerifiedAccount(t *testing.T) {
+	existing := &entity.User{ID: primitive.NewObjectID(), Email: "jane@example.com", EmailVerified: true, HashedPassword: "hash"}
+	test := newOIDCTest(t, existing)
+
+	assertLoggedIn(t, test.login(t, janeClaims(true)))
+
+	user, _ := test.users.GetByEmail(context.Background(), "jane@example.com")
+	if len(user.Identities) != 1 {
+		t.Fatalf("identities %+v", user.Identities)
+	}
+	if user.HashedPassword != "hash" || !user.TokensValidAfter.IsZero() || len(test.accessTokens.deletedFor) != 0 {
+		t.Fatal("the owner of a verified account lost their password or sessions")
+	}
+}
+
+func TestOIDCLoginTakesOverUnverifiedAccount(t *testing.T) {
+	existing := &entity.User{ID: primitive.NewObjectID(), Email: "jane@example.com", HashedPassword: "hash"}
+	test := newOIDCTest(t, existing)
+
+	before := time.Now()
+	assertLoggedIn(t, test.login(t, janeClaims(true)))
+
+	user, _ := test.users.GetByEmail(context.Background(), "jane@example.com")
+	if user.HashedPassword != "" || !user.EmailVerified || len(user.Identities) != 1 {
+		t.Fatalf("account not taken over: %+v", user)
+	}
+	if user.TokensValidAfter.Before(before) {
+		t.Fatal("sessions of the previous owner not revoked")
+	}
+	if len(test.accessTokens.deletedFor) != 1 || test.accessTokens.deletedFor[0] != existing.ID {
+		t.Fatal("access tokens of the previous owner not deleted")
+	}
+}
+
+func TestOIDCLoginRefusesDisabledAccount(t *testing.T) {
+	existing := &entity.User{ID: primitive.NewObjectID(), Email: "jane@example.com", EmailVerified: true, Disabled: true}
+	test := newOIDCTest(t, existing)
+
+	if w := test.login(t, janeClaims(true)); w.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want 403", w.Code)
+	}
+}
+
+func TestOIDCCallbackState(t *testing.T) {
+	test := newOIDCTest(t)
+
+	callback := test.authorize(t, janeClaims(true))
+
+	forged := url.Values{"code": {callback.Get("code")}, "state": {"forged"}}
+	if w := test.get("/auth/oidc/stub/callback?" + forged.Encode()); w.Code != http.StatusBadRequest {
+		t.Fatalf("forged state: status %d, want 400", w.Code)
+	}
+
+	assertLoggedIn(t, test.get("/auth/oidc/stub/callback?"+callback.Encode()))
+
+	if w := test.get("/auth/oidc/stub/callback?" + callback.Encode()); w.Code != http.StatusBadRequest {
+		t.Fatalf("replayed state: status %d, want 400", w.Code)
+	}
+}
+
+func TestOIDCCallbackProviderError(t *testing.T) {
+	test := newOIDCTest(t)
+
+	w := test.get("/auth/oidc/stub/callback?error=" + url.QueryEscape("<script>alert(1)</script>"))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "script") {
+		t.Fatalf("provider error echoed: %s", w.Body)
+	}
+}
+
+func TestOIDCUnknownProvider(t *testing.T) {
+	test := newOIDCTest(t)
+
+	if w := test.get("/auth/oidc/other"); w.Code != http.StatusNotFound {
+		t.Fatalf("login: status %d, want 404", w.Code)
+	}
+	if w := test.get("/auth/oidc/other/callback?code=code&state=state"); w.Code != http.StatusNotFound {
+		t.Fatalf("callback: status %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+	"todo-app-mongo/internal/config"
+	"todo-app-mongo/internal/database"
+	"todo-app-mongo/internal/dtos"
+	"todo-app-mongo/internal/entity"
+	"todo-app-mongo/internal/pkg/audit"
+	"todo-app-mongo/internal/pkg/mailer"
+	"todo-app-mongo/internal/pkg/security"
+	"todo-app-mongo/internal/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PasswordHandler struct {
+	userDAO      database.UserDAOInterface
+	userTokenDAO database.UserTokenDAOInterface
+	userJWT      security.UserJWTInterface
+	accessTokens database.AccessTokenDAOInterface
+	loginGuard   *security.LoginGuard
+	mailer       mailer.Mailer
+	policy       *security.PasswordPolicy
+	hasher       security.PasswordHasher
+	audit        *audit.Recorder
+	cfg          config.Password
+}
+
+func NewPasswordHandler(userDAO database.UserDAOInterface, userTokenDAO database.UserTokenDAOInterface, userJWT security.UserJWTInterface, accessTokens database.AccessTokenDAOInterface, loginGuard *security.LoginGuard, mailer mailer.Mailer, policy *security.PasswordPolicy, hasher security.PasswordHasher, audit *audit.Recorder, cfg config.Password) *PasswordHandler {
+	return &PasswordHandler{userDAO: userDAO, userTokenDAO: userTokenDAO, userJWT: userJWT, accessTokens: accessTokens, loginGuard: loginGuard, mailer: mailer, policy: policy, hasher: hasher, audit: audit, cfg: cfg}
+}
+
+// @Summary Forgot password
+// @Description Email a single-use link to reset the password. The answer is the same whether the email is registered or not
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param body body dtos.ForgotPasswordDTO true "Account email"
+// @Success 202
+// @Failure 400 {object} utils.ErrorHandler
+// @Router /user/password/forgot [post]
+func (p *PasswordHandler) Forgot(c *gin.Context) {
+
+	var dto dtos.ForgotPasswordDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		utils.DefaultErrorResponse(c, 400, "Invalid request body")
+		return
+	}
+
+	user, err := p.userDAO.GetByEmail(c, dto.Email)
+	if err == nil && !user.Removed {
+		// sent in the background so the response time doesn't tell
+		// registered emails apart
+		go p.sendResetToken(user)
+	}
+
+	c.JSON(202, gin.H{
+		"message": "If the email is registered you will receive a link to reset your password",
+		"success": true,
+	})
+}
+
+// @Summary Reset password
+// @Description Set a new password with a token from the reset email. Every existing session and personal access token is revoked
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param body body dtos.ResetPasswordDTO true "Reset token and new password"
+// @Success 200
+// @Failure 400 {object} utils.ErrorHandler
+// @Router /user/password/reset [post]
+func (p *PasswordHandler) Reset(c *gin.Context) {
+
+	var dto dtos.ResetPasswordDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		utils.DefaultErrorResponse(c, 400, "Invalid request body")
+		return
+	}
+
+	tokenHash := security.HashOpaqueToken(dto.Token)
+
+	token, err := p.userTokenDAO.GetValid(c, entity.TokenPurposePasswordReset, tokenHash)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 400, "Invalid or expired token")
+		return
+	}
+
+	user, err := p.userDAO.GetById(c, token.UserID.Hex())
+	if err != nil || user.Removed {
+		utils.DefaultErrorResponse(c, 400, "Invalid or expired token")
+		return
+	}
+
+	// validated before consuming the token so a rejected password doesn't
+	// burn it
+	hashedPassword, err := dto.ToHashedPassword(p.policy, p.hasher, user)
+	if err != nil {
+		validationErrorResponse(c, err)
+		return
+	}
+
+	if _, err := p.userTokenDAO.Consume(c, entity.TokenPurposePasswordReset, tokenHash); err != nil {
+		utils.DefaultErrorResponse(c, 400, "Invalid or expired token")
+		return
+	}
+
+	user.HashedPassword = hashedPassword
+	user.UpdatedAt = time.Now()
+	user.Lockout.Reset()
+
+	if err := p.userDAO.SetPassword(c, user.ID, user.HashedPassword, user.UpdatedAt); err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+	if err := p.userDAO.ResetLockout(c, user.ID); err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	if err := p.userTokenDAO.DeleteByUser(c, user.ID, entity.TokenPurposePasswordReset); err != nil {
+		log.Printf("deleting reset tokens: %v", err)
+	}
+
+	if err := revokeAllAccess(c, p.userDAO, p.userJWT, p.accessTokens, user); err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	p.audit.Record(c, userEvent(entity.AuditPasswordReset, user))
+
+	c.JSON(200, gin.H{
+		"message": "Password reset successfully",
+		"success": true,
+	})
+}
+
+// @Summary Change password
+// @Description Change the password of the logged user. Other sessions and the personal access tokens are revoked and new tokens are returned for this one. Wrong passwords count towards the account lockout
+// @Security Bearer
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param body body dtos.ChangePasswordDTO true "Current and new password"
+// @Success 200 {object} dtos.UserLoginResponseDTO "Password changed"
+// @Failure 400 {object} utils.ErrorHandler
+// @Failure 429 {object} utils.ErrorHandler "Too many failed attempts"
+// @Router /user/password [put]
+func (p *PasswordHandler) Change(c *gin.Context) {
+
+	var dto dtos.ChangePasswordDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		utils.DefaultErrorResponse(c, 400, "Invalid request body")
+		return
+	}
+
+	user, err := p.userDAO.GetByEmail(c, c.GetString("email"))
+	if err != nil {
+		utils.DefaultErrorResponse(c, 404, "User not found")
+		return
+	}
+
+	if !checkPassword(c, p.loginGuard, p.userDAO, p.hasher, p.audit, entity.AuditPasswordChange, user, dto.CurrentPassword) {
+		return
+	}
+
+	hashedPassword, err := dto.ToHashedPassword(p.policy, p.hasher, user)
+	if err != nil {
+		validationErrorResponse(c, err)
+		return
+	}
+
+	user.HashedPassword = hashedPassword
+	user.UpdatedAt = time.Now()
+
+	if err := p.userDAO.SetPassword(c, user.ID, user.HashedPassword, user.UpdatedAt); err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	if err := revokeAllAccess(c, p.userDAO, p.userJWT, p.accessTokens, user); err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	p.audit.Record(c, userEvent(entity.AuditPasswordChange, user))
+
+	token, err := p.userJWT.GenerateToken(user.Email, user.EffectiveRole())
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	refreshToken, err := p.userJWT.GenerateRefreshToken(user.Email)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Internal server error")
+		return
+	}
+
+	c.JSON(200, dtos.UserLoginResponseDTO{
+		Token:        token,
+		RefreshToken: refreshToken,
+	})
+}
+
+// sendResetToken replaces any pending reset token of the user with a new
+// one and emails it.
+func (p *PasswordHandler) sendResetToken(user *entity.User) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	token, err := issueUserToken(ctx, p.userTokenDAO, user, entity.TokenPurposePasswordReset, user.Email, p.cfg.ResetTokenTTL)
+	if err != nil {
+		log.Printf("issuing reset token: %v", err)
+		return
+	}
+
+	link, err := withToken(p.cfg.ResetURL, token)
+	if err != nil {
+		log.Printf("building reset link: %v", err)
+		return
+	}
+
+	err = p.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %s and can only be used once.\n\n%s\n\n"+
+			"If you didn't ask for this, you can ignore this email.", user.Name, p.cfg.ResetTokenTTL, link),
+	})
+	if err != nil {
+		log.Printf("sending reset email: %v", err)
+	}
+}
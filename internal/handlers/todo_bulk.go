@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"time"
+	"todo-app-mongo/internal/database"
+	"todo-app-mongo/internal/dtos"
+	"todo-app-mongo/internal/entity"
+	"todo-app-mongo/internal/pkg/audit"
+	"todo-app-mongo/internal/pkg/middleware"
+	"todo-app-mongo/internal/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// errBulkFailed aborts the transaction of an atomic batch.
+var errBulkFailed = errors.New("bulk operation failed")
+
+// bulkItem is a valid operation of a batch, ready to write. Before is the
+// todo it changes, nil for a creation.
+type bulkItem struct {
+	index  int
+	action string
+	write  database.TodoWrite
+	before *entity.Todo
+}
+
+// @Summary Run several todo operations
+// @Description Create, update, complete, delete (move to the trash) and tag todos in one request, each operation answered with its own status. A todo can only appear in one operation of a batch, and each operation counts against the rate limit. With atomic, all the operations are applied or none, which needs MongoDB to run as a replica set; the batch then answers with the status of the first failure
+// @Tags todo
+// @Accept json
+// @Produce json
+// @Param operations body dtos.BulkTodoDTO true "Operations"
+// @Success 200 {object} dtos.BulkTodoResponseDTO
+// @Failure 400 {object} dtos.BulkTodoResponseDTO
+// @Failure 404 {object} dtos.BulkTodoResponseDTO
+// @Failure 409 {object} dtos.BulkTodoResponseDTO
+// @Failure 429 {object} utils.ErrorHandler
+// @Failure 500 {object} utils.ErrorHandler
+// @Failure 501 {object} utils.ErrorHandler
+// @Router /todo/bulk [post]
+func (t *TodoHandler) Bulk(c *gin.Context) {
+
+	user, err := t.getUserFromContext(c)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error getting user")
+		return
+	}
+
+	var bulkDTO dtos.BulkTodoDTO
+	if err := c.ShouldBindJSON(&bulkDTO); err != nil {
+		utils.DefaultErrorResponse(c, 400, "Invalid request body")
+		return
+	}
+
+	// each operation counts as a request, the first one was already
+	if !middleware.ChargeRateLimit(c, len(bulkDTO.Operations)-1) {
+		return
+	}
+
+	existing, err := t.loadBulkTodos(c, user, bulkDTO.Operations)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error getting todos")
+		return
+	}
+
+	now := time.Now()
+	results := make([]dtos.BulkTodoResultDTO, len(bulkDTO.Operations))
+	items := []bulkItem{}
+	seen := map[string]bool{}
+
+	for i, op := range bulkDTO.Operations {
+		results[i] = dtos.BulkTodoResultDTO{Index: i, Op: op.Op, ID: op.ID}
+
+		item, status, message := planBulkOperation(op, user, existing, seen, now)
+		if item == nil {
+			results[i].Status, results[i].Error = status, message
+			continue
+		}
+
+		item.index = i
+		items = append(items, *item)
+	}
+
+	if bulkDTO.Atomic && len(items) < len(results) {
+		bulkAborted(c, results, items)
+		return
+	}
+
+	writes := make([]database.TodoWrite, len(items))
+	for i, item := range items {
+		writes[i] = item.write
+	}
+
+	var errs []error
+	if bulkDTO.Atomic {
+		err = t.transactor.WithTransaction(c, func(ctx context.Context) error {
+			errs, err = t.todoDAO.BulkWrite(ctx, writes)
+			if err != nil {
+				return err
+			}
+			if slices.ContainsFunc(errs, func(err error) bool { return err != nil }) {
+				return errBulkFailed
+			}
+
+			return t.saveBulkRevisions(ctx, items, errs)
+		})
+	} else {
+		errs, err = t.todoDAO.BulkWrite(c, writes)
+		if err == nil {
+			// the todos are already written, a missing revision only
+			// leaves a gap in their history
+			if err := t.saveBulkRevisions(c, items, errs); err != nil {
+				log.Printf("saving bulk todo revisions: %v", err)
+			}
+		}
+	}
+
+	if err == database.ErrTransactionsUnsupported {
+		utils.DefaultErrorResponse(c, 501, "Atomic bulk operations need MongoDB to run as a replica set")
+		return
+	}
+	if err != nil && err != errBulkFailed {
+		utils.DefaultErrorResponse(c, 500, "Error writing todos")
+		return
+	}
+
+	for i, item := range items {
+		status, message := bulkWriteStatus(item, errs[i])
+		results[item.index].Status, results[item.index].Error = status, message
+	}
+
+	if err == errBulkFailed {
+		bulkAborted(c, results, items)
+		return
+	}
+
+	for _, item := range items {
+		result := &results[item.index]
+		if result.Status >= 300 {
+			continue
+		}
+
+		after := item.write.Todo
+		result.ID = after.ID.Hex()
+		if item.write.Op != database.TodoTrash {
+			result.Todo = after
+		}
+
+		event := todoEvent(item.action, user, after)
+		event.Changes = audit.Diff(item.before, after)
+		event.Details = map[string]string{"bulk": "true"}
+		t.audit.Record(c, event)
+	}
+
+	c.JSON(200, dtos.NewBulkTodoResponseDTO(bulkDTO.Atomic, results))
+}
+
+// loadBulkTodos returns the todos of the user the operations name, by ID.
+// Trashed todos and those of other users are left out.
+func (t *TodoHandler) loadBulkTodos(c *gin.Context, user *entity.User, operations []dtos.BulkTodoOperationDTO) (map[string]*entity.Todo, error) {
+
+	ids := []primitive.ObjectID{}
+	for _, op := range operations {
+		if id, err := primitive.ObjectIDFromHex(op.ID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	existing := map[string]*entity.Todo{}
+	if len(ids) == 0 {
+		return existing, nil
+	}
+
+	todos, err := t.todoDAO.GetMany(c, ids, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, todo := range todos {
+		existing[todo.ID.Hex()] = todo
+	}
+
+	return existing, nil
+}
+
+// planBulkOperation validates an operation and computes its write. On
+// failure the item is nil and the status and message describe why.
+func planBulkOperation(op dtos.BulkTodoOperationDTO, user *entity.User, existing map[string]*entity.Todo, seen map[string]bool, now time.Time) (*bulkItem, int, string) {
+
+	switch op.Op {
+	case dtos.BulkCreate:
+		if op.Todo == nil {
+			return nil, 400, "Operation create needs a todo"
+		}
+		if err := binding.Validator.ValidateStruct(op.Todo); err != nil {
+			return nil, 400, invalidTodoMessage(err)
+		}
+
+		todo, err := op.Todo.ToModel()
+		if err != nil {
+			return nil, 400, err.Error()
+		}
+		todo.UserID = user.ID
+
+		return &bulkItem{action: entity.AuditTodoCreate, write: database.TodoWrite{Op: database.TodoInsert, Todo: todo}}, 0, ""
+	case dtos.BulkUpdate, dtos.BulkComplete, dtos.BulkDelete, dtos.BulkTag:
+	default:
+		return nil, 400, "Unknown operation " + op.Op
+	}
+
+	if seen[op.ID] {
+		return nil, 400, "Todo already changed by another operation of the batch"
+	}
+	todo, ok := existing[op.ID]
+	if !ok {
+		return nil, 404, "Todo not found"
+	}
+	seen[op.ID] = true
+
+	var todoDTO dtos.TodoDTO
+	todoDTO.FromModel(todo)
+
+	switch op.Op {
+	case dtos.BulkUpdate:
+		if op.Todo == nil {
+			return nil, 400, "Operation update needs a todo"
+		}
+		todoDTO = *op.Todo
+	case dtos.BulkComplete:
+		todoDTO.Completed = op.Completed == nil || *op.Completed
+	case dtos.BulkTag:
+		if len(op.AddTags) == 0 && len(op.RemoveTags) == 0 {
+			return nil, 400, "Operation tag needs addTags or removeTags"
+		}
+		removed := dtos.NormalizeTags(op.RemoveTags)
+		todoDTO.Tags = slices.DeleteFunc(dtos.NormalizeTags(append(slices.Clone(todo.Tags), op.AddTags...)), func(tag string) bool {
+			return slices.Contains(removed, tag)
+		})
+	case dtos.BulkDelete:
+		trashed := *todo
+		trashed.DeletedAt = &now
+		write := database.TodoWrite{Op: database.TodoTrash, Todo: &trashed, Version: todo.Version}
+		return &bulkItem{action: entity.AuditTodoDelete, write: write, before: todo}, 0, ""
+	}
+
+	if err := binding.Validator.ValidateStruct(&todoDTO); err != nil {
+		return nil, 400, invalidTodoMessage(err)
+	}
+
+	updated, err := todoDTO.ApplyTo(todo)
+	if err != nil {
+		return nil, 400, err.Error()
+	}
+
+	write := database.TodoWrite{Op: database.TodoUpdate, Todo: updated, Version: todo.Version}
+	return &bulkItem{action: entity.AuditTodoUpdate, write: write, before: todo}, 0, ""
+}
+
+// saveBulkRevisions keeps the versions the applied updates replaced.
+func (t *TodoHandler) saveBulkRevisions(ctx context.Context, items []bulkItem, errs []error) error {
+
+	for i, item := range items {
+		if item.write.Op != database.TodoUpdate || errs[i] != nil {
+			continue
+		}
+		if _, err := t.revisionDAO.Create(ctx, item.before); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bulkWriteStatus is the status of a written operation.
+func bulkWriteStatus(item bulkItem, err error) (int, string) {
+
+	switch {
+	case err == nil && item.write.Op == database.TodoInsert:
+		return 201, ""
+	case err == nil && item.write.Op == database.TodoTrash:
+		return 204, ""
+	case err == nil:
+		return 200, ""
+	case err == database.ErrVersionConflict:
+		return 409, "Todo was modified concurrently, try again"
+	case err == mongo.ErrNoDocuments:
+		return 404, "Todo not found"
+	case mongo.IsDuplicateKeyError(err):
+		return 409, "Todo already exists"
+	default:
+		return 500, "Error writing todo"
+	}
+}
+
+// bulkAborted answers an atomic batch that wrote nothing: the operations
+// that didn't fail themselves are marked 424, and the batch answers with
+// the status of the first failure.
+func bulkAborted(c *gin.Context, results []dtos.BulkTodoResultDTO, items []bulkItem) {
+
+	for _, item := range items {
+		result := &results[item.index]
+		if result.Status < 300 {
+			result.Status, result.Error = 424, "Not applied, another operation failed"
+		}
+	}
+
+	status := 500
+	for _, result := range results {
+		if result.Status != 424 {
+			status = result.Status
+			break
+		}
+	}
+
+	c.JSON(status, dtos.NewBulkTodoResponseDTO(true, results))
+}
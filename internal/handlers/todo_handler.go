@@ -1,23 +1,32 @@
 package handlers
 
 import (
+	"context"
 	"errors"
+	"log"
 	"strconv"
+	"time"
 	"todo-app-mongo/internal/database"
 	"todo-app-mongo/internal/dtos"
 	"todo-app-mongo/internal/entity"
+	"todo-app-mongo/internal/pkg/audit"
 	"todo-app-mongo/internal/pkg/utils"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type TodoHandler struct {
-	todoDAO database.TodoDAOInterface
-	userDAO database.UserDAOInterface
+	todoDAO     database.TodoDAOInterface
+	revisionDAO database.TodoRevisionDAOInterface
+	userDAO     database.UserDAOInterface
+	transactor  database.Transactor
+	audit       *audit.Recorder
 }
 
-func NewTodoHandler(todoDAO database.TodoDAOInterface, userDAO database.UserDAOInterface) *TodoHandler {
-	return &TodoHandler{todoDAO: todoDAO, userDAO: userDAO}
+func NewTodoHandler(todoDAO database.TodoDAOInterface, revisionDAO database.TodoRevisionDAOInterface, userDAO database.UserDAOInterface, transactor database.Transactor, audit *audit.Recorder) *TodoHandler {
+	return &TodoHandler{todoDAO: todoDAO, revisionDAO: revisionDAO, userDAO: userDAO, transactor: transactor, audit: audit}
 }
 
 // @Summary Create a new todo
@@ -27,6 +36,7 @@ func NewTodoHandler(todoDAO database.TodoDAOInterface, userDAO database.UserDAOI
 // @Produce json
 // @Param todo body dtos.TodoDTO true "Todo object"
 // @Success 201 {object} entity.Todo
+// @Header 201 {string} ETag "Version of the todo"
 // @Failure 400 {object} utils.ErrorHandler
 // @Router /todo [post]
 func (t *TodoHandler) Create(c *gin.Context) {
@@ -43,7 +53,11 @@ func (t *TodoHandler) Create(c *gin.Context) {
 		return
 	}
 
-	todo := todoDTO.ToModel()
+	todo, err := todoDTO.ToModel()
+	if err != nil {
+		utils.DefaultErrorResponse(c, 400, err.Error())
+		return
+	}
 	todo.UserID = user.ID
 
 	if err := t.todoDAO.Create(c, todo); err != nil {
@@ -51,17 +65,26 @@ func (t *TodoHandler) Create(c *gin.Context) {
 		return
 	}
 
+	event := todoEvent(entity.AuditTodoCreate, user, todo)
+	event.Changes = audit.Diff(nil, todo)
+	t.audit.Record(c, event)
+
+	c.Header("ETag", todoETag(todo))
 	c.JSON(201, todo)
 
 }
 
 // @Summary Get a todo by ID
-// @Description Get a todo by ID
+// @Description Get a todo by ID. With If-None-Match, answers 304 while the todo is at that version
 // @Tags todo
 // @Accept json
 // @Produce json
 // @Param id path string true "Todo ID"
+// @Param If-None-Match header string false "ETag of the cached version"
 // @Success 200 {object} entity.Todo
+// @Header 200 {string} ETag "Version of the todo"
+// @Success 304
+// @Failure 404 {object} utils.ErrorHandler
 // @Failure 500 {object} utils.ErrorHandler
 // @Router /todo/{id} [get]
 func (t *TodoHandler) Get(c *gin.Context) {
@@ -72,10 +95,16 @@ func (t *TodoHandler) Get(c *gin.Context) {
 		return
 	}
 
-	id := c.Param("id")
-	todo, err := t.todoDAO.Get(c, id, user.ID.String())
-	if err != nil {
-		utils.DefaultErrorResponse(c, 500, "Error getting todo")
+	todo, ok := t.getTodo(c, user, "Error getting todo")
+	if !ok {
+		return
+	}
+
+	etag := todoETag(todo)
+	c.Header("ETag", etag)
+
+	if header := c.GetHeader("If-None-Match"); header != "" && etagMatches(header, etag, true) {
+		c.Status(304)
 		return
 	}
 
@@ -133,53 +162,471 @@ func (t *TodoHandler) GetAll(c *gin.Context) {
 
 }
 
-// @Summary Update a todo by ID
-// @Description Update a todo by ID
+// @Summary Replace a todo by ID
+// @Description Replace the editable fields of a todo, resetting the omitted ones. The id, owner, creation time and version are kept and completed_at follows completed. The previous version is kept in its history. With If-Match, answers 412 unless the todo is still at that version
 // @Tags todo
 // @Accept json
 // @Produce json
 // @Param id path string true "Todo ID"
+// @Param If-Match header string false "ETag of the version edited"
 // @Param todo body dtos.TodoDTO true "Todo object"
 // @Success 200 {object} entity.Todo
+// @Header 200 {string} ETag "Version of the todo"
+// @Failure 400 {object} utils.ErrorHandler
+// @Failure 404 {object} utils.ErrorHandler
+// @Failure 409 {object} utils.ErrorHandler
+// @Failure 412 {object} utils.ErrorHandler
 // @Failure 500 {object} utils.ErrorHandler
 // @Router /todo/{id} [put]
 func (t *TodoHandler) Update(c *gin.Context) {
 
-	id := c.Param("id")
+	user, err := t.getUserFromContext(c)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error getting user")
+		return
+	}
+
 	var todoDTO dtos.TodoDTO
 	if err := c.ShouldBindJSON(&todoDTO); err != nil {
 		utils.DefaultErrorResponse(c, 400, "Invalid request body")
 		return
 	}
 
-	todo := todoDTO.ToModelUpdate()
-	if err := t.todoDAO.Update(c, id, todo); err != nil {
+	existing, ok := t.getTodo(c, user, "Error updating todo")
+	if !ok || !ifMatch(c, existing) {
+		return
+	}
+
+	t.save(c, user, existing, &todoDTO)
+}
+
+// @Summary Patch a todo by ID
+// @Description Change some fields of a todo with a JSON merge patch (RFC 7396, application/merge-patch+json) or a JSON Patch (RFC 6902, application/json-patch+json) applied to the todo as GET returns it. Only title, description, scheduled, scheduled_to, all_day, completed and tags can change. The previous version is kept in its history. With If-Match, answers 412 unless the todo is still at that version
+// @Tags todo
+// @Accept application/merge-patch+json
+// @Accept application/json-patch+json
+// @Produce json
+// @Param id path string true "Todo ID"
+// @Param If-Match header string false "ETag of the version edited"
+// @Param patch body object true "Merge patch or JSON Patch"
+// @Success 200 {object} entity.Todo
+// @Header 200 {string} ETag "Version of the todo"
+// @Failure 400 {object} utils.ErrorHandler
+// @Failure 404 {object} utils.ErrorHandler
+// @Failure 409 {object} utils.ErrorHandler
+// @Failure 412 {object} utils.ErrorHandler
+// @Failure 415 {object} utils.ErrorHandler
+// @Failure 500 {object} utils.ErrorHandler
+// @Router /todo/{id} [patch]
+func (t *TodoHandler) Patch(c *gin.Context) {
+
+	user, err := t.getUserFromContext(c)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error getting user")
+		return
+	}
+
+	patch, err := c.GetRawData()
+	if err != nil {
+		utils.DefaultErrorResponse(c, 400, "Invalid request body")
+		return
+	}
+
+	existing, ok := t.getTodo(c, user, "Error updating todo")
+	if !ok || !ifMatch(c, existing) {
+		return
+	}
+
+	todoDTO, status, message := patchTodo(existing, c.ContentType(), patch)
+	if todoDTO == nil {
+		utils.DefaultErrorResponse(c, status, message)
+		return
+	}
+
+	t.save(c, user, existing, todoDTO)
+}
+
+// save replaces the editable fields of the todo with the DTO's, keeping
+// the previous version in the history, and answers with the new version.
+func (t *TodoHandler) save(c *gin.Context, user *entity.User, existing *entity.Todo, todoDTO *dtos.TodoDTO) {
+
+	todo, err := todoDTO.ApplyTo(existing)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	err = t.todoDAO.Update(c, existing.ID.Hex(), todo, existing.Version)
+	if err == database.ErrVersionConflict {
+		versionConflict(c)
+		return
+	}
+	if err != nil {
 		utils.DefaultErrorResponse(c, 500, "Error updating todo")
 		return
 	}
 
+	t.saveRevision(c, existing)
+
+	event := todoEvent(entity.AuditTodoUpdate, user, todo)
+	event.Changes = audit.Diff(existing, todo)
+	t.audit.Record(c, event)
+
+	c.Header("ETag", todoETag(todo))
 	c.JSON(200, todo)
 }
 
 // @Summary Delete a todo by ID
-// @Description Delete a todo by ID
+// @Description Move a todo to the trash, at its next version. It can be restored until it is purged. With If-Match, answers 412 unless the todo is still at that version; without it, answers 409 when the todo changed while being deleted
 // @Tags todo
 // @Accept json
 // @Param id path string true "Todo ID"
+// @Param If-Match header string false "ETag of the version deleted"
 // @Success 204
+// @Failure 404 {object} utils.ErrorHandler
+// @Failure 409 {object} utils.ErrorHandler
+// @Failure 412 {object} utils.ErrorHandler
 // @Failure 500 {object} utils.ErrorHandler
 // @Router /todo/{id} [delete]
 func (t *TodoHandler) Delete(c *gin.Context) {
 
-	id := c.Param("id")
-	if err := t.todoDAO.Delete(c, id); err != nil {
+	user, err := t.getUserFromContext(c)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error getting user")
+		return
+	}
+
+	todo, ok := t.getTodo(c, user, "Error deleting todo")
+	if !ok || !ifMatch(c, todo) {
+		return
+	}
+
+	now := time.Now()
+	err = t.todoDAO.Trash(c, todo.ID, todo.Version, now)
+	if err == database.ErrVersionConflict {
+		versionConflict(c)
+		return
+	}
+	if err != nil {
 		utils.DefaultErrorResponse(c, 500, "Error deleting todo")
 		return
 	}
 
+	trashed := *todo
+	trashed.DeletedAt = &now
+	trashed.Version++
+
+	event := todoEvent(entity.AuditTodoDelete, user, todo)
+	event.Changes = audit.Diff(todo, &trashed)
+	t.audit.Record(c, event)
+
 	c.JSON(204, nil)
 }
 
+// @Summary List the trash
+// @Description List the deleted todos not purged yet, last deleted first
+// @Tags todo
+// @Produce json
+// @Success 200 {array} entity.Todo
+// @Failure 500 {object} utils.ErrorHandler
+// @Router /todo/trash [get]
+func (t *TodoHandler) ListTrash(c *gin.Context) {
+
+	user, err := t.getUserFromContext(c)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error getting user")
+		return
+	}
+
+	todos, err := t.todoDAO.ListTrash(c, user.ID)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error getting trash")
+		return
+	}
+
+	c.JSON(200, todos)
+}
+
+// @Summary Restore a todo from the trash
+// @Description Undo the deletion of a todo, moving it to its next version
+// @Tags todo
+// @Produce json
+// @Param id path string true "Todo ID"
+// @Success 200 {object} entity.Todo
+// @Header 200 {string} ETag "Version of the todo"
+// @Failure 404 {object} utils.ErrorHandler
+// @Failure 500 {object} utils.ErrorHandler
+// @Router /todo/{id}/restore [post]
+func (t *TodoHandler) Untrash(c *gin.Context) {
+
+	user, err := t.getUserFromContext(c)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error getting user")
+		return
+	}
+
+	todo, ok := t.getTrashedTodo(c, user, "Error restoring todo")
+	if !ok {
+		return
+	}
+
+	err = t.todoDAO.Untrash(c, todo.ID)
+	if err == mongo.ErrNoDocuments {
+		utils.DefaultErrorResponse(c, 404, "Todo not found")
+		return
+	}
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error restoring todo")
+		return
+	}
+
+	restored := *todo
+	restored.DeletedAt = nil
+	restored.Version++
+
+	event := todoEvent(entity.AuditTodoUntrash, user, todo)
+	event.Changes = audit.Diff(todo, &restored)
+	t.audit.Record(c, event)
+
+	c.Header("ETag", todoETag(&restored))
+	c.JSON(200, restored)
+}
+
+// @Summary Delete a todo permanently
+// @Description Delete a todo in the trash and its history for good
+// @Tags todo
+// @Param id path string true "Todo ID"
+// @Success 204
+// @Failure 404 {object} utils.ErrorHandler
+// @Failure 500 {object} utils.ErrorHandler
+// @Router /todo/trash/{id} [delete]
+func (t *TodoHandler) Purge(c *gin.Context) {
+
+	user, err := t.getUserFromContext(c)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error getting user")
+		return
+	}
+
+	todo, ok := t.getTrashedTodo(c, user, "Error deleting todo")
+	if !ok {
+		return
+	}
+
+	err = t.purge(c, user, todo)
+	if err == mongo.ErrNoDocuments {
+		utils.DefaultErrorResponse(c, 404, "Todo not found")
+		return
+	}
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error deleting todo")
+		return
+	}
+
+	c.JSON(204, nil)
+}
+
+// @Summary Empty the trash
+// @Description Delete every todo in the trash and their history for good
+// @Tags todo
+// @Success 204
+// @Failure 500 {object} utils.ErrorHandler
+// @Router /todo/trash [delete]
+func (t *TodoHandler) EmptyTrash(c *gin.Context) {
+
+	user, err := t.getUserFromContext(c)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error getting user")
+		return
+	}
+
+	todos, err := t.todoDAO.ListTrash(c, user.ID)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error emptying trash")
+		return
+	}
+
+	for _, todo := range todos {
+		// a todo restored or deleted meanwhile is skipped
+		if err := t.purge(c, user, todo); err != nil && err != mongo.ErrNoDocuments {
+			utils.DefaultErrorResponse(c, 500, "Error emptying trash")
+			return
+		}
+	}
+
+	c.JSON(204, nil)
+}
+
+// purge deletes a trashed todo of the user and its history for good. It
+// returns mongo.ErrNoDocuments when the todo is no longer in the trash.
+func (t *TodoHandler) purge(c *gin.Context, user *entity.User, todo *entity.Todo) error {
+
+	if err := t.todoDAO.DeleteTrashed(c, todo.ID, user.ID); err != nil {
+		return err
+	}
+
+	event := todoEvent(entity.AuditTodoPurge, user, todo)
+	event.Changes = audit.Diff(todo, nil)
+	t.audit.Record(c, event)
+
+	// the todo is gone, a failure only leaves its revisions behind
+	if err := t.revisionDAO.DeleteByTodo(c, todo.ID); err != nil {
+		log.Printf("deleting revisions of todo %s: %v", todo.ID.Hex(), err)
+	}
+
+	return nil
+}
+
+// @Summary Get the history of a todo
+// @Description List the previous versions of a todo, newest first, each with the fields the following version changed
+// @Tags todo
+// @Produce json
+// @Param id path string true "Todo ID"
+// @Success 200 {array} dtos.TodoRevisionResponseDTO
+// @Failure 404 {object} utils.ErrorHandler
+// @Failure 500 {object} utils.ErrorHandler
+// @Router /todo/{id}/history [get]
+func (t *TodoHandler) History(c *gin.Context) {
+
+	user, err := t.getUserFromContext(c)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error getting user")
+		return
+	}
+
+	todo, ok := t.getTodo(c, user, "Error getting todo history")
+	if !ok {
+		return
+	}
+
+	revisions, err := t.revisionDAO.ListByTodo(c, todo.ID)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error getting todo history")
+		return
+	}
+
+	// each revision was replaced by the one after it, the newest by the
+	// current todo
+	history := make([]dtos.TodoRevisionResponseDTO, len(revisions))
+	next := todo
+	for i, revision := range revisions {
+		history[i] = dtos.NewTodoRevisionResponseDTO(revision, audit.Diff(&revision.Todo, next))
+		next = &revision.Todo
+	}
+
+	c.JSON(200, history)
+}
+
+// @Summary Restore a previous version of a todo
+// @Description Roll a todo back to a revision from its history. The current version is kept in the history, so a restore can be undone. With If-Match, answers 412 unless the todo is still at that version
+// @Tags todo
+// @Produce json
+// @Param id path string true "Todo ID"
+// @Param rev path int true "Revision"
+// @Param If-Match header string false "ETag of the version replaced"
+// @Success 200 {object} entity.Todo
+// @Header 200 {string} ETag "Version of the todo"
+// @Failure 404 {object} utils.ErrorHandler
+// @Failure 409 {object} utils.ErrorHandler
+// @Failure 412 {object} utils.ErrorHandler
+// @Failure 500 {object} utils.ErrorHandler
+// @Router /todo/{id}/restore/{rev} [post]
+func (t *TodoHandler) Restore(c *gin.Context) {
+
+	user, err := t.getUserFromContext(c)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error getting user")
+		return
+	}
+
+	current, ok := t.getTodo(c, user, "Error restoring todo")
+	if !ok || !ifMatch(c, current) {
+		return
+	}
+
+	number, err := strconv.Atoi(c.Param("rev"))
+	if err != nil {
+		utils.DefaultErrorResponse(c, 404, "Revision not found")
+		return
+	}
+
+	revision, err := t.revisionDAO.Get(c, current.ID, number)
+	if err == mongo.ErrNoDocuments {
+		utils.DefaultErrorResponse(c, 404, "Revision not found")
+		return
+	}
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error restoring todo")
+		return
+	}
+
+	restored := revision.Todo
+	err = t.todoDAO.Update(c, current.ID.Hex(), &restored, current.Version)
+	if err == database.ErrVersionConflict {
+		versionConflict(c)
+		return
+	}
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error restoring todo")
+		return
+	}
+
+	t.saveRevision(c, current)
+
+	event := todoEvent(entity.AuditTodoRestore, user, current)
+	event.Changes = audit.Diff(current, &restored)
+	event.Details = map[string]string{"revision": strconv.Itoa(number)}
+	t.audit.Record(c, event)
+
+	c.Header("ETag", todoETag(&restored))
+	c.JSON(200, restored)
+}
+
+// saveRevision keeps the version a successful update replaced. The todo is
+// already written, a missing revision only leaves a gap in its history.
+func (t *TodoHandler) saveRevision(ctx context.Context, replaced *entity.Todo) {
+	if _, err := t.revisionDAO.Create(ctx, replaced); err != nil {
+		log.Printf("saving revision of todo %s: %v", replaced.ID.Hex(), err)
+	}
+}
+
+// getTodo loads the todo of the id path parameter. Todos of other users
+// and trashed ones are not found. On failure it answers with 404 or with
+// the message.
+func (t *TodoHandler) getTodo(c *gin.Context, user *entity.User, message string) (*entity.Todo, bool) {
+	return findTodo(c, message, func(id string) (*entity.Todo, error) {
+		return t.todoDAO.Get(c, id, user.ID)
+	})
+}
+
+// getTrashedTodo is getTodo for the todos in the trash.
+func (t *TodoHandler) getTrashedTodo(c *gin.Context, user *entity.User, message string) (*entity.Todo, bool) {
+	return findTodo(c, message, func(id string) (*entity.Todo, error) {
+		return t.todoDAO.GetTrashed(c, id, user.ID)
+	})
+}
+
+func findTodo(c *gin.Context, message string, get func(id string) (*entity.Todo, error)) (*entity.Todo, bool) {
+
+	id := c.Param("id")
+	if !primitive.IsValidObjectID(id) {
+		utils.DefaultErrorResponse(c, 404, "Todo not found")
+		return nil, false
+	}
+
+	todo, err := get(id)
+	if err == mongo.ErrNoDocuments {
+		utils.DefaultErrorResponse(c, 404, "Todo not found")
+		return nil, false
+	}
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, message)
+		return nil, false
+	}
+
+	return todo, true
+}
+
 func (t *TodoHandler) getUserFromContext(c *gin.Context) (*entity.User, error) {
 
 	user, err := t.userDAO.GetByEmail(c, c.GetString("email"))
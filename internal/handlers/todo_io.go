@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"todo-app-mongo/internal/database"
+	"todo-app-mongo/internal/dtos"
+	"todo-app-mongo/internal/entity"
+	"todo-app-mongo/internal/pkg/audit"
+	"todo-app-mongo/internal/pkg/todoio"
+	"todo-app-mongo/internal/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxImportSize = 5 << 20
+	maxImportRows = 1000
+)
+
+// @Summary Export todos
+// @Description Download every todo, the trash excluded, as JSON (like the API returns them), CSV (cells escaped against spreadsheet formulas) or iCalendar (a VTODO per todo, due when scheduled, and a VEVENT per scheduled todo). The file is streamed
+// @Tags todo
+// @Produce json
+// @Produce text/csv
+// @Produce text/calendar
+// @Param format query string false "json, csv or ics" default(json)
+// @Success 200 {file} file
+// @Failure 400 {object} utils.ErrorHandler
+// @Failure 500 {object} utils.ErrorHandler
+// @Router /todo/export [get]
+func (t *TodoHandler) Export(c *gin.Context) {
+
+	user, err := t.getUserFromContext(c)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error getting user")
+		return
+	}
+
+	format := c.DefaultQuery("format", todoio.FormatJSON)
+	encoder, err := todoio.NewEncoder(format, c.Writer)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	c.Header("Content-Type", todoio.ContentType(format)+"; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="todos.`+format+`"`)
+
+	streamTodos(c, encoder, "Error exporting todos", func(fn func(todo *entity.Todo) error) error {
+		return t.todoDAO.ForEach(c, user.ID, fn)
+	})
+}
+
+// streamTodos answers 200 with the todos forEach reads, encoded as they
+// come. An error before anything was written answers 500 with message
+// instead.
+func streamTodos(c *gin.Context, encoder todoio.Encoder, message string, forEach func(fn func(todo *entity.Todo) error) error) {
+
+	c.Status(200)
+
+	err := forEach(encoder.Encode)
+	if err == nil {
+		err = encoder.Close()
+	}
+	if err == nil {
+		return
+	}
+
+	if !c.Writer.Written() {
+		c.Writer.Header().Del("Content-Type")
+		c.Writer.Header().Del("Content-Disposition")
+		utils.DefaultErrorResponse(c, 500, message)
+		return
+	}
+	// the file is cut short, the status can't tell anymore
+	log.Printf("streaming todos: %v", err)
+}
+
+// @Summary Import todos
+// @Description Create todos from a JSON, CSV or iCalendar file, in the formats of the export; iCalendar VEVENTs become todos scheduled at their start, but for those exported along with a VTODO. Rows that repeat an existing todo, by id or by title, description and schedule, are skipped. Each row is reported, and a dry run only reports. At most 1000 todos per file
+// @Tags todo
+// @Accept json
+// @Accept text/csv
+// @Accept text/calendar
+// @Produce json
+// @Param format query string false "json, csv or ics, taken from the Content-Type when omitted"
+// @Param dry_run query bool false "Check the file without importing it"
+// @Param file body string true "File content"
+// @Success 200 {object} dtos.ImportTodosResponseDTO
+// @Failure 400 {object} utils.ErrorHandler
+// @Failure 413 {object} utils.ErrorHandler
+// @Failure 415 {object} utils.ErrorHandler
+// @Failure 500 {object} utils.ErrorHandler
+// @Router /todo/import [post]
+func (t *TodoHandler) Import(c *gin.Context) {
+
+	user, err := t.getUserFromContext(c)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error getting user")
+		return
+	}
+
+	format := c.Query("format")
+	if format == "" {
+		var ok bool
+		if format, ok = todoio.FormatOf(c.GetHeader("Content-Type")); !ok {
+			utils.DefaultErrorResponse(c, 415, "Send the file as application/json, text/csv or text/calendar, or set format")
+			return
+		}
+	}
+
+	dryRun := false
+	if value := c.Query("dry_run"); value != "" {
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			utils.DefaultErrorResponse(c, 400, "dry_run must be true or false")
+			return
+		}
+	}
+
+	rows, err := todoio.Decode(format, http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		utils.DefaultErrorResponse(c, 413, "Import files are limited to 5 MB")
+		return
+	}
+	if err != nil {
+		utils.DefaultErrorResponse(c, 400, err.Error())
+		return
+	}
+	if len(rows) > maxImportRows {
+		utils.DefaultErrorResponse(c, 413, "Import files are limited to "+strconv.Itoa(maxImportRows)+" todos")
+		return
+	}
+
+	// duplicates are told apart by the id they were exported with or by
+	// their content, against the todos of the user and the previous rows
+	ids, contents := map[string]bool{}, map[string]bool{}
+	err = t.todoDAO.ForEach(c, user.ID, func(todo *entity.Todo) error {
+		ids[todo.ID.Hex()] = true
+		contents[duplicateKey(todo)] = true
+		return nil
+	})
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error importing todos")
+		return
+	}
+
+	now := time.Now()
+	results := make([]dtos.ImportRowDTO, len(rows))
+	writes := []database.TodoWrite{}
+	written := []int{}
+
+	for i, row := range rows {
+		results[i] = dtos.ImportRowDTO{Row: row.Number}
+
+		todo, err := importedTodo(row, user, now)
+		if err != nil {
+			results[i].Status, results[i].Error = dtos.ImportInvalid, err.Error()
+			continue
+		}
+
+		key := duplicateKey(todo)
+		if (row.ID != "" && ids[row.ID]) || contents[key] {
+			results[i].Status = dtos.ImportDuplicate
+			continue
+		}
+		if row.ID != "" {
+			ids[row.ID] = true
+		}
+		contents[key] = true
+
+		results[i].Status, results[i].ID = dtos.ImportImportable, todo.ID.Hex()
+		writes = append(writes, database.TodoWrite{Op: database.TodoInsert, Todo: todo})
+		written = append(written, i)
+	}
+
+	if dryRun || len(writes) == 0 {
+		c.JSON(200, dtos.NewImportTodosResponseDTO(dryRun, results))
+		return
+	}
+
+	errs, err := t.todoDAO.BulkWrite(c, writes)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error importing todos")
+		return
+	}
+
+	for j, i := range written {
+		if errs[j] != nil {
+			results[i].Status, results[i].ID, results[i].Error = dtos.ImportFailed, "", "Error saving todo"
+			continue
+		}
+
+		results[i].Status = dtos.ImportImported
+
+		event := todoEvent(entity.AuditTodoCreate, user, writes[j].Todo)
+		event.Changes = audit.Diff(nil, writes[j].Todo)
+		event.Details = map[string]string{"import": format}
+		t.audit.Record(c, event)
+	}
+
+	c.JSON(200, dtos.NewImportTodosResponseDTO(false, results))
+}
+
+// importedTodo validates a row like a new todo and completes it. Its
+// creation and completion times are kept when the file has them.
+func importedTodo(row todoio.Row, user *entity.User, now time.Time) (*entity.Todo, error) {
+
+	if row.Err != nil {
+		return nil, row.Err
+	}
+
+	var todoDTO dtos.TodoDTO
+	todoDTO.FromModel(&row.Todo)
+	if err := binding.Validator.ValidateStruct(&todoDTO); err != nil {
+		return nil, errors.New(invalidTodoMessage(err))
+	}
+
+	todo, err := todoDTO.ApplyTo(&row.Todo)
+	if err != nil {
+		return nil, err
+	}
+	todo.ID = primitive.NewObjectID()
+	todo.UserID = user.ID
+	todo.Version = 1
+	if todo.CreatedAt.IsZero() {
+		todo.CreatedAt = now
+	}
+	todo.UpdatedAt = now
+	switch {
+	case !todo.Completed:
+		todo.CompletedAt = time.Time{}
+	case todo.CompletedAt.IsZero():
+		todo.CompletedAt = now
+	}
+
+	return todo, nil
+}
+
+// duplicateKey identifies a todo by its content.
+func duplicateKey(todo *entity.Todo) string {
+	return strings.ToLower(strings.TrimSpace(todo.Title)) + "\x00" + strings.TrimSpace(todo.Description) + "\x00" + todo.ScheduledTo.UTC().Format(time.RFC3339)
+}
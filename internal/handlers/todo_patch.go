@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+	"todo-app-mongo/internal/dtos"
+	"todo-app-mongo/internal/entity"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/gin-gonic/gin/binding"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+// patchableFields are the fields of a todo a patch can change, those of
+// dtos.TodoDTO. The others are managed by the server.
+var patchableFields = []string{"title", "description", "scheduled", "scheduled_to", "all_day", "completed", "tags"}
+
+// patchTodo applies a merge patch or a JSON Patch, told apart by the content
+// type, to the todo as the API returns it, and returns the editable fields
+// of the result. On failure the DTO is nil and the status and message
+// describe why.
+func patchTodo(todo *entity.Todo, contentType string, patch []byte) (*dtos.TodoDTO, int, string) {
+
+	doc, err := json.Marshal(todo)
+	if err != nil {
+		return nil, 500, "Error updating todo"
+	}
+
+	var patched []byte
+	switch contentType {
+	case mergePatchContentType:
+		patched, err = jsonpatch.MergePatch(doc, patch)
+		if err != nil {
+			return nil, 400, "Invalid merge patch"
+		}
+	case jsonPatchContentType:
+		operations, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return nil, 400, "Invalid JSON Patch"
+		}
+		patched, err = operations.Apply(doc)
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			return nil, 409, "JSON Patch test failed"
+		}
+		if err != nil {
+			return nil, 400, "JSON Patch does not apply: " + err.Error()
+		}
+	default:
+		return nil, 415, "Patches must be " + mergePatchContentType + " or " + jsonPatchContentType
+	}
+
+	var before, after map[string]any
+	if err := json.Unmarshal(doc, &before); err != nil {
+		return nil, 500, "Error updating todo"
+	}
+	if err := json.Unmarshal(patched, &after); err != nil {
+		return nil, 400, "The patched todo must be an object"
+	}
+
+	for field := range after {
+		if _, ok := before[field]; !ok {
+			return nil, 400, "Unknown field " + field
+		}
+	}
+	for field, value := range before {
+		if slices.Contains(patchableFields, field) {
+			continue
+		}
+		if !reflect.DeepEqual(value, after[field]) {
+			return nil, 400, "Field " + field + " can't be changed"
+		}
+	}
+
+	var todoDTO dtos.TodoDTO
+	if err := json.Unmarshal(patched, &todoDTO); err != nil {
+		return nil, 400, "Invalid field type in patched todo"
+	}
+	if err := binding.Validator.ValidateStruct(&todoDTO); err != nil {
+		return nil, 400, invalidTodoMessage(err)
+	}
+
+	return &todoDTO, 0, ""
+}
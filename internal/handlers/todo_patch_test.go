@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"todo-app-mongo/internal/entity"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func patchedTodo() *entity.Todo {
+	created := time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)
+	return &entity.Todo{
+		ID:          primitive.NewObjectID(),
+		Title:       "Groceries",
+		Description: "Milk",
+		Tags:        []string{"home"},
+		CreatedAt:   created,
+		UpdatedAt:   created,
+		UserID:      primitive.NewObjectID(),
+		Version:     3,
+	}
+}
+
+func TestPatchTodo(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		patch       string
+		status      int
+		message     string
+		check       func(t *testing.T, title string, description string, completed bool, tags []string)
+	}{
+		{
+			name:        "merge patch",
+			contentType: mergePatchContentType,
+			patch:       `{"title": "Call Bob", "completed": true}`,
+			check: func(t *testing.T, title string, description string, completed bool, tags []string) {
+				if title != "Call Bob" || description != "Milk" || !completed || strings.Join(tags, ",") != "home" {
+					t.Fatalf("got %q %q %v %v", title, description, completed, tags)
+				}
+			},
+		},
+		{
+			name:        "merge patch replacing tags",
+			contentType: mergePatchContentType,
+			patch:       `{"tags": ["work", "urgent"]}`,
+			check: func(t *testing.T, title string, description string, completed bool, tags []string) {
+				if strings.Join(tags, ",") != "work,urgent" {
+					t.Fatalf("tags %v", tags)
+				}
+			},
+		},
+		{
+			name:        "merge patch removing a required field",
+			contentType: mergePatchContentType,
+			patch:       `{"description": null}`,
+			status:      400,
+			message:     "Todo description is required",
+		},
+		{
+			name:        "merge patch with an unknown field",
+			contentType: mergePatchContentType,
+			patch:       `{"priority": 1}`,
+			status:      400,
+			message:     "Unknown field priority",
+		},
+		{
+			name:        "merge patch of a managed field",
+			contentType: mergePatchContentType,
+			patch:       `{"version": 7}`,
+			status:      400,
+			message:     "Field version can't be changed",
+		},
+		{
+			name:        "merge patch removing a managed field",
+			contentType: mergePatchContentType,
+			patch:       `{"user_id": null}`,
+			status:      400,
+			message:     "Field user_id can't be changed",
+		},
+		{
+			name:        "merge patch of the wrong type",
+			contentType: mergePatchContentType,
+			patch:       `{"completed": "yes"}`,
+			status:      400,
+			message:     "Invalid field type in patched todo",
+		},
+		{
+			name:        "invalid merge patch",
+			contentType: mergePatchContentType,
+			patch:       `{"title":`,
+			status:      400,
+			message:     "Invalid merge patch",
+		},
+		{
+			name:        "merge patch replacing the todo",
+			contentType: mergePatchContentType,
+			patch:       `["title"]`,
+			status:      400,
+			message:     "The patched todo must be an object",
+		},
+		{
+			name:        "JSON Patch",
+			contentType: jsonPatchContentType,
+			patch:       `[{"op": "test", "path": "/version", "value": 3}, {"op": "replace", "path": "/title", "value": "Call Bob"}, {"op": "add", "path": "/tags/-", "value": "work"}]`,
+			check: func(t *testing.T, title string, description string, completed bool, tags []string) {
+				if title != "Call Bob" || strings.Join(tags, ",") != "home,work" {
+					t.Fatalf("got %q %v", title, tags)
+				}
+			},
+		},
+		{
+			name:        "JSON Patch test failing",
+			contentType: jsonPatchContentType,
+			patch:       `[{"op": "test", "path": "/version", "value": 2}, {"op": "replace", "path": "/title", "value": "Call Bob"}]`,
+			status:      409,
+			message:     "JSON Patch test failed",
+		},
+		{
+			name:        "JSON Patch on a missing path",
+			contentType: jsonPatchContentType,
+			patch:       `[{"op": "remove", "path": "/priority"}]`,
+			status:      400,
+		},
+		{
+			name:        "JSON Patch of a managed field",
+			contentType: jsonPatchContentType,
+			patch:       `[{"op": "replace", "path": "/created_at", "value": "2020-01-01T00:00:00Z"}]`,
+			status:      400,
+			message:     "Field created_at can't be changed",
+		},
+		{
+			name:        "invalid JSON Patch",
+			contentType: jsonPatchContentType,
+			patch:       `{"op": "replace"}`,
+			status:      400,
+			message:     "Invalid JSON Patch",
+		},
+		{
+			name:        "other content type",
+			contentType: "application/json",
+			patch:       `{"title": "Call Bob"}`,
+			status:      415,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			todoDTO, status, message := patchTodo(patchedTodo(), tt.contentType, []byte(tt.patch))
+
+			if tt.status != 0 {
+				if todoDTO != nil || status != tt.status {
+					t.Fatalf("status %d (%q), want %d", status, message, tt.status)
+				}
+				if tt.message != "" && message != tt.message {
+					t.Fatalf("message %q, want %q", message, tt.message)
+				}
+				return
+			}
+
+			if todoDTO == nil {
+				t.Fatalf("status %d: %s", status, message)
+			}
+			tt.check(t, todoDTO.Title, todoDTO.Description, todoDTO.Completed, todoDTO.Tags)
+		})
+	}
+}
+
+func TestPatchTodoSchedule(t *testing.T) {
+	allDay := patchedTodo()
+	allDay.Scheduled, allDay.AllDay = true, true
+	allDay.ScheduledTo = time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	timed := patchedTodo()
+	timed.Scheduled = true
+	timed.ScheduledTo = time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		todo  *entity.Todo
+		patch string
+		// want is the schedule after the patch, zero for an invalid one.
+		want time.Time
+	}{
+		{"all-day todo kept", allDay, `{"title": "Holiday"}`, allDay.ScheduledTo},
+		{"timed todo kept", timed, `{"title": "Call Bob"}`, timed.ScheduledTo},
+		{"all-day todo moved", allDay, `{"scheduled_to": "2026-02-03"}`, time.Date(2026, 2, 3, 0, 0, 0, 0, time.UTC)},
+		{"timed todo made all day", timed, `{"all_day": true}`, time.Time{}},
+		{"timed todo made all day on a date", timed, `{"all_day": true, "scheduled_to": "2026-01-02"}`, allDay.ScheduledTo},
+		// todos without a schedule are returned with the zero time
+		{"unscheduled todo made all day", patchedTodo(), `{"all_day": true}`, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			todoDTO, status, message := patchTodo(tt.todo, mergePatchContentType, []byte(tt.patch))
+			if todoDTO == nil {
+				t.Fatalf("status %d: %s", status, message)
+			}
+
+			updated, err := todoDTO.ApplyTo(tt.todo)
+			if tt.want.IsZero() {
+				if err == nil {
+					t.Fatalf("schedule %v accepted", updated.ScheduledTo)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !updated.ScheduledTo.Equal(tt.want) {
+				t.Fatalf("scheduled to %v, want %v", updated.ScheduledTo, tt.want)
+			}
+		})
+	}
+}
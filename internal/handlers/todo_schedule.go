@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+	"todo-app-mongo/internal/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultUpcomingDays = 7
+	maxUpcomingDays     = 90
+)
+
+// @Summary List the todos due today
+// @Description List the scheduled todos due today in the time zone of the user, completed or not, soonest first. All-day todos come first
+// @Tags todo
+// @Produce json
+// @Success 200 {array} entity.Todo
+// @Failure 500 {object} utils.ErrorHandler
+// @Router /todo/today [get]
+func (t *TodoHandler) Today(c *gin.Context) {
+
+	user, err := t.getUserFromContext(c)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error getting user")
+		return
+	}
+
+	today := startOfDay(time.Now().In(user.Location()))
+
+	todos, err := t.todoDAO.ListScheduled(c, user.ID, today, today.AddDate(0, 0, 1), nil)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error getting todos")
+		return
+	}
+
+	c.JSON(200, todos)
+}
+
+// @Summary List the upcoming todos
+// @Description List the todos not completed yet due in the next days, from tomorrow in the time zone of the user, soonest first
+// @Tags todo
+// @Produce json
+// @Param days query int false "Days after today, at most 90" default(7)
+// @Success 200 {array} entity.Todo
+// @Failure 400 {object} utils.ErrorHandler
+// @Failure 500 {object} utils.ErrorHandler
+// @Router /todo/upcoming [get]
+func (t *TodoHandler) Upcoming(c *gin.Context) {
+
+	user, err := t.getUserFromContext(c)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error getting user")
+		return
+	}
+
+	days := defaultUpcomingDays
+	if d := c.Query("days"); d != "" {
+		days, err = strconv.Atoi(d)
+		if err != nil || days < 1 || days > maxUpcomingDays {
+			utils.DefaultErrorResponse(c, 400, "days must be between 1 and "+strconv.Itoa(maxUpcomingDays))
+			return
+		}
+	}
+
+	tomorrow := startOfDay(time.Now().In(user.Location())).AddDate(0, 0, 1)
+	completed := false
+
+	todos, err := t.todoDAO.ListScheduled(c, user.ID, tomorrow, tomorrow.AddDate(0, 0, days), &completed)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 500, "Error getting todos")
+		return
+	}
+
+	c.JSON(200, todos)
+}
+
+// startOfDay returns the midnight starting the day of t, in its time zone.
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
@@ -1,8 +1,17 @@
 package handlers
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
 	"todo-app-mongo/internal/database"
 	"todo-app-mongo/internal/dtos"
+	"todo-app-mongo/internal/entity"
+	"todo-app-mongo/internal/pkg/audit"
+	"todo-app-mongo/internal/pkg/mailer"
 	"todo-app-mongo/internal/pkg/security"
 	"todo-app-mongo/internal/pkg/utils"
 
@@ -10,16 +19,23 @@ import (
 )
 
 type UserHandler struct {
-	userDAO database.UserDAOInterface
+	userDAO    database.UserDAOInterface
+	userJWT    security.UserJWTInterface
+	loginGuard *security.LoginGuard
+	mailer     mailer.Mailer
+	email      *EmailHandler
+	policy     *security.PasswordPolicy
+	hasher     security.PasswordHasher
+	audit      *audit.Recorder
 }
 
-func NewUserHandler(userDAO database.UserDAOInterface) *UserHandler {
-	return &UserHandler{userDAO: userDAO}
+func NewUserHandler(userDAO database.UserDAOInterface, userJWT security.UserJWTInterface, loginGuard *security.LoginGuard, mailer mailer.Mailer, email *EmailHandler, policy *security.PasswordPolicy, hasher security.PasswordHasher, audit *audit.Recorder) *UserHandler {
+	return &UserHandler{userDAO: userDAO, userJWT: userJWT, loginGuard: loginGuard, mailer: mailer, email: email, policy: policy, hasher: hasher, audit: audit}
 
 }
 
 // @Summary Create a new user
-// @Description Create a new user
+// @Description Create a new user and email a link to verify the address
 // @Tags user
 // @Accept json
 // @Produce json
@@ -35,9 +51,9 @@ func (u *UserHandler) Create(c *gin.Context) {
 		return
 	}
 
-	userModel, err := user.ToUserModel()
+	userModel, err := user.ToUserModel(u.policy, u.hasher)
 	if err != nil {
-		utils.DefaultErrorResponse(c, 400, err.Error())
+		validationErrorResponse(c, err)
 		return
 	}
 
@@ -47,21 +63,27 @@ func (u *UserHandler) Create(c *gin.Context) {
 		return
 	}
 
-	c.JSON(201, dtos.UserResponseDTO{
-		Name:  userModel.Name,
-		Email: userModel.Email,
-		ID:    userModel.ID.Hex(),
-	})
+	event := userEvent(entity.AuditUserCreate, userModel)
+	event.Changes = audit.Diff(nil, profile(userModel))
+	u.audit.Record(c, event)
+
+	// the account is usable already, a failed email can be sent again
+	// through /user/verify/resend
+	go u.sendVerification(userModel)
+
+	c.JSON(201, dtos.NewUserResponseDTO(userModel))
 }
 
 // @Summary Login
-// @Description Login
+// @Description Login. Accounts with two-factor authentication get mfaRequired and an mfaToken to complete with /user/login/mfa instead of the tokens
 // @Tags user
 // @Accept json
 // @Produce json
 // @Param user body dtos.UserLoginDTO true "User object"
 // @Success 200 {object} dtos.UserLoginResponseDTO "User logged in"
 // @Failure 400 {object} utils.ErrorHandler
+// @Failure 403 {object} utils.ErrorHandler "Email not verified or account disabled"
+// @Failure 429 {object} utils.ErrorHandler "Too many failed attempts"
 // @Router /user/login [post]
 func (u *UserHandler) Login(c *gin.Context) {
 
@@ -72,34 +94,108 @@ func (u *UserHandler) Login(c *gin.Context) {
 		return
 	}
 
+	ip := c.ClientIP()
+	if wait, blocked := u.loginGuard.IPBlocked(ip); blocked {
+		u.audit.Record(c, failedEvent(entity.AuditUserLogin, nil, dto.Email, "ip_blocked"))
+		retryAfter(c, wait)
+		utils.DefaultErrorResponse(c, 429, "Too many failed login attempts")
+		return
+	}
+
+	now := time.Now()
+
+	// unknown emails go through the same steps with an in-memory lockout
+	// record so responses and timings don't reveal registered accounts
 	user, err := u.userDAO.GetByEmail(c, dto.Email)
-	if err != nil {
-		utils.DefaultErrorResponse(c, 400, "Invalid email or password")
+	exists := err == nil
+
+	lockout := u.loginGuard.UnknownLockout(dto.Email)
+	if exists {
+		lockout = user.Lockout
+	}
+
+	if lockout.IsLocked(now) {
+		u.audit.Record(c, failedEvent(entity.AuditUserLogin, user, dto.Email, "locked"))
+		retryAfter(c, lockout.LockedUntil.Sub(now))
+		utils.DefaultErrorResponse(c, 429, "Account temporarily locked, try again later")
 		return
 	}
 
-	if !user.ComparePassword(dto.Password) {
+	var valid bool
+	if exists {
+		valid = u.hasher.Verify(dto.Password, user.HashedPassword)
+	} else {
+		valid = u.loginGuard.CompareUnknown(dto.Password)
+	}
+
+	if !valid {
+		u.loginGuard.RecordIPFailure(ip)
+
+		var locked bool
+		var delay time.Duration
+		if exists {
+			locked, delay, err = u.loginGuard.FailAccount(c, u.userDAO, user, now)
+			if err != nil {
+				utils.DefaultErrorResponse(c, 500, "Internal server error")
+				return
+			}
+			if locked {
+				go u.notifyLockout(user)
+			}
+		} else {
+			_, delay = u.loginGuard.FailUnknown(dto.Email, now)
+		}
+
+		u.audit.Record(c, failedEvent(entity.AuditUserLogin, user, dto.Email, "invalid_password"))
+
+		time.Sleep(delay)
+
 		utils.DefaultErrorResponse(c, 400, "Invalid email or password")
 		return
 	}
 
-	token, err := security.GenerateToken(user.Email)
-	if err != nil {
-		utils.DefaultErrorResponse(c, 500, "Internal server error")
-		return
+	if user.Lockout != (entity.LoginLockout{}) {
+		if err := u.userDAO.ResetLockout(c, user.ID); err != nil {
+			utils.DefaultErrorResponse(c, 500, "Internal server error")
+			return
+		}
+		user.Lockout.Reset()
 	}
 
-	refreshToken, err := security.GenerateRefreshToken(user.Email)
-	if err != nil {
-		utils.DefaultErrorResponse(c, 500, "Internal server error")
+	// the plain password is only known now, so hashes made with an older
+	// algorithm or cost are upgraded as users log in, unless the password
+	// changed since it was checked
+	if u.hasher.NeedsRehash(user.HashedPassword) {
+		if hashed, err := u.hasher.Hash(dto.Password); err != nil {
+			log.Printf("rehashing password: %v", err)
+		} else if _, err := u.userDAO.RehashPassword(c, user.ID, user.HashedPassword, hashed); err != nil {
+			utils.DefaultErrorResponse(c, 500, "Internal server error")
+			return
+		}
+	}
+
+	// checked after the password so it doesn't reveal unverified or
+	// disabled accounts
+	if user.Disabled {
+		u.audit.Record(c, failedEvent(entity.AuditUserLogin, user, user.Email, "disabled"))
+		utils.DefaultErrorResponse(c, 403, "Account disabled")
+		return
+	}
+	if u.email.RefusesLogin(user) {
+		u.audit.Record(c, failedEvent(entity.AuditUserLogin, user, user.Email, "email_not_verified"))
+		utils.DefaultErrorResponse(c, 403, "Email not verified")
 		return
 	}
 
-	c.JSON(200, dtos.UserLoginResponseDTO{
-		Token:        token,
-		RefreshToken: refreshToken,
-	})
+	event := userEvent(entity.AuditUserLogin, user)
+	event.Details = map[string]string{"method": "password"}
+	if user.MFA.Enabled {
+		// the login completes with the second factor at /user/login/mfa
+		event.Details["mfa"] = "required"
+	}
+	u.audit.Record(c, event)
 
+	loginResponse(c, u.userJWT, user)
 }
 
 // @Summary Get user by ID
@@ -122,15 +218,12 @@ func (u *UserHandler) GetUser(c *gin.Context) {
 		return
 	}
 
-	c.JSON(200, dtos.UserResponseDTO{
-		ID:    user.ID.Hex(),
-		Name:  user.Name,
-		Email: user.Email,
-	})
+	c.JSON(200, dtos.NewUserResponseDTO(user))
 }
 
 // @Summary Update user
-// @Description Update user
+// @Description Update user, only the name is changed. Use PATCH /user instead
+// @Deprecated
 // @Security Bearer
 // @Tags user
 // @Accept json
@@ -155,6 +248,8 @@ func (u *UserHandler) Update(c *gin.Context) {
 		return
 	}
 
+	before := profile(dbUser)
+
 	// por enquanto só atualiza o nome
 	dbUser.Name = user.Name
 
@@ -164,11 +259,58 @@ func (u *UserHandler) Update(c *gin.Context) {
 		return
 	}
 
-	c.JSON(200, dtos.UserResponseDTO{
-		Name:  dbUser.Name,
-		Email: dbUser.Email,
-		ID:    dbUser.ID.Hex(),
-	})
+	event := userEvent(entity.AuditUserUpdate, dbUser)
+	event.Changes = audit.Diff(before, profile(dbUser))
+	u.audit.Record(c, event)
+
+	c.JSON(200, dtos.NewUserResponseDTO(dbUser))
+}
+
+// @Summary Update profile
+// @Description Update the profile fields present in the body
+// @Security Bearer
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param user body dtos.UserPatchDTO true "Profile fields"
+// @Success 200 {object} dtos.UserResponseDTO "User updated"
+// @Failure 400 {object} utils.ErrorHandler
+// @Router /user [patch]
+func (u *UserHandler) Patch(c *gin.Context) {
+
+	var dto dtos.UserPatchDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		utils.DefaultErrorResponse(c, 400, "Invalid request body")
+		return
+	}
+
+	user, err := u.userDAO.GetByEmail(c, c.GetString("email"))
+	if err != nil {
+		utils.DefaultErrorResponse(c, 404, "User not found")
+		return
+	}
+
+	before := profile(user)
+
+	changed, err := dto.ApplyTo(user)
+	if err != nil {
+		utils.DefaultErrorResponse(c, 400, err.Error())
+		return
+	}
+
+	if changed {
+		user.UpdatedAt = time.Now()
+		if user, err = u.userDAO.Update(c, user); err != nil {
+			utils.DefaultErrorResponse(c, 500, "Internal server error")
+			return
+		}
+
+		event := userEvent(entity.AuditUserUpdate, user)
+		event.Changes = audit.Diff(before, profile(user))
+		u.audit.Record(c, event)
+	}
+
+	c.JSON(200, dtos.NewUserResponseDTO(user))
 }
 
 // @Summary Logout
@@ -191,14 +333,18 @@ func (u *UserHandler) Logout(c *gin.Context) {
 		return
 	}
 
-	security.LogOff(token)
-	security.LogOff(refreshtoken)
+	u.userJWT.LogOff(token)
+	u.userJWT.LogOff(refreshtoken)
 
-	if !security.IsLoggedOff(token) && !security.IsLoggedOff(refreshtoken) {
+	if !u.userJWT.IsLoggedOff(token) && !u.userJWT.IsLoggedOff(refreshtoken) {
 		utils.DefaultErrorResponse(c, 500, "Internal server error")
 		return
 	}
 
+	if user, err := u.userDAO.GetByEmail(c, c.GetString("email")); err == nil {
+		u.audit.Record(c, userEvent(entity.AuditUserLogout, user))
+	}
+
 	c.JSON(200, gin.H{
 		"message": "Logged out successfully",
 		"succes":  true,
@@ -216,12 +362,14 @@ func (u *UserHandler) Logout(c *gin.Context) {
 func (u *UserHandler) Delete(c *gin.Context) {
 	email := c.GetString("email")
 
-	_, err := u.userDAO.Delete(c, email)
+	user, err := u.userDAO.Delete(c, email)
 	if err != nil {
 		utils.DefaultErrorResponse(c, 500, "Internal server error")
 		return
 	}
 
+	u.audit.Record(c, userEvent(entity.AuditUserDelete, user))
+
 	c.JSON(200, gin.H{
 		"message": "User deleted",
 		"success": true,
@@ -248,26 +396,72 @@ func (u *UserHandler) Refresh(c *gin.Context) {
 		return
 	}
 
-	email, err := security.ValidateRefreshToken(refreshtoken)
+	claims, err := u.userJWT.ValidateRefreshToken(refreshtoken)
 	if err != nil {
+		u.audit.Record(c, failedEvent(entity.AuditUserRefresh, nil, "", "invalid_refresh_token"))
 		utils.DefaultErrorResponse(c, 401, "Invalid refresh token")
 		return
 	}
 
-	if security.IsLoggedOff(token) {
+	if u.userJWT.IsLoggedOff(token) {
+		u.audit.Record(c, failedEvent(entity.AuditUserRefresh, nil, claims.Email, "logged_off"))
 		utils.DefaultErrorResponse(c, 401, "Invalid token")
 		return
 	}
 
-	newToken, err := security.GenerateToken(email)
+	// the role may have changed and the account been disabled since the
+	// login, so they are read again
+	user, err := u.userDAO.GetByEmail(c, claims.Email)
+	if err != nil || user.Removed || user.Disabled {
+		u.audit.Record(c, failedEvent(entity.AuditUserRefresh, nil, claims.Email, "account_unavailable"))
+		utils.DefaultErrorResponse(c, 401, "Invalid refresh token")
+		return
+	}
+	if user.TokenRevoked(claims.IssuedAtMs) {
+		u.audit.Record(c, failedEvent(entity.AuditUserRefresh, user, user.Email, "revoked"))
+		utils.DefaultErrorResponse(c, 401, "Invalid refresh token")
+		return
+	}
+
+	newToken, err := u.userJWT.GenerateToken(user.Email, user.EffectiveRole())
 	if err != nil {
 		utils.DefaultErrorResponse(c, 500, "Internal server error")
 		return
 	}
 
+	u.audit.Record(c, userEvent(entity.AuditUserRefresh, user))
+
 	c.JSON(200, dtos.UserLoginResponseDTO{
 		Token:        newToken,
 		RefreshToken: refreshtoken,
 	})
 
 }
+
+func (u *UserHandler) notifyLockout(user *entity.User) {
+
+	err := u.mailer.Send(context.Background(), mailer.Message{
+		To:      user.Email,
+		Subject: "Your account has been temporarily locked",
+		Body: fmt.Sprintf("Hi %s,\n\nWe locked your account until %s after several failed login attempts. "+
+			"If this wasn't you, consider changing your password once the lock expires.",
+			user.Name, user.Lockout.LockedUntil.UTC().Format(time.RFC1123)),
+	})
+	if err != nil {
+		log.Printf("sending lockout notification: %v", err)
+	}
+}
+
+func (u *UserHandler) sendVerification(user *entity.User) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := u.email.SendVerification(ctx, user); err != nil {
+		log.Printf("sending verification email: %v", err)
+	}
+}
+
+func retryAfter(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
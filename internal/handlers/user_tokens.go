@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"net/url"
+	"time"
+	"todo-app-mongo/internal/database"
+	"todo-app-mongo/internal/entity"
+	"todo-app-mongo/internal/pkg/security"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// issueUserToken replaces the pending tokens of the user for purpose with a
+// new one bound to email and returns the secret to send.
+func issueUserToken(ctx context.Context, dao database.UserTokenDAOInterface, user *entity.User, purpose string, email string, ttl time.Duration) (string, error) {
+
+	if err := dao.DeleteByUser(ctx, user.ID, purpose); err != nil {
+		return "", err
+	}
+
+	token, hash, err := security.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	err = dao.Create(ctx, &entity.UserToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		Purpose:   purpose,
+		TokenHash: hash,
+		Email:     email,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// withToken appends the token as the "token" query parameter of link.
+func withToken(link string, token string) (string, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
@@ -0,0 +1,118 @@
+package audit
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"slices"
+	"time"
+	"todo-app-mongo/internal/database"
+	"todo-app-mongo/internal/entity"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Recorder writes audit events, completed with the request they come from.
+type Recorder struct {
+	events    database.AuditEventDAOInterface
+	retention time.Duration
+}
+
+// NewRecorder keeps events for retention, or forever when it is 0.
+func NewRecorder(events database.AuditEventDAOInterface, retention time.Duration) *Recorder {
+	return &Recorder{events: events, retention: retention}
+}
+
+// Record saves the event with the IP, user agent and personal access token
+// of the request. Events are successes unless their outcome says
+// otherwise. A failure to save is logged: the action it describes already
+// happened.
+func (r *Recorder) Record(c *gin.Context, event *entity.AuditEvent) {
+
+	event.IP = c.ClientIP()
+	event.UserAgent = c.Request.UserAgent()
+	event.AccessTokenID = c.GetString("access_token_id")
+
+	r.RecordJob(c, event)
+}
+
+// RecordJob saves the event of a background job, which comes from no
+// request and has no actor. Like Record, it logs a failure to save.
+func (r *Recorder) RecordJob(ctx context.Context, event *entity.AuditEvent) {
+
+	now := time.Now()
+
+	event.ID = primitive.NewObjectID()
+	event.CreatedAt = now
+	if event.Outcome == "" {
+		event.Outcome = entity.AuditSuccess
+	}
+	if r.retention > 0 {
+		expiresAt := now.Add(r.retention)
+		event.ExpiresAt = &expiresAt
+	}
+
+	if err := r.events.Create(ctx, event); err != nil {
+		log.Printf("recording audit event %s by %s: %v", event.Action, event.ActorEmail, err)
+	}
+}
+
+// Diff lists the fields that differ between two versions of a document,
+// compared as they are stored. Either version can be nil, for documents
+// created or deleted.
+func Diff(before any, after any) []entity.FieldChange {
+
+	beforeDoc, afterDoc := document(before), document(after)
+
+	fields := []string{}
+	for field := range beforeDoc {
+		fields = append(fields, field)
+	}
+	for field := range afterDoc {
+		if _, ok := beforeDoc[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	slices.Sort(fields)
+
+	changes := []entity.FieldChange{}
+	for _, field := range fields {
+		if field == "_id" {
+			continue
+		}
+
+		beforeValue, afterValue := beforeDoc[field], afterDoc[field]
+		if reflect.DeepEqual(beforeValue, afterValue) {
+			continue
+		}
+
+		changes = append(changes, entity.FieldChange{Field: field, Before: beforeValue, After: afterValue})
+	}
+
+	return changes
+}
+
+// document converts v to its stored form. Values that can't be stored have
+// no fields.
+func document(v any) bson.M {
+
+	doc := bson.M{}
+	if v == nil {
+		return doc
+	}
+	if rv := reflect.ValueOf(v); (rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Map) && rv.IsNil() {
+		return doc
+	}
+
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return doc
+	}
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return bson.M{}
+	}
+
+	return doc
+}
@@ -0,0 +1,164 @@
+package health
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Kind int
+
+const (
+	Liveness Kind = iota
+	Readiness
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+
+	shutdownCheck = "shutdown"
+)
+
+// CheckFunc reports a component as healthy by returning nil.
+type CheckFunc func(ctx context.Context) error
+
+// Result is the outcome of a check. Probes are unauthenticated, so why a
+// check failed is logged rather than reported.
+type Result struct {
+	Status    string    `json:"status"`
+	LatencyMs int64     `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+func (r *Report) Healthy() bool {
+	return r.Status == StatusUp
+}
+
+type check struct {
+	name string
+	kind Kind
+	fn   CheckFunc
+
+	mu      sync.Mutex
+	last    Result
+	expires time.Time
+}
+
+// Registry holds the checks components register at startup. Results are
+// cached for cacheTTL so frequent probes don't hit the backing services on
+// every request.
+type Registry struct {
+	mu       sync.RWMutex
+	checks   []*check
+	cacheTTL time.Duration
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+func NewRegistry(cacheTTL time.Duration, timeout time.Duration) *Registry {
+	return &Registry{
+		cacheTTL: cacheTTL,
+		timeout:  timeout,
+	}
+}
+
+func (r *Registry) Register(name string, kind Kind, fn CheckFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checks = append(r.checks, &check{name: name, kind: kind, fn: fn})
+}
+
+// Drain makes every following readiness report fail, bypassing the cache,
+// so load balancers stop routing traffic before the server shuts down.
+func (r *Registry) Drain() {
+	r.draining.Store(true)
+}
+
+// Run executes every check of the given kind concurrently and aggregates
+// their results. The report is down as soon as one check fails.
+func (r *Registry) Run(ctx context.Context, kind Kind) *Report {
+
+	r.mu.RLock()
+	var checks []*check
+	for _, c := range r.checks {
+		if c.kind == kind {
+			checks = append(checks, c)
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(checks, func(i, j int) bool { return checks[i].name < checks[j].name })
+
+	results := make([]Result, len(checks))
+
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *check) {
+			defer wg.Done()
+			results[i] = r.runCheck(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := &Report{
+		Status: StatusUp,
+		Checks: make(map[string]Result, len(checks)),
+	}
+	for i, c := range checks {
+		report.Checks[c.name] = results[i]
+		if results[i].Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+
+	if kind == Readiness && r.draining.Load() {
+		report.Status = StatusDown
+		report.Checks[shutdownCheck] = Result{
+			Status:    StatusDown,
+			CheckedAt: time.Now(),
+		}
+	}
+
+	return report
+}
+
+func (r *Registry) runCheck(ctx context.Context, c *check) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(c.expires) {
+		return c.last
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	err := c.fn(ctx)
+
+	result := Result{
+		Status:    StatusUp,
+		LatencyMs: time.Since(now).Milliseconds(),
+		CheckedAt: now,
+	}
+	if err != nil {
+		result.Status = StatusDown
+		log.Printf("health check %s: %v", c.name, err)
+	}
+
+	c.last = result
+	c.expires = now.Add(r.cacheTTL)
+
+	return result
+}
@@ -0,0 +1,171 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriterFoldsLongLines(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, "-//test//EN")
+	w.Begin("VTODO")
+	w.Text("SUMMARY", strings.Repeat("é", 60))
+	w.End("VTODO")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Fatalf("line of %d octets: %q", len(line), line)
+		}
+	}
+
+	components, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, _ := components[0].Get("SUMMARY")
+	if UnescapeText(summary.Value) != strings.Repeat("é", 60) {
+		t.Fatalf("unfolded summary %q", summary.Value)
+	}
+}
+
+func TestTextEscaping(t *testing.T) {
+	tests := []string{
+		"plain",
+		`back\slash`,
+		"semi;colon, and comma",
+		"two\nlines",
+	}
+
+	for _, value := range tests {
+		if got := UnescapeText(EscapeText(value)); got != value {
+			t.Errorf("%q round trips to %q", value, got)
+		}
+	}
+
+	if got := UnescapeText(EscapeText("a\r\nb")); got != "a\nb" {
+		t.Errorf("CRLF unescaped to %q", got)
+	}
+}
+
+func TestSplitTextList(t *testing.T) {
+	got := SplitTextList(`home,work\,late,a\;b`)
+	want := []string{"home", "work,late", "a;b"}
+
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	input := "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"BEGIN:VTODO\r\n" +
+		"UID:1\r\n" +
+		"SUMMARY:Call\r\n" +
+		"  Bob\r\n" +
+		"DUE;TZID=\"Europe/Paris\":20260102T150405\r\n" +
+		"END:VTODO\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:2\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	components, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(components) != 2 || components[0].Name != "VTODO" || components[1].Name != "VEVENT" {
+		t.Fatalf("components %+v", components)
+	}
+	if components[0].Line != 3 {
+		t.Fatalf("VTODO on line %d", components[0].Line)
+	}
+
+	summary, _ := components[0].Get("SUMMARY")
+	if summary.Value != "Call Bob" {
+		t.Fatalf("summary %q", summary.Value)
+	}
+	due, _ := components[0].Get("DUE")
+	if due.Params["TZID"] != "Europe/Paris" || due.Value != "20260102T150405" {
+		t.Fatalf("due %+v", due)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"missing colon", "BEGIN:VCALENDAR\r\nVERSION\r\nEND:VCALENDAR\r\n"},
+		{"unmatched end", "BEGIN:VCALENDAR\r\nEND:VTODO\r\n"},
+		{"not ended", "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\n"},
+		{"outside of a component", "UID:1\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(strings.NewReader(tt.input)); err == nil {
+				t.Fatal("no error")
+			}
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+
+	tests := []struct {
+		name   string
+		prop   Property
+		want   time.Time
+		isDate bool
+	}{
+		{"UTC", Property{Value: "20260102T150405Z"}, time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC), false},
+		{"TZID", Property{Value: "20260102T150405", Params: map[string]string{"TZID": "Europe/Paris"}}, time.Date(2026, 1, 2, 15, 4, 5, 0, paris), false},
+		{"floating", Property{Value: "20260102T150405"}, time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC), false},
+		{"date", Property{Value: "20260102", Params: map[string]string{"VALUE": "DATE"}}, time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, isDate, err := ParseTime(tt.prop, time.UTC)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) || isDate != tt.isDate {
+				t.Fatalf("got %v (date %v), want %v (date %v)", got, isDate, tt.want, tt.isDate)
+			}
+		})
+	}
+
+	if _, _, err := ParseTime(Property{Value: "tomorrow"}, time.UTC); err == nil {
+		t.Fatal("no error for an invalid time")
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{time.Hour, "PT1H"},
+		{90 * time.Minute, "PT1H30M"},
+		{36 * time.Hour, "P1DT12H"},
+		{24 * time.Hour, "P1D"},
+		{0, "PT0S"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatDuration(tt.d); got != tt.want {
+			t.Errorf("%v: got %s, want %s", tt.d, got, tt.want)
+		}
+	}
+}
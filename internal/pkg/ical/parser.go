@@ -0,0 +1,221 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Property is a content line: NAME;PARAM=VALUE:value. Value is raw, use
+// UnescapeText for TEXT properties.
+type Property struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// Component is a VTODO, VEVENT or other component, with the line it
+// starts on. Nested components are returned on their own.
+type Component struct {
+	Name       string
+	Line       int
+	Properties map[string][]Property
+}
+
+// Get returns the first property with the name.
+func (c *Component) Get(name string) (Property, bool) {
+	props := c.Properties[name]
+	if len(props) == 0 {
+		return Property{}, false
+	}
+
+	return props[0], true
+}
+
+// Parse reads every component of an iCalendar stream, VCALENDAR excluded,
+// in order.
+func Parse(r io.Reader) ([]*Component, error) {
+
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	components := []*Component{}
+	stack := []*Component{}
+
+	for _, l := range lines {
+		prop, err := parseLine(l.text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", l.number, err)
+		}
+
+		switch prop.Name {
+		case "BEGIN":
+			component := &Component{Name: strings.ToUpper(prop.Value), Line: l.number, Properties: map[string][]Property{}}
+			stack = append(stack, component)
+			if component.Name != "VCALENDAR" {
+				components = append(components, component)
+			}
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(prop.Value) {
+				return nil, fmt.Errorf("line %d: unexpected END:%s", l.number, prop.Value)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: property outside of a component", l.number)
+			}
+			current := stack[len(stack)-1]
+			current.Properties[prop.Name] = append(current.Properties[prop.Name], prop)
+		}
+	}
+
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("%s not ended", stack[len(stack)-1].Name)
+	}
+
+	return components, nil
+}
+
+type contentLine struct {
+	number int
+	text   string
+}
+
+// unfold joins the lines folded with a leading space or tab.
+func unfold(r io.Reader) ([]contentLine, error) {
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	lines := []contentLine{}
+	number := 0
+	for scanner.Scan() {
+		number++
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+
+		if (strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1].text += text[1:]
+			continue
+		}
+		if text == "" {
+			continue
+		}
+
+		lines = append(lines, contentLine{number: number, text: text})
+	}
+
+	return lines, scanner.Err()
+}
+
+func parseLine(line string) (Property, error) {
+
+	// the value starts at the first colon outside of a quoted parameter
+	colon := -1
+	quoted := false
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		}
+		if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return Property{}, errors.New("missing ':'")
+	}
+
+	prop := Property{Value: line[colon+1:], Params: map[string]string{}}
+
+	parts := strings.Split(line[:colon], ";")
+	prop.Name = strings.ToUpper(parts[0])
+	if prop.Name == "" {
+		return Property{}, errors.New("missing property name")
+	}
+	for _, param := range parts[1:] {
+		key, value, _ := strings.Cut(param, "=")
+		prop.Params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+
+	return prop, nil
+}
+
+// UnescapeText reverses EscapeText.
+func UnescapeText(value string) string {
+
+	var b strings.Builder
+	escaped := false
+	for _, r := range value {
+		if !escaped {
+			if r == '\\' {
+				escaped = true
+			} else {
+				b.WriteRune(r)
+			}
+			continue
+		}
+
+		escaped = false
+		switch r {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// SplitTextList splits a property holding several TEXT values, like
+// CATEGORIES, and unescapes them.
+func SplitTextList(value string) []string {
+
+	values := []string{}
+	start := 0
+	escaped := false
+	for i, r := range value {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == ',':
+			values = append(values, UnescapeText(value[start:i]))
+			start = i + 1
+		}
+	}
+
+	return append(values, UnescapeText(value[start:]))
+}
+
+// ParseTime reads a DATE or DATE-TIME property. DATE-TIMEs are in UTC when
+// they end with Z, in the TZID parameter's zone when it names one, and in
+// loc otherwise. DATEs are midnight in loc, and reported as such by
+// isDate.
+func ParseTime(prop Property, loc *time.Location) (t time.Time, isDate bool, err error) {
+
+	if prop.Params["VALUE"] == "DATE" || len(prop.Value) == len("20060102") {
+		t, err = time.ParseInLocation("20060102", prop.Value, loc)
+		return t, true, err
+	}
+
+	if strings.HasSuffix(prop.Value, "Z") {
+		t, err = time.Parse("20060102T150405Z", prop.Value)
+		return t, false, err
+	}
+
+	if tzid := prop.Params["TZID"]; tzid != "" {
+		if zone, err := time.LoadLocation(tzid); err == nil {
+			loc = zone
+		}
+	}
+
+	t, err = time.ParseInLocation("20060102T150405", prop.Value, loc)
+	return t, false, err
+}
@@ -0,0 +1,136 @@
+package ical
+
+import (
+	"strconv"
+	"time"
+)
+
+// Timezone writes a VTIMEZONE describing loc between from and to, with an
+// observance per offset it has there, so that LocalTime values in that
+// range read back as the same instants. The zone is named by loc.
+func (w *Writer) Timezone(loc *time.Location, from time.Time, to time.Time) {
+
+	w.Begin("VTIMEZONE")
+	w.Value("TZID", loc.String())
+
+	start := from.In(loc)
+	_, offsetFrom := start.Zone()
+	for _, change := range offsetChanges(loc, from, to) {
+		w.observance(start, offsetFrom)
+		_, offsetFrom = start.Zone()
+		start = change
+	}
+	w.observance(start, offsetFrom)
+
+	w.End("VTIMEZONE")
+}
+
+// LocalTime writes a DATE-TIME property as a local time of loc, which must
+// be described by a VTIMEZONE of the calendar. Local times loc repeats,
+// when clocks go back, are written in UTC: readers don't agree on which of
+// the two instants they are.
+func (w *Writer) LocalTime(name string, t time.Time, loc *time.Location) {
+
+	if repeated(t, loc) {
+		w.Time(name, t)
+		return
+	}
+
+	w.Value(name+";TZID="+loc.String(), t.In(loc).Format("20060102T150405"))
+}
+
+// repeated tells whether loc shows the local time of t at another instant
+// too, at the offset it has a day before or after.
+func repeated(t time.Time, loc *time.Location) bool {
+
+	current := offset(t, loc)
+	for _, other := range []int{offset(t.Add(-24*time.Hour), loc), offset(t.Add(24*time.Hour), loc)} {
+		if other == current {
+			continue
+		}
+		if twin := t.Add(time.Duration(current-other) * time.Second); offset(twin, loc) == other {
+			return true
+		}
+	}
+
+	return false
+}
+
+// observance writes the STANDARD or DAYLIGHT period of the zone starting
+// at start, from offsetFrom seconds east of UTC.
+func (w *Writer) observance(start time.Time, offsetFrom int) {
+
+	name, offsetTo := start.Zone()
+	component := "STANDARD"
+	if start.IsDST() {
+		component = "DAYLIGHT"
+	}
+
+	w.Begin(component)
+	// the start is local to the offset in force before it
+	w.Value("DTSTART", start.UTC().Add(time.Duration(offsetFrom)*time.Second).Format("20060102T150405"))
+	w.Value("TZOFFSETFROM", formatOffset(offsetFrom))
+	w.Value("TZOFFSETTO", formatOffset(offsetTo))
+	w.Text("TZNAME", name)
+	w.End(component)
+}
+
+// offsetChanges returns the instants in (from, to] when the offset of loc
+// changes, to the second. Zones don't change twice in a day.
+func offsetChanges(loc *time.Location, from time.Time, to time.Time) []time.Time {
+
+	changes := []time.Time{}
+	// whole seconds, so the search below ends
+	for day := from.Truncate(time.Second); day.Before(to); day = day.Add(24 * time.Hour) {
+		next := day.Add(24 * time.Hour)
+		if offset(day, loc) == offset(next, loc) {
+			continue
+		}
+
+		// the first second at the new offset
+		before, after := day, next
+		for after.Sub(before) > time.Second {
+			middle := before.Add(after.Sub(before) / 2).Truncate(time.Second)
+			if offset(middle, loc) == offset(before, loc) {
+				before = middle
+			} else {
+				after = middle
+			}
+		}
+		if after.After(to) {
+			break
+		}
+		changes = append(changes, after.In(loc))
+	}
+
+	return changes
+}
+
+func offset(t time.Time, loc *time.Location) int {
+	_, offset := t.In(loc).Zone()
+	return offset
+}
+
+// formatOffset formats a UTC-OFFSET, e.g. +0100 or -0930.
+func formatOffset(seconds int) string {
+
+	sign := "+"
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+
+	hours, minutes, seconds := seconds/3600, seconds/60%60, seconds%60
+	formatted := sign + twoDigits(hours) + twoDigits(minutes)
+	if seconds > 0 {
+		formatted += twoDigits(seconds)
+	}
+
+	return formatted
+}
+
+func twoDigits(n int) string {
+	if n < 10 {
+		return "0" + strconv.Itoa(n)
+	}
+	return strconv.Itoa(n)
+}
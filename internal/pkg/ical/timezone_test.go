@@ -0,0 +1,131 @@
+package ical
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func loadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	return loc
+}
+
+func TestOffsetChanges(t *testing.T) {
+	paris := loadLocation(t, "Europe/Paris")
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	changes := offsetChanges(paris, from, from.AddDate(1, 0, 0))
+
+	want := []time.Time{
+		time.Date(2026, 3, 29, 1, 0, 0, 0, time.UTC),
+		time.Date(2026, 10, 25, 1, 0, 0, 0, time.UTC),
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("changes %v, want %v", changes, want)
+	}
+	for i := range want {
+		if !changes[i].Equal(want[i]) {
+			t.Fatalf("change %d at %v, want %v", i, changes[i], want[i])
+		}
+	}
+
+	if changes := offsetChanges(time.UTC, from, from.AddDate(1, 0, 0)); len(changes) != 0 {
+		t.Fatalf("UTC changes %v", changes)
+	}
+}
+
+func TestTimezone(t *testing.T) {
+	paris := loadLocation(t, "Europe/Paris")
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, "-//test//EN")
+	w.Timezone(paris, from, from.AddDate(1, 0, 0))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"BEGIN:VTIMEZONE\r\nTZID:Europe/Paris\r\n",
+		"BEGIN:STANDARD\r\nDTSTART:20260101T010000\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0100\r\nTZNAME:CET\r\nEND:STANDARD\r\n",
+		"BEGIN:DAYLIGHT\r\nDTSTART:20260329T020000\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0200\r\nTZNAME:CEST\r\nEND:DAYLIGHT\r\n",
+		"BEGIN:STANDARD\r\nDTSTART:20261025T030000\r\nTZOFFSETFROM:+0200\r\nTZOFFSETTO:+0100\r\nTZNAME:CET\r\nEND:STANDARD\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+}
+
+func TestLocalTime(t *testing.T) {
+	paris := loadLocation(t, "Europe/Paris")
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want string
+	}{
+		{"winter", time.Date(2026, 1, 2, 14, 4, 5, 0, time.UTC), "DUE;TZID=Europe/Paris:20260102T150405"},
+		{"summer", time.Date(2026, 7, 2, 13, 4, 5, 0, time.UTC), "DUE;TZID=Europe/Paris:20260702T150405"},
+		// 02:30 happens twice on 2026-10-25
+		{"first of a repeated hour", time.Date(2026, 10, 25, 0, 30, 0, 0, time.UTC), "DUE:20261025T003000Z"},
+		{"second of a repeated hour", time.Date(2026, 10, 25, 1, 30, 0, 0, time.UTC), "DUE:20261025T013000Z"},
+		{"after the repeated hour", time.Date(2026, 10, 25, 2, 0, 0, 0, time.UTC), "DUE;TZID=Europe/Paris:20261025T030000"},
+		// 02:30 doesn't exist on 2026-03-29, 01:59 is the last minute before
+		{"before the skipped hour", time.Date(2026, 3, 29, 0, 59, 0, 0, time.UTC), "DUE;TZID=Europe/Paris:20260329T015900"},
+		{"after the skipped hour", time.Date(2026, 3, 29, 1, 0, 0, 0, time.UTC), "DUE;TZID=Europe/Paris:20260329T030000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := &Writer{w: bufio.NewWriter(&buf)}
+			w.LocalTime("DUE", tt.t, paris)
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := strings.TrimSuffix(buf.String(), "\r\n"); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+
+			components, err := Parse(strings.NewReader("BEGIN:VTODO\r\n" + buf.String() + "END:VTODO\r\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			due, _ := components[0].Get("DUE")
+			parsed, _, err := ParseTime(due, time.UTC)
+			if err != nil || !parsed.Equal(tt.t) {
+				t.Fatalf("read back as %v (%v), want %v", parsed, err, tt.t)
+			}
+		})
+	}
+}
+
+func TestFormatOffset(t *testing.T) {
+	tests := []struct {
+		seconds int
+		want    string
+	}{
+		{0, "+0000"},
+		{3600, "+0100"},
+		{-9*3600 - 30*60, "-0930"},
+		{5*3600 + 45*60, "+0545"},
+		{-(36*60 + 40), "-003640"},
+	}
+
+	for _, tt := range tests {
+		if got := formatOffset(tt.seconds); got != tt.want {
+			t.Errorf("%d: got %s, want %s", tt.seconds, got, tt.want)
+		}
+	}
+}
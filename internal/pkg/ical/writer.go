@@ -0,0 +1,159 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxLineOctets is the longest content line RFC 5545 allows before folding.
+const maxLineOctets = 75
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// Writer writes an iCalendar stream: CRLF line endings and lines folded at
+// 75 octets. The first write error is kept and returned by Close.
+type Writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+// NewWriter starts a VCALENDAR object.
+func NewWriter(w io.Writer, prodID string) *Writer {
+
+	cw := &Writer{w: bufio.NewWriter(w)}
+	cw.Begin("VCALENDAR")
+	cw.Value("VERSION", "2.0")
+	cw.Text("PRODID", prodID)
+	cw.Value("CALSCALE", "GREGORIAN")
+
+	return cw
+}
+
+func (w *Writer) Begin(component string) {
+	w.Value("BEGIN", component)
+}
+
+func (w *Writer) End(component string) {
+	w.Value("END", component)
+}
+
+// Text writes a TEXT property, escaped.
+func (w *Writer) Text(name string, value string) {
+	w.Value(name, EscapeText(value))
+}
+
+// TextList writes a property holding several TEXT values, like
+// CATEGORIES.
+func (w *Writer) TextList(name string, values []string) {
+
+	escaped := make([]string, len(values))
+	for i, value := range values {
+		escaped[i] = EscapeText(value)
+	}
+
+	w.Value(name, strings.Join(escaped, ","))
+}
+
+// Time writes a DATE-TIME property in UTC.
+func (w *Writer) Time(name string, t time.Time) {
+	w.Value(name, FormatTime(t))
+}
+
+// Value writes a property as is. Name may carry parameters, e.g.
+// "DTSTART;VALUE=DATE".
+func (w *Writer) Value(name string, value string) {
+	w.line(name + ":" + value)
+}
+
+// Flush writes the buffered lines.
+func (w *Writer) Flush() error {
+	if w.err == nil {
+		w.err = w.w.Flush()
+	}
+
+	return w.err
+}
+
+// Close ends the VCALENDAR object and flushes it.
+func (w *Writer) Close() error {
+	w.End("VCALENDAR")
+	return w.Flush()
+}
+
+func (w *Writer) line(line string) {
+	if w.err != nil {
+		return
+	}
+
+	// continuation lines start with a space, which counts in their length
+	for len(line) > maxLineOctets {
+		cut := foldAt(line, maxLineOctets)
+		if _, w.err = w.w.WriteString(line[:cut] + "\r\n"); w.err != nil {
+			return
+		}
+		line = " " + line[cut:]
+	}
+
+	_, w.err = w.w.WriteString(line + "\r\n")
+}
+
+// foldAt returns where to cut line to keep at most max octets without
+// splitting a UTF-8 sequence.
+func foldAt(line string, max int) int {
+
+	cut := max
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+
+	return cut
+}
+
+// EscapeText escapes a TEXT value.
+func EscapeText(value string) string {
+	return textEscaper.Replace(value)
+}
+
+// FormatTime formats a DATE-TIME in UTC, e.g. 20260102T030405Z.
+func FormatTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// FormatDate formats a DATE, e.g. 20260102.
+func FormatDate(t time.Time) string {
+	return t.Format("20060102")
+}
+
+// FormatDuration formats a positive DURATION to the second, e.g. PT1H30M or
+// P1DT12H.
+func FormatDuration(d time.Duration) string {
+
+	seconds := int64(d / time.Second)
+	days, seconds := seconds/86400, seconds%86400
+	hours, seconds := seconds/3600, seconds%3600
+	minutes, seconds := seconds/60, seconds%60
+
+	var b strings.Builder
+	b.WriteString("P")
+	if days > 0 {
+		fmt.Fprintf(&b, "%dD", days)
+	}
+	if hours > 0 || minutes > 0 || seconds > 0 || days == 0 {
+		b.WriteString("T")
+		if hours > 0 {
+			fmt.Fprintf(&b, "%dH", hours)
+		}
+		if minutes > 0 {
+			fmt.Fprintf(&b, "%dM", minutes)
+		}
+		if seconds > 0 || (hours == 0 && minutes == 0) {
+			fmt.Fprintf(&b, "%dS", seconds)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,118 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"todo-app-mongo/internal/config"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers transactional emails.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+func New(cfg config.Mailer) (Mailer, error) {
+	switch cfg.Driver {
+	case "log":
+		return NewLogMailer(cfg.From), nil
+	case "file":
+		return NewFileMailer(cfg.From, cfg.Dir)
+	case "smtp":
+		return NewSMTPMailer(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer driver %q", cfg.Driver)
+	}
+}
+
+type logMailer struct {
+	from string
+}
+
+// NewLogMailer writes emails to the application log instead of sending
+// them, for local development.
+func NewLogMailer(from string) Mailer {
+	return &logMailer{from: from}
+}
+
+func (l *logMailer) Send(_ context.Context, msg Message) error {
+	log.Printf("mail from=%s to=%s subject=%q\n%s", l.from, msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+type fileMailer struct {
+	from string
+	dir  string
+}
+
+// NewFileMailer writes every email as an .eml file in dir, so local runs
+// and tests can read what would have been sent.
+func NewFileMailer(from string, dir string) (Mailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &fileMailer{from: from, dir: dir}, nil
+}
+
+func (f *fileMailer) Send(_ context.Context, msg Message) error {
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), sanitize(msg.To))
+	return os.WriteFile(filepath.Join(f.dir, name), format(f.from, msg), 0o600)
+}
+
+type smtpMailer struct {
+	from string
+	addr string
+	auth smtp.Auth
+}
+
+func NewSMTPMailer(cfg config.Mailer) Mailer {
+	var auth smtp.Auth
+	if cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+
+	return &smtpMailer{
+		from: cfg.From,
+		addr: net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort)),
+		auth: auth,
+	}
+}
+
+func (s *smtpMailer) Send(_ context.Context, msg Message) error {
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{msg.To}, format(s.from, msg))
+}
+
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return []byte(b.String())
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, s)
+}
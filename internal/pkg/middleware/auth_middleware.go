@@ -1,14 +1,22 @@
 package middleware
 
 import (
+	"log"
 	"strings"
+	"time"
+	"todo-app-mongo/internal/database"
+	"todo-app-mongo/internal/entity"
 	"todo-app-mongo/internal/pkg/security"
 	"todo-app-mongo/internal/pkg/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware authenticates the request with a JWT or, on routes that
+// name the scopes they need, a personal access token granted all of them.
+// Routes without scopes only accept JWTs, so access tokens can't manage the
+// account they belong to.
+func AuthMiddleware(userJWT security.UserJWTInterface, accessTokens database.AccessTokenDAOInterface, userDAO database.UserDAOInterface, scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		tokenString := c.GetHeader("Authorization")
@@ -21,7 +29,27 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		tokenString = strings.Replace(tokenString, "Bearer ", "", 1)
 
-		email, err := security.ValidateToken(tokenString)
+		if security.IsAccessToken(tokenString) {
+			if len(scopes) == 0 {
+				utils.DefaultErrorResponse(c, 403, "Personal access tokens can't be used on this route")
+				c.Abort()
+				return
+			}
+
+			user, status, message := authenticateAccessToken(c, accessTokens, userDAO, tokenString, scopes)
+			if status != 0 {
+				utils.DefaultErrorResponse(c, status, message)
+				c.Abort()
+				return
+			}
+
+			c.Set("email", user.Email)
+			c.Set("role", user.EffectiveRole())
+			c.Next()
+			return
+		}
+
+		claims, err := userJWT.ValidateToken(tokenString)
 
 		if err != nil {
 			utils.DefaultErrorResponse(c, 401, "Unauthorized")
@@ -29,8 +57,58 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		c.Set("email", email)
+		// the user is read again so revocations, disabled accounts and role
+		// changes apply at once, on every replica
+		user, err := userDAO.GetByEmail(c, claims.Email)
+		if err != nil || user.Removed || user.Disabled || user.TokenRevoked(claims.IssuedAtMs) {
+			utils.DefaultErrorResponse(c, 401, "Unauthorized")
+			c.Abort()
+			return
+		}
+
+		c.Set("email", user.Email)
+		c.Set("role", user.EffectiveRole())
 
 		c.Next()
 	}
 }
+
+// authenticateAccessToken returns the owner of the token, or the status
+// and message to answer with.
+func authenticateAccessToken(c *gin.Context, accessTokens database.AccessTokenDAOInterface, userDAO database.UserDAOInterface, tokenString string, scopes []string) (*entity.User, int, string) {
+
+	prefix, ok := security.AccessTokenPrefixOf(tokenString)
+	if !ok {
+		return nil, 401, "Unauthorized"
+	}
+
+	token, err := accessTokens.GetByPrefix(c, prefix)
+	if err != nil || !security.VerifyAccessToken(tokenString, token.TokenHash) {
+		return nil, 401, "Unauthorized"
+	}
+
+	now := time.Now()
+	if token.IsExpired(now) {
+		return nil, 401, "Personal access token expired"
+	}
+
+	for _, scope := range scopes {
+		if !token.HasScope(scope) {
+			return nil, 403, "Personal access token lacks the " + scope + " scope"
+		}
+	}
+
+	// the email can change, so it is read from the owner each time
+	user, err := userDAO.GetById(c, token.UserID.Hex())
+	if err != nil || user.Removed || user.Disabled {
+		return nil, 401, "Unauthorized"
+	}
+
+	if err := accessTokens.Touch(c, token.ID, now); err != nil {
+		log.Printf("recording access token use: %v", err)
+	}
+
+	c.Set("access_token_id", token.ID.Hex())
+
+	return user, 0, ""
+}
@@ -1,32 +1,27 @@
 package middleware
 
 import (
-	"os"
-	"strings"
 	"time"
+	"todo-app-mongo/internal/config"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	_ "github.com/joho/godotenv/autoload"
 )
 
-func CorsMiddleware() gin.HandlerFunc {
-	allowedOrigins := os.Getenv("ALLOWED_ORIGINS")
-	if allowedOrigins == "" {
-		allowedOrigins = "*"
-	}
-
+func CorsMiddleware(cfg config.CORS) gin.HandlerFunc {
 	config := cors.DefaultConfig()
-	config.AllowOrigins = strings.Split(allowedOrigins, ";")
+	config.AllowOrigins = cfg.AllowedOrigins
 	config.AllowMethods = []string{"GET", "POST", "PATCH", "PUT", "DELETE", "OPTIONS"}
 	config.AllowHeaders = []string{
 		"Authorization",
-        "Refresh",
+		"Refresh",
 		"Content-Type",
 		"Origin",
 		"Referer",
+		"If-Match",
+		"If-None-Match",
 	}
-	config.ExposeHeaders = []string{"Access-Control-Allow-Origin"}
+	config.ExposeHeaders = []string{"Access-Control-Allow-Origin", "ETag"}
 	config.AllowCredentials = true
 	config.MaxAge = 300 * time.Second
 
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"todo-app-mongo/internal/pkg/ratelimit"
+	"todo-app-mongo/internal/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitKey identifies who a request is counted against.
+type RateLimitKey func(c *gin.Context) string
+
+// ByIP counts anonymous requests against the client address.
+func ByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// ByUser counts authenticated requests against the email set by
+// AuthMiddleware, falling back to the client address.
+func ByUser(c *gin.Context) string {
+	if email := c.GetString("email"); email != "" {
+		return "user:" + email
+	}
+	return ByIP(c)
+}
+
+// rateLimitCharge is the context key of the function taking more tokens
+// from the bucket a request was counted against.
+const rateLimitCharge = "rate_limit_charge"
+
+// RateLimitMiddleware throttles a route group with a token bucket per key.
+// Buckets of different groups are independent. When the store fails the
+// request is let through rather than taking the API down with it.
+func RateLimitMiddleware(store ratelimit.Store, group string, rate ratelimit.Rate, key RateLimitKey) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		bucket := group + ":" + key(c)
+		if !takeTokens(c, store, bucket, rate, 1) {
+			c.Abort()
+			return
+		}
+
+		c.Set(rateLimitCharge, func(n int) bool {
+			// a request never costs more than the bucket holds, so a
+			// full bucket always lets it through
+			n = min(n, rate.Requests-1)
+			return n <= 0 || takeTokens(c, store, bucket, rate, n)
+		})
+
+		c.Next()
+	}
+}
+
+// ChargeRateLimit counts a request doing the work of n more, e.g. a batch
+// of operations, against the bucket RateLimitMiddleware took its token
+// from. When the bucket runs out it answers 429 and returns false. Without
+// rate limiting it does nothing.
+func ChargeRateLimit(c *gin.Context, n int) bool {
+
+	charge, ok := c.Get(rateLimitCharge)
+	if !ok {
+		return true
+	}
+
+	return charge.(func(n int) bool)(n)
+}
+
+// takeTokens takes n tokens from the bucket and sets the rate limit
+// headers. When the bucket runs out it answers 429 and returns false.
+func takeTokens(c *gin.Context, store ratelimit.Store, bucket string, rate ratelimit.Rate, n int) bool {
+
+	result, err := store.Take(c, bucket, rate, n)
+	if err != nil {
+		log.Printf("rate limit store: %v", err)
+		return true
+	}
+
+	c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+
+	if !result.Allowed {
+		c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+		utils.DefaultErrorResponse(c, http.StatusTooManyRequests, "Too many requests")
+		return false
+	}
+
+	return true
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"todo-app-mongo/internal/pkg/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newRateLimitedRouter(t *testing.T, trustedProxies []string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		t.Fatal(err)
+	}
+
+	limit := RateLimitMiddleware(ratelimit.NewMemoryStore(), "test", ratelimit.Rate{Requests: 1, Period: time.Minute}, ByIP)
+	r.GET("/", limit, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	return r
+}
+
+func get(r *gin.Engine, forwardedFor string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	r := newRateLimitedRouter(t, nil)
+
+	w := get(r, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("first request: status %d", w.Code)
+	}
+	if w.Header().Get("RateLimit-Limit") != "1" || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("headers %v", w.Header())
+	}
+
+	w = get(r, "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: status %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "60" {
+		t.Fatalf("Retry-After %q", w.Header().Get("Retry-After"))
+	}
+}
+
+func TestRateLimitMiddlewareForwardedFor(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		// limited tells whether a second request from the same peer with
+		// another X-Forwarded-For is counted against the same client.
+		limited bool
+	}{
+		{"no trusted proxy", nil, true},
+		{"trusted proxy", []string{"10.0.0.0/8"}, false},
+		{"other proxy", []string{"192.168.0.1"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRateLimitedRouter(t, tt.trustedProxies)
+
+			if w := get(r, "203.0.113.1"); w.Code != http.StatusOK {
+				t.Fatalf("first request: status %d", w.Code)
+			}
+
+			w := get(r, "203.0.113.2")
+			if limited := w.Code == http.StatusTooManyRequests; limited != tt.limited {
+				t.Fatalf("second request: status %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestChargeRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	limit := RateLimitMiddleware(ratelimit.NewMemoryStore(), "test", ratelimit.Rate{Requests: 5, Period: time.Hour}, ByIP)
+	r.GET("/", limit, func(c *gin.Context) {
+		n, _ := strconv.Atoi(c.Query("n"))
+		if !ChargeRateLimit(c, n) {
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name      string
+		n         string
+		status    int
+		remaining string
+	}{
+		{"batch", "2", http.StatusOK, "2"},
+		{"batch over the remaining tokens", "2", http.StatusTooManyRequests, "1"},
+		{"single", "0", http.StatusOK, "0"},
+		{"bucket empty", "0", http.StatusTooManyRequests, "0"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/?n="+tt.n, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != tt.status || w.Header().Get("RateLimit-Remaining") != tt.remaining {
+			t.Fatalf("%s: status %d, remaining %q", tt.name, w.Code, w.Header().Get("RateLimit-Remaining"))
+		}
+	}
+}
+
+func TestChargeRateLimitCappedAtCapacity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	limit := RateLimitMiddleware(ratelimit.NewMemoryStore(), "test", ratelimit.Rate{Requests: 3, Period: time.Hour}, ByIP)
+	r.GET("/", limit, func(c *gin.Context) {
+		if !ChargeRateLimit(c, 99) {
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("status %d, remaining %q", w.Code, w.Header().Get("RateLimit-Remaining"))
+	}
+}
+
+func TestChargeRateLimitDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	if !ChargeRateLimit(c, 10) {
+		t.Fatal("charge refused without rate limiting")
+	}
+}
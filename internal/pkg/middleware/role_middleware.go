@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"slices"
+	"todo-app-mongo/internal/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole only lets through users with one of the roles. It must run
+// after AuthMiddleware, which reads the role from the user.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if !slices.Contains(roles, c.GetString("role")) {
+			utils.DefaultErrorResponse(c, 403, "Forbidden")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
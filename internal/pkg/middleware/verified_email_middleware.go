@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"todo-app-mongo/internal/config"
+	"todo-app-mongo/internal/database"
+	"todo-app-mongo/internal/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VerifiedEmailMiddleware enforces the read_only verification policy:
+// users who haven't verified their email can only read. It must run after
+// AuthMiddleware.
+func VerifiedEmailMiddleware(userDAO database.UserDAOInterface, policy string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		if policy != config.VerificationPolicyReadOnly || c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		user, err := userDAO.GetByEmail(c, c.GetString("email"))
+		if err != nil {
+			utils.DefaultErrorResponse(c, 401, "Unauthorized")
+			c.Abort()
+			return
+		}
+
+		if !user.EmailVerified {
+			utils.DefaultErrorResponse(c, 403, "Verify your email address to make changes")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
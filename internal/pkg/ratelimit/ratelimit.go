@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Rate allows Requests per Period, refilled continuously (token bucket with
+// a capacity of Requests).
+type Rate struct {
+	Requests int
+	Period   time.Duration
+}
+
+// perSecond is the refill speed of the bucket in tokens per second.
+func (r Rate) perSecond() float64 {
+	return float64(r.Requests) / r.Period.Seconds()
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is the wait until the tokens asked for, zero when allowed.
+	RetryAfter time.Duration
+	// ResetAfter is the wait until the bucket is full again.
+	ResetAfter time.Duration
+}
+
+// Store takes n tokens from the bucket identified by key, or none when it
+// holds fewer. Implementations must be safe for concurrent use; shared
+// stores let several replicas enforce the same limit.
+type Store interface {
+	Take(ctx context.Context, key string, rate Rate, n int) (Result, error)
+}
+
+// NewResult builds the result of a take of n tokens from the tokens left in
+// the bucket.
+func NewResult(rate Rate, tokens float64, n int, allowed bool) Result {
+	perSecond := rate.perSecond()
+
+	result := Result{
+		Allowed:    allowed,
+		Limit:      rate.Requests,
+		Remaining:  int(math.Floor(tokens)),
+		ResetAfter: secondsToDuration((float64(rate.Requests) - tokens) / perSecond),
+	}
+	if !allowed {
+		result.RetryAfter = secondsToDuration((float64(n) - tokens) / perSecond)
+	}
+
+	return result
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	if seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	period  time.Duration
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	sweptAt time.Time
+}
+
+// NewMemoryStore keeps buckets in process memory, enough for a single
+// replica.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		buckets: map[string]*bucket{},
+		sweptAt: time.Now(),
+	}
+}
+
+func (m *memoryStore) Take(_ context.Context, key string, rate Rate, n int) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rate.Requests), updated: now, period: rate.Period}
+		m.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(rate.Requests), b.tokens+now.Sub(b.updated).Seconds()*rate.perSecond())
+	b.updated = now
+
+	allowed := b.tokens >= float64(n)
+	if allowed {
+		b.tokens -= float64(n)
+	}
+
+	return NewResult(rate, b.tokens, n, allowed), nil
+}
+
+// sweep drops buckets idle for longer than a period, they are full again
+// and equivalent to a missing one.
+func (m *memoryStore) sweep(now time.Time) {
+	if now.Sub(m.sweptAt) < time.Minute {
+		return
+	}
+	m.sweptAt = now
+
+	for key, b := range m.buckets {
+		if now.Sub(b.updated) > b.period {
+			delete(m.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	store := NewMemoryStore()
+	rate := Rate{Requests: 3, Period: time.Hour}
+
+	for i := 2; i >= 0; i-- {
+		result, err := store.Take(context.Background(), "key", rate, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Allowed || result.Remaining != i || result.Limit != 3 {
+			t.Fatalf("take %d: got %+v", 3-i, result)
+		}
+		if result.RetryAfter != 0 {
+			t.Fatalf("allowed take with a retry after: %+v", result)
+		}
+	}
+
+	result, err := store.Take(context.Background(), "key", rate, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Allowed || result.Remaining != 0 {
+		t.Fatalf("take over the limit: got %+v", result)
+	}
+	if result.RetryAfter <= 0 || result.RetryAfter > rate.Period/3 {
+		t.Fatalf("retry after %v, want a third of the period at most", result.RetryAfter)
+	}
+
+	other, err := store.Take(context.Background(), "other", rate, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !other.Allowed {
+		t.Fatal("buckets of different keys are not independent")
+	}
+}
+
+func TestMemoryStoreRefill(t *testing.T) {
+	store := NewMemoryStore()
+	rate := Rate{Requests: 1, Period: 20 * time.Millisecond}
+
+	if result, _ := store.Take(context.Background(), "key", rate, 1); !result.Allowed {
+		t.Fatal("first take refused")
+	}
+	if result, _ := store.Take(context.Background(), "key", rate, 1); result.Allowed {
+		t.Fatal("second take allowed before the refill")
+	}
+
+	time.Sleep(rate.Period)
+
+	if result, _ := store.Take(context.Background(), "key", rate, 1); !result.Allowed {
+		t.Fatal("take refused after a period")
+	}
+}
+
+func TestNewResult(t *testing.T) {
+	rate := Rate{Requests: 10, Period: 10 * time.Second}
+
+	tests := []struct {
+		name       string
+		tokens     float64
+		n          int
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+		resetAfter time.Duration
+	}{
+		{"full", 10, 1, true, 10, 0, 0},
+		{"partial", 4.5, 1, true, 4, 0, 5500 * time.Millisecond},
+		{"empty", 0.25, 1, false, 0, 750 * time.Millisecond, 9750 * time.Millisecond},
+		{"short of several", 4.5, 6, false, 4, 1500 * time.Millisecond, 5500 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := NewResult(rate, tt.tokens, tt.n, tt.allowed)
+			if result.Allowed != tt.allowed || result.Remaining != tt.remaining {
+				t.Fatalf("got %+v", result)
+			}
+			if result.RetryAfter != tt.retryAfter {
+				t.Fatalf("retry after %v, want %v", result.RetryAfter, tt.retryAfter)
+			}
+			if result.ResetAfter != tt.resetAfter {
+				t.Fatalf("reset after %v, want %v", result.ResetAfter, tt.resetAfter)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreTakeSeveral(t *testing.T) {
+	store := NewMemoryStore()
+	rate := Rate{Requests: 5, Period: time.Hour}
+
+	if result, _ := store.Take(context.Background(), "key", rate, 3); !result.Allowed || result.Remaining != 2 {
+		t.Fatalf("take of 3: got %+v", result)
+	}
+
+	result, _ := store.Take(context.Background(), "key", rate, 3)
+	if result.Allowed || result.Remaining != 2 {
+		t.Fatalf("take of 3 out of 2: got %+v", result)
+	}
+
+	// a refused take leaves the tokens
+	if result, _ := store.Take(context.Background(), "key", rate, 2); !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("take of 2: got %+v", result)
+	}
+}
@@ -0,0 +1,54 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// AccessTokenPrefix starts every personal access token, so they are told
+// apart from JWTs and easy to spot by secret scanners.
+const AccessTokenPrefix = "tdp_"
+
+const accessTokenIDLength = 12
+
+// NewAccessToken returns a personal access token, "tdp_<id>_<secret>",
+// its lookup prefix "tdp_<id>" and the hash to store.
+func NewAccessToken() (string, string, string, error) {
+
+	id := make([]byte, accessTokenIDLength/2)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", "", err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+
+	prefix := AccessTokenPrefix + hex.EncodeToString(id)
+	token := prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+
+	return token, prefix, HashOpaqueToken(token), nil
+}
+
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, AccessTokenPrefix)
+}
+
+// AccessTokenPrefixOf returns the lookup prefix of a token.
+func AccessTokenPrefixOf(token string) (string, bool) {
+	n := len(AccessTokenPrefix) + accessTokenIDLength
+	if !IsAccessToken(token) || len(token) <= n+1 || token[n] != '_' {
+		return "", false
+	}
+
+	return token[:n], true
+}
+
+// VerifyAccessToken compares a token with a stored hash in constant time.
+func VerifyAccessToken(token string, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashOpaqueToken(token)), []byte(hash)) == 1
+}
@@ -0,0 +1,65 @@
+package security
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestNewAccessToken(t *testing.T) {
+	token, prefix, hash, err := NewAccessToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !regexp.MustCompile(`^tdp_[0-9a-f]{12}_[A-Za-z0-9_-]{43}$`).MatchString(token) {
+		t.Fatalf("token %q", token)
+	}
+	if !IsAccessToken(token) {
+		t.Fatal("IsAccessToken refused a new token")
+	}
+
+	lookup, ok := AccessTokenPrefixOf(token)
+	if !ok || lookup != prefix {
+		t.Fatalf("prefix %q, %v; want %q", lookup, ok, prefix)
+	}
+
+	if !VerifyAccessToken(token, hash) {
+		t.Fatal("token doesn't match its hash")
+	}
+	if VerifyAccessToken(token+"x", hash) {
+		t.Fatal("another token matches the hash")
+	}
+
+	other, otherPrefix, _, _ := NewAccessToken()
+	if other == token || otherPrefix == prefix {
+		t.Fatal("two tokens are equal")
+	}
+}
+
+func TestAccessTokenPrefixOf(t *testing.T) {
+	tests := []struct {
+		token  string
+		prefix string
+		ok     bool
+	}{
+		{"tdp_0123456789ab_secret", "tdp_0123456789ab", true},
+		{"tdp_0123456789ab_", "", false},
+		{"tdp_0123456789ab", "", false},
+		{"tdp_0123456789abXsecret", "", false},
+		{"tdp_short_secret", "", false},
+		{"eyJhbGciOiJIUzI1NiJ9.e30.sig", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			prefix, ok := AccessTokenPrefixOf(tt.token)
+			if prefix != tt.prefix || ok != tt.ok {
+				t.Fatalf("got %q, %v; want %q, %v", prefix, ok, tt.prefix, tt.ok)
+			}
+		})
+	}
+
+	if IsAccessToken("eyJhbGciOiJIUzI1NiJ9.e30.sig") {
+		t.Fatal("a JWT is taken for an access token")
+	}
+}
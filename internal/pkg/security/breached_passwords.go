@@ -0,0 +1,151 @@
+package security
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// hash prefix length of the k-anonymity range, as in the Pwned Passwords API
+const breachedPrefixLength = 5
+
+// BreachedPasswords looks passwords up in a local copy of a breached
+// password list: one "SHA1:COUNT" line per password, sorted by hash, like
+// the single file written by the Pwned Passwords downloader. Only the lines
+// sharing the 5 character hash prefix are read, found by binary search, so
+// the file never needs to fit in memory.
+type BreachedPasswords struct {
+	path string
+}
+
+func NewBreachedPasswords(path string) (*BreachedPasswords, error) {
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("breached password file: %w", err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("breached password file: %s is a directory", path)
+	}
+
+	return &BreachedPasswords{path: path}, nil
+}
+
+// Count returns how many times the password appears in the list.
+func (b *BreachedPasswords) Count(password string) (int, error) {
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix := hash[:breachedPrefixLength]
+
+	file, err := os.Open(b.path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	start, err := searchRange(file, info.Size(), prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(file, start, info.Size()-start))
+	for {
+		line, _, err := readLine(reader)
+		if err == io.EOF {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		lineHash, count, _ := strings.Cut(line, ":")
+		lineHash = strings.ToUpper(lineHash)
+
+		if !strings.HasPrefix(lineHash, prefix) {
+			return 0, nil
+		}
+		if lineHash == hash {
+			n, err := strconv.Atoi(strings.TrimSpace(count))
+			if err != nil {
+				// a listed hash without a count still counts as breached
+				return 1, nil
+			}
+			return n, nil
+		}
+	}
+}
+
+// searchRange returns the offset of the first line whose hash is not lower
+// than prefix. Lines starting before lo are lower and lines starting at or
+// after hi are not.
+func searchRange(file io.ReaderAt, size int64, prefix string) (int64, error) {
+
+	lo, hi := int64(0), size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		start, err := nextLineStart(file, size, mid)
+		if err != nil {
+			return 0, err
+		}
+		if start >= hi {
+			hi = mid
+			continue
+		}
+
+		reader := bufio.NewReader(io.NewSectionReader(file, start, size-start))
+		line, n, err := readLine(reader)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		if strings.ToUpper(line) < prefix {
+			lo = start + int64(n)
+		} else {
+			hi = start
+		}
+	}
+
+	return lo, nil
+}
+
+// nextLineStart returns the offset of the first line starting at or after
+// offset.
+func nextLineStart(file io.ReaderAt, size int64, offset int64) (int64, error) {
+	if offset == 0 {
+		return 0, nil
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(file, offset-1, size-offset+1))
+	skipped, err := reader.ReadString('\n')
+	if err == io.EOF {
+		return size, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return offset - 1 + int64(len(skipped)), nil
+}
+
+// readLine reads a line without its line ending and returns the bytes it
+// takes in the file.
+func readLine(reader *bufio.Reader) (string, int, error) {
+	line, err := reader.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+
+	return strings.TrimRight(line, "\r\n"), len(line), err
+}
@@ -0,0 +1,140 @@
+package security
+
+import (
+	"context"
+	"sync"
+	"time"
+	"todo-app-mongo/internal/config"
+	"todo-app-mongo/internal/entity"
+
+	"github.com/patrickmn/go-cache"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LoginGuard slows down and blocks password guessing. Failures are counted
+// per client IP in memory and per account on the user record; unknown
+// emails get an in-memory record so they lock exactly like real accounts
+// and don't reveal which emails are registered.
+type LoginGuard struct {
+	cfg         config.Login
+	mu          sync.Mutex
+	ipFailures  *cache.Cache
+	unknown     *cache.Cache
+	hasher      PasswordHasher
+	dummyHashed string
+}
+
+func NewLoginGuard(cfg config.Login, hasher PasswordHasher) (*LoginGuard, error) {
+
+	// compared against when the email is unknown so both paths cost one
+	// hash with the current parameters
+	dummyHashed, err := hasher.Hash("not-a-real-password")
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginGuard{
+		cfg:         cfg,
+		ipFailures:  cache.New(cfg.IPWindow, 10*time.Minute),
+		unknown:     cache.New(cfg.MaxLockoutDuration, 10*time.Minute),
+		hasher:      hasher,
+		dummyHashed: dummyHashed,
+	}, nil
+}
+
+// IPBlocked reports how long the client IP must wait before trying again.
+func (g *LoginGuard) IPBlocked(ip string) (time.Duration, bool) {
+	count, expiresAt, found := g.ipFailures.GetWithExpiration(ip)
+	if !found || count.(int) < g.cfg.IPMaxAttempts {
+		return 0, false
+	}
+
+	return time.Until(expiresAt), true
+}
+
+// RecordIPFailure counts a failed attempt for the IP. The window restarts
+// with every failure so a steady stream of guesses stays blocked.
+func (g *LoginGuard) RecordIPFailure(ip string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	count := 0
+	if v, found := g.ipFailures.Get(ip); found {
+		count = v.(int)
+	}
+
+	g.ipFailures.Set(ip, count+1, cache.DefaultExpiration)
+}
+
+// UnknownLockout returns the in-memory lockout record of an email that has
+// no account.
+func (g *LoginGuard) UnknownLockout(email string) entity.LoginLockout {
+	if v, found := g.unknown.Get(email); found {
+		return v.(entity.LoginLockout)
+	}
+
+	return entity.LoginLockout{}
+}
+
+// CompareUnknown spends the same time as checking a real password and
+// always fails.
+func (g *LoginGuard) CompareUnknown(password string) bool {
+	_ = g.hasher.Verify(password, g.dummyHashed)
+	return false
+}
+
+// LockoutStore records failed logins on accounts atomically, so concurrent
+// guesses can't overwrite each other's counts.
+type LockoutStore interface {
+	RecordLoginFailure(ctx context.Context, id primitive.ObjectID, now time.Time, maxAttempts int, lockFor func(lockCount int) time.Duration) (entity.LoginLockout, bool, error)
+}
+
+// FailAccount records a failed attempt on the account of the user and
+// updates its lockout record. It reports whether the failure locked the
+// account and how long to hold the response. The delay grows exponentially
+// with consecutive failures and is longest on lockout.
+func (g *LoginGuard) FailAccount(ctx context.Context, store LockoutStore, user *entity.User, now time.Time) (bool, time.Duration, error) {
+	lockout, locked, err := store.RecordLoginFailure(ctx, user.ID, now, g.cfg.MaxAttempts, g.lockoutDuration)
+	if err != nil {
+		return false, 0, err
+	}
+
+	user.Lockout = lockout
+	return locked, g.failureDelay(lockout, locked), nil
+}
+
+// FailUnknown does the same as FailAccount for an email that has no account.
+func (g *LoginGuard) FailUnknown(email string, now time.Time) (bool, time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	lockout := g.UnknownLockout(email)
+	locked := lockout.Fail(now, g.cfg.MaxAttempts, g.lockoutDuration)
+	g.unknown.Set(email, lockout, cache.DefaultExpiration)
+
+	return locked, g.failureDelay(lockout, locked)
+}
+
+func (g *LoginGuard) failureDelay(lockout entity.LoginLockout, locked bool) time.Duration {
+	if locked || lockout.FailedAttempts == 0 {
+		return g.cfg.MaxFailureDelay
+	}
+
+	return backoff(g.cfg.FailureDelay, lockout.FailedAttempts-1, g.cfg.MaxFailureDelay)
+}
+
+func (g *LoginGuard) lockoutDuration(lockCount int) time.Duration {
+	return backoff(g.cfg.LockoutDuration, lockCount, g.cfg.MaxLockoutDuration)
+}
+
+func backoff(base time.Duration, exponent int, max time.Duration) time.Duration {
+	d := base
+	for i := 0; i < exponent && d < max; i++ {
+		d *= 2
+	}
+
+	if d > max {
+		return max
+	}
+	return d
+}
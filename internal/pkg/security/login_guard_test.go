@@ -0,0 +1,129 @@
+package security
+
+import (
+	"context"
+	"testing"
+	"time"
+	"todo-app-mongo/internal/config"
+	"todo-app-mongo/internal/entity"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type plainHasher struct{}
+
+func (plainHasher) Hash(password string) (string, error)        { return "plain:" + password, nil }
+func (plainHasher) Verify(password string, encoded string) bool { return encoded == "plain:"+password }
+func (plainHasher) NeedsRehash(string) bool                     { return false }
+
+// lockoutStore keeps the lockout record in memory the way the user DAO
+// does in the database.
+type lockoutStore struct {
+	lockout entity.LoginLockout
+}
+
+func (s *lockoutStore) RecordLoginFailure(_ context.Context, _ primitive.ObjectID, now time.Time, maxAttempts int, lockFor func(lockCount int) time.Duration) (entity.LoginLockout, bool, error) {
+	locked := s.lockout.Fail(now, maxAttempts, lockFor)
+	return s.lockout, locked, nil
+}
+
+func newTestLoginGuard(t *testing.T) *LoginGuard {
+	t.Helper()
+
+	guard, err := NewLoginGuard(config.Login{
+		MaxAttempts:        3,
+		LockoutDuration:    time.Minute,
+		MaxLockoutDuration: 4 * time.Minute,
+		FailureDelay:       100 * time.Millisecond,
+		MaxFailureDelay:    time.Second,
+		IPMaxAttempts:      2,
+		IPWindow:           time.Minute,
+	}, plainHasher{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return guard
+}
+
+func TestLoginGuardFailAccount(t *testing.T) {
+	guard := newTestLoginGuard(t)
+	store := &lockoutStore{}
+	user := &entity.User{ID: primitive.NewObjectID()}
+	now := time.Now()
+
+	wantDelays := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond}
+	for i, want := range wantDelays {
+		locked, delay, err := guard.FailAccount(context.Background(), store, user, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if locked || delay != want {
+			t.Fatalf("failure %d: locked %v, delay %v", i+1, locked, delay)
+		}
+		if user.Lockout.FailedAttempts != i+1 {
+			t.Fatalf("failure %d: %d failed attempts on the user", i+1, user.Lockout.FailedAttempts)
+		}
+	}
+
+	locked, delay, err := guard.FailAccount(context.Background(), store, user, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !locked || delay != time.Second {
+		t.Fatalf("last failure: locked %v, delay %v", locked, delay)
+	}
+	if !user.Lockout.IsLocked(now) || user.Lockout.LockedUntil != now.Add(time.Minute) {
+		t.Fatalf("user not locked for a minute: %+v", user.Lockout)
+	}
+
+	// the next lock lasts twice as long
+	for i := 0; i < 3; i++ {
+		locked, _, _ = guard.FailAccount(context.Background(), store, user, now)
+	}
+	if !locked || user.Lockout.LockedUntil != now.Add(2*time.Minute) {
+		t.Fatalf("second lock: %+v", user.Lockout)
+	}
+}
+
+func TestLoginGuardFailUnknown(t *testing.T) {
+	guard := newTestLoginGuard(t)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if locked, _ := guard.FailUnknown("nobody@example.com", now); locked {
+			t.Fatalf("failure %d locked the email", i+1)
+		}
+	}
+	if locked, _ := guard.FailUnknown("nobody@example.com", now); !locked {
+		t.Fatal("unknown email not locked at the limit")
+	}
+
+	if lockout := guard.UnknownLockout("nobody@example.com"); !lockout.IsLocked(now) {
+		t.Fatalf("lockout not kept: %+v", lockout)
+	}
+	if lockout := guard.UnknownLockout("other@example.com"); lockout.IsLocked(now) {
+		t.Fatal("other emails locked too")
+	}
+	if guard.CompareUnknown("not-a-real-password") {
+		t.Fatal("CompareUnknown accepted a password")
+	}
+}
+
+func TestLoginGuardIP(t *testing.T) {
+	guard := newTestLoginGuard(t)
+
+	guard.RecordIPFailure("203.0.113.1")
+	if _, blocked := guard.IPBlocked("203.0.113.1"); blocked {
+		t.Fatal("blocked before the limit")
+	}
+
+	guard.RecordIPFailure("203.0.113.1")
+	wait, blocked := guard.IPBlocked("203.0.113.1")
+	if !blocked || wait <= 0 || wait > time.Minute {
+		t.Fatalf("blocked %v, wait %v", blocked, wait)
+	}
+	if _, blocked := guard.IPBlocked("203.0.113.2"); blocked {
+		t.Fatal("other IPs blocked too")
+	}
+}
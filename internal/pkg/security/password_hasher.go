@@ -0,0 +1,156 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"todo-app-mongo/internal/config"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms.
+const (
+	HasherArgon2id = "argon2id"
+	HasherBcrypt   = "bcrypt"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+var errUnknownHash = errors.New("unknown password hash format")
+
+// PasswordHasher hashes new passwords with the configured algorithm and
+// verifies hashes of every supported one, so the algorithm or its cost can
+// change without invalidating stored passwords.
+//
+// argon2id hashes are PHC strings ($argon2id$v=19$m=...,t=...,p=...$salt$hash)
+// and bcrypt hashes keep their standard $2a$cost$ form; both record the
+// algorithm and the parameters they were made with.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password string, encoded string) bool
+	// NeedsRehash reports whether the hash was made with another algorithm
+	// or other parameters than the current ones.
+	NeedsRehash(encoded string) bool
+}
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	keyLength   uint32
+}
+
+type passwordHasher struct {
+	algorithm  string
+	bcryptCost int
+	argon2     argon2Params
+}
+
+func NewPasswordHasher(cfg config.Password) PasswordHasher {
+	return &passwordHasher{
+		algorithm:  cfg.Hasher,
+		bcryptCost: cfg.BcryptCost,
+		argon2: argon2Params{
+			memory:      uint32(cfg.Argon2Memory),
+			iterations:  uint32(cfg.Argon2Iterations),
+			parallelism: uint8(cfg.Argon2Parallelism),
+			keyLength:   argon2KeyLength,
+		},
+	}
+}
+
+func (h *passwordHasher) Hash(password string) (string, error) {
+
+	if h.algorithm == HasherBcrypt {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hashed), nil
+	}
+
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	p := h.argon2
+	key := argon2.IDKey([]byte(password), salt, p.iterations, p.memory, p.parallelism, p.keyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.memory, p.iterations, p.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *passwordHasher) Verify(password string, encoded string) bool {
+
+	if isBcrypt(encoded) {
+		return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) == nil
+	}
+
+	p, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false
+	}
+
+	computed := argon2.IDKey([]byte(password), salt, p.iterations, p.memory, p.parallelism, p.keyLength)
+	return subtle.ConstantTimeCompare(computed, key) == 1
+}
+
+func (h *passwordHasher) NeedsRehash(encoded string) bool {
+
+	if isBcrypt(encoded) {
+		cost, err := bcrypt.Cost([]byte(encoded))
+		return h.algorithm != HasherBcrypt || err != nil || cost != h.bcryptCost
+	}
+
+	p, _, _, err := decodeArgon2id(encoded)
+	return h.algorithm != HasherArgon2id || err != nil || p != h.argon2
+}
+
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func decodeArgon2id(encoded string) (argon2Params, []byte, []byte, error) {
+
+	var p argon2Params
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != HasherArgon2id {
+		return p, nil, nil, errUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2 parameters %q", parts[3])
+	}
+	if p.memory < 1 || p.iterations < 1 || p.parallelism < 1 {
+		return p, nil, nil, fmt.Errorf("invalid argon2 parameters %q", parts[3])
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, err
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return p, nil, nil, err
+	}
+	p.keyLength = uint32(len(key))
+
+	return p, salt, key, nil
+}
@@ -0,0 +1,141 @@
+package security
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"todo-app-mongo/internal/config"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Password policy rules, reported in PolicyViolation.Rule.
+const (
+	RuleMinLength    = "min_length"
+	RuleMaxLength    = "max_length"
+	RuleLowercase    = "lowercase"
+	RuleUppercase    = "uppercase"
+	RuleDigit        = "digit"
+	RuleSymbol       = "symbol"
+	RulePersonalInfo = "personal_info"
+	RuleBreached     = "breached"
+)
+
+// personal info shorter than this is too common to reject on
+const minPersonalInfoLength = 3
+
+type PolicyViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every rule a password breaks.
+type PasswordPolicyError struct {
+	Violations []PolicyViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// PasswordPolicy decides which passwords users may choose.
+type PasswordPolicy struct {
+	cfg      config.Password
+	breached *BreachedPasswords
+}
+
+func NewPasswordPolicy(cfg config.Password) (*PasswordPolicy, error) {
+
+	policy := &PasswordPolicy{cfg: cfg}
+
+	if cfg.BreachedFile != "" {
+		breached, err := NewBreachedPasswords(cfg.BreachedFile)
+		if err != nil {
+			return nil, err
+		}
+		policy.breached = breached
+	}
+
+	return policy, nil
+}
+
+// Check returns a *PasswordPolicyError when the password breaks any rule.
+// The email and name of the account are used to reject passwords built
+// from them.
+func (p *PasswordPolicy) Check(password string, email string, name string) error {
+
+	var violations []PolicyViolation
+	fail := func(rule string, format string, args ...any) {
+		violations = append(violations, PolicyViolation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if utf8.RuneCountInString(password) < p.cfg.MinLength {
+		fail(RuleMinLength, "password must be at least %d characters long", p.cfg.MinLength)
+	}
+	// bcrypt ignores everything after 72 bytes and argon2id hashes the
+	// whole password, however long
+	if len(password) > p.cfg.MaxLength {
+		fail(RuleMaxLength, "password must be at most %d bytes long", p.cfg.MaxLength)
+	}
+
+	if p.cfg.RequireLowercase && !strings.ContainsFunc(password, unicode.IsLower) {
+		fail(RuleLowercase, "password must contain a lowercase letter")
+	}
+	if p.cfg.RequireUppercase && !strings.ContainsFunc(password, unicode.IsUpper) {
+		fail(RuleUppercase, "password must contain an uppercase letter")
+	}
+	if p.cfg.RequireDigit && !strings.ContainsFunc(password, unicode.IsDigit) {
+		fail(RuleDigit, "password must contain a digit")
+	}
+	if p.cfg.RequireSymbol && !strings.ContainsFunc(password, isSymbol) {
+		fail(RuleSymbol, "password must contain a symbol")
+	}
+
+	if p.cfg.RejectPersonalInfo && containsPersonalInfo(password, email, name) {
+		fail(RulePersonalInfo, "password must not contain your email or name")
+	}
+
+	// only worth a lookup when the password is acceptable otherwise
+	if len(violations) == 0 && p.breached != nil {
+		count, err := p.breached.Count(password)
+		if err != nil {
+			// an unreadable list shouldn't block signups and resets
+			log.Printf("breached password lookup: %v", err)
+		} else if count >= p.cfg.BreachedMinCount {
+			fail(RuleBreached, "password appears in a known data breach, choose another one")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+func isSymbol(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r)
+}
+
+func containsPersonalInfo(password string, email string, name string) bool {
+
+	password = strings.ToLower(password)
+
+	parts := strings.Fields(strings.ToLower(name))
+	if local, _, found := strings.Cut(strings.ToLower(email), "@"); found {
+		parts = append(parts, local)
+	}
+
+	for _, part := range parts {
+		if utf8.RuneCountInString(part) >= minPersonalInfoLength && strings.Contains(password, part) {
+			return true
+		}
+	}
+
+	return false
+}
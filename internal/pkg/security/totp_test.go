@@ -0,0 +1,126 @@
+package security
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// secret of the RFC 6238 test vectors, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTP(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		now      time.Time
+		skew     int
+		lastStep int64
+		step     int64
+		valid    bool
+	}{
+		{"rfc vector 59", "287082", time.Unix(59, 0), 0, 0, 1, true},
+		{"rfc vector 1111111109", "081804", time.Unix(1111111109, 0), 0, 0, 37037036, true},
+		{"rfc vector 2000000000", "279037", time.Unix(2000000000, 0), 0, 0, 66666666, true},
+		{"previous step within skew", "081804", time.Unix(1111111109+30, 0), 1, 0, 37037036, true},
+		{"previous step without skew", "081804", time.Unix(1111111109+30, 0), 0, 0, 0, false},
+		{"replayed step", "081804", time.Unix(1111111109, 0), 1, 37037036, 0, false},
+		{"later step than the last one", "081804", time.Unix(1111111109, 0), 1, 37037035, 37037036, true},
+		{"wrong code", "123456", time.Unix(59, 0), 1, 0, 0, false},
+		{"wrong length", "28708", time.Unix(59, 0), 1, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, valid := ValidateTOTP(rfcSecret, tt.code, tt.now, tt.skew, tt.lastStep)
+			if valid != tt.valid || step != tt.step {
+				t.Fatalf("got step %d, valid %v; want step %d, valid %v", step, valid, tt.step, tt.valid)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPLowercaseSecret(t *testing.T) {
+	if _, valid := ValidateTOTP("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "287082", time.Unix(59, 0), 0, 0); !valid {
+		t.Fatal("lowercase secret refused")
+	}
+	if _, valid := ValidateTOTP("not base32!", "287082", time.Unix(59, 0), 0, 0); valid {
+		t.Fatal("invalid secret accepted")
+	}
+}
+
+func TestNewTOTPSecret(t *testing.T) {
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != totpSecretLength {
+		t.Fatalf("secret %q decodes to %d bytes, %v", secret, len(key), err)
+	}
+
+	other, _ := NewTOTPSecret()
+	if other == secret {
+		t.Fatal("two secrets are equal")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(TOTPURI("Todo App", "jane@example.com", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Todo App:jane@example.com" {
+		t.Fatalf("uri %s", uri)
+	}
+
+	query := uri.Query()
+	want := map[string]string{"secret": rfcSecret, "issuer": "Todo App", "algorithm": "SHA1", "digits": "6", "period": "30"}
+	for key, value := range want {
+		if query.Get(key) != value {
+			t.Fatalf("%s is %q, want %q", key, query.Get(key), value)
+		}
+	}
+}
+
+func TestNewRecoveryCodes(t *testing.T) {
+	codes, hashes, err := NewRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 10 || len(hashes) != 10 {
+		t.Fatalf("got %d codes and %d hashes", len(codes), len(hashes))
+	}
+
+	format := regexp.MustCompile(`^[0-9a-z]{4}(-[0-9a-z]{4}){3}$`)
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if !format.MatchString(code) {
+			t.Fatalf("code %q", code)
+		}
+		if seen[code] {
+			t.Fatalf("code %q twice", code)
+		}
+		seen[code] = true
+
+		if HashRecoveryCode(code) != hashes[i] {
+			t.Fatalf("hash of %q doesn't match", code)
+		}
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	want := HashRecoveryCode("abcd-efgh-jkmn-pqrs")
+
+	for _, code := range []string{"ABCD-EFGH-JKMN-PQRS", "abcdefghjkmnpqrs", " abcd-efgh-jkmn-pqrs "} {
+		if HashRecoveryCode(code) != want {
+			t.Fatalf("%q hashes differently", code)
+		}
+	}
+	if HashRecoveryCode("abcd-efgh-jkmn-pqrt") == want {
+		t.Fatal("another code hashes the same")
+	}
+}
@@ -2,106 +2,145 @@ package security
 
 import (
 	"errors"
-	"os"
-	"strconv"
 	"time"
+	"todo-app-mongo/internal/config"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/patrickmn/go-cache"
 )
 
 type UserJWTInterface interface {
-	GenerateToken(email string) (string, error)
+	GenerateToken(email string, role string) (string, error)
 	GenerateRefreshToken(email string) (string, error)
-	ValidateToken(token string) (string, error)
-	ValidateRefreshToken(token string) (string, error)
+	GenerateMFAToken(email string) (string, error)
+	ValidateToken(token string) (*Claims, error)
+	ValidateRefreshToken(token string) (*Claims, error)
+	ValidateMFAToken(token string) (*Claims, error)
 	LogOff(token string)
+	IsLoggedOff(token string) bool
+	RevokeAll(email string)
 }
 
-var (
-	secretKey      = os.Getenv("SECRET_KEY")
-	refreshKey     = os.Getenv("REFRESH_KEY")
-	secretTime, _  = strconv.Atoi(os.Getenv("SECRET_TIME"))
-	refreshTime, _ = strconv.Atoi(os.Getenv("REFRESH_TIME"))
-	logOffTokens   = cache.New(12*time.Hour, 10*time.Minute)
-)
-
 type Claims struct {
 	Email string `json:"email"`
+	// IssuedAtMs is a millisecond iat, precise enough to tell tokens issued
+	// right after a revocation from the revoked ones.
+	IssuedAtMs int64 `json:"iat_ms"`
+	// Purpose tells tokens signed with the same key apart: empty for access
+	// tokens and "mfa" for the challenge between the two login steps.
+	Purpose string `json:"purpose,omitempty"`
+	// Role is only set on access tokens, for clients to read. The server
+	// reads the role from the user on every request.
+	Role string `json:"role,omitempty"`
 	jwt.StandardClaims
 }
 
-func GenerateToken(email string) (string, error) {
-	claims := &Claims{
-		Email: email,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Duration(secretTime) * time.Minute).Unix(),
-		},
-	}
+const purposeMFA = "mfa"
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secretKey))
+type userJWT struct {
+	secretKey       []byte
+	refreshKey      []byte
+	tokenLifetime   time.Duration
+	refreshLifetime time.Duration
+	mfaLifetime     time.Duration
+	logOffTokens    *cache.Cache
+	revokedUsers    *cache.Cache
 }
 
-func GenerateRefreshToken(email string) (string, error) {
-	claims := &Claims{
-		Email: email,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Duration(refreshTime) * time.Minute).Unix(),
-		},
+func NewUserJWT(cfg config.JWT) UserJWTInterface {
+	return &userJWT{
+		secretKey:       []byte(cfg.SecretKey),
+		refreshKey:      []byte(cfg.RefreshKey),
+		tokenLifetime:   cfg.TokenLifetime,
+		refreshLifetime: cfg.RefreshLifetime,
+		mfaLifetime:     cfg.MFATokenLifetime,
+		// logged off tokens only need to be remembered until they expire
+		logOffTokens: cache.New(cfg.RefreshLifetime, 10*time.Minute),
+		revokedUsers: cache.New(cfg.RefreshLifetime, 10*time.Minute),
 	}
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(refreshKey))
+func (u *userJWT) GenerateToken(email string, role string) (string, error) {
+	return u.sign(email, role, u.tokenLifetime, u.secretKey, "")
 }
 
-func ValidateToken(token string) (string, error) {
+func (u *userJWT) GenerateRefreshToken(email string) (string, error) {
+	return u.sign(email, "", u.refreshLifetime, u.refreshKey, "")
+}
 
-	if IsLoggedOff(token) {
-		return "", errors.New("invalid token")
-	}
+// GenerateMFAToken returns the short-lived challenge proving the password
+// step of a login, exchanged for real tokens with a second factor.
+func (u *userJWT) GenerateMFAToken(email string) (string, error) {
+	return u.sign(email, "", u.mfaLifetime, u.secretKey, purposeMFA)
+}
 
-	claims := &Claims{}
+func (u *userJWT) ValidateToken(token string) (*Claims, error) {
+	return u.validate(token, u.secretKey, "")
+}
 
-	tkn, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secretKey), nil
-	})
-	if err != nil {
-		return "", err
-	}
-	if !tkn.Valid {
-		return "", err
+func (u *userJWT) ValidateRefreshToken(token string) (*Claims, error) {
+	return u.validate(token, u.refreshKey, "")
+}
+
+func (u *userJWT) ValidateMFAToken(token string) (*Claims, error) {
+	return u.validate(token, u.secretKey, purposeMFA)
+}
+
+func (u *userJWT) LogOff(token string) {
+	u.logOffTokens.Set(token, true, cache.DefaultExpiration)
+}
+
+func (u *userJWT) IsLoggedOff(token string) bool {
+	_, found := u.logOffTokens.Get(token)
+	return found
+}
+
+// RevokeAll invalidates every token issued to the user so far in this
+// process. Other replicas only learn it from User.TokensValidAfter, which
+// callers save as well.
+func (u *userJWT) RevokeAll(email string) {
+	u.revokedUsers.Set(email, time.Now().UnixMilli(), cache.DefaultExpiration)
+}
+
+func (u *userJWT) isRevoked(claims *Claims) bool {
+	revokedAt, found := u.revokedUsers.Get(claims.Email)
+	return found && claims.IssuedAtMs < revokedAt.(int64)
+}
+
+func (u *userJWT) sign(email string, role string, lifetime time.Duration, key []byte, purpose string) (string, error) {
+	now := time.Now()
+	claims := &Claims{
+		Email:      email,
+		IssuedAtMs: now.UnixMilli(),
+		Purpose:    purpose,
+		Role:       role,
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(lifetime).Unix(),
+		},
 	}
 
-	return claims.Email, nil
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(key)
 }
 
-func ValidateRefreshToken(token string) (string, error) {
+func (u *userJWT) validate(token string, key []byte, purpose string) (*Claims, error) {
 
-	if IsLoggedOff(token) {
-		return "", errors.New("invalid token")
+	if u.IsLoggedOff(token) {
+		return nil, errors.New("invalid token")
 	}
 
 	claims := &Claims{}
 
 	tkn, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(refreshKey), nil
+		return key, nil
 	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	if !tkn.Valid {
-		return "", err
+	if !tkn.Valid || claims.Purpose != purpose || u.isRevoked(claims) {
+		return nil, errors.New("invalid token")
 	}
 
-	return claims.Email, nil
-}
-
-func LogOff(token string) {
-	logOffTokens.Set(token, true, cache.DefaultExpiration)
-}
-
-func IsLoggedOff(token string) bool {
-	_, found := logOffTokens.Get(token)
-	return found
+	return claims, nil
 }
@@ -0,0 +1,167 @@
+package sso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"todo-app-mongo/internal/config"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var ErrUnknownProvider = errors.New("unknown identity provider")
+
+// Identity is what a provider asserts about the user who logged in.
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Providers holds the configured OpenID Connect providers, by name.
+type Providers struct {
+	providers map[string]*Provider
+	names     []string
+}
+
+// New configures a provider per entry. Their discovery documents are only
+// fetched on first use, so an unreachable provider doesn't keep the API
+// from starting.
+func New(cfg config.OIDC, publicURL string) *Providers {
+
+	p := &Providers{providers: map[string]*Provider{}}
+	for _, providerCfg := range cfg.Providers {
+		p.providers[providerCfg.Name] = &Provider{
+			cfg:         providerCfg,
+			redirectURL: fmt.Sprintf("%s/auth/oidc/%s/callback", publicURL, providerCfg.Name),
+		}
+		p.names = append(p.names, providerCfg.Name)
+	}
+
+	return p
+}
+
+func (p *Providers) Get(name string) (*Provider, error) {
+	provider, ok := p.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	return provider, nil
+}
+
+// Names lists the providers in configuration order.
+func (p *Providers) Names() []string {
+	return p.names
+}
+
+// Provider runs the authorization code flow with PKCE against one
+// provider.
+type Provider struct {
+	cfg         config.OIDCProvider
+	redirectURL string
+
+	mu       sync.Mutex
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// AuthURL returns the provider page to send the user to. The state comes
+// back on the callback; the nonce ends up in the ID token and the PKCE
+// verifier is needed to redeem the code.
+func (p *Provider) AuthURL(ctx context.Context, state string, nonce string, codeVerifier string) (string, error) {
+
+	oauth, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(codeVerifier)), nil
+}
+
+// Exchange redeems the authorization code and verifies the ID token.
+func (p *Provider) Exchange(ctx context.Context, code string, nonce string, codeVerifier string) (*Identity, error) {
+
+	oauth, verifier, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := oauth.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("exchanging code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("no id_token in token response")
+	}
+
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("verifying id_token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("id_token nonce mismatch")
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified any    `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("reading id_token claims: %w", err)
+	}
+
+	return &Identity{
+		Provider:      p.cfg.Name,
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: isTrue(claims.EmailVerified),
+		Name:          claims.Name,
+	}, nil
+}
+
+// discover fetches the provider metadata on first use and keeps it once
+// it succeeds.
+func (p *Provider) discover(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.oauth != nil {
+		return p.oauth, p.verifier, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, p.cfg.Issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("discovering %s: %w", p.cfg.Name, err)
+	}
+
+	p.oauth = &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  p.redirectURL,
+		Scopes:       p.cfg.Scopes,
+	}
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientID})
+
+	return p.oauth, p.verifier, nil
+}
+
+// isTrue reads email_verified, which some providers send as a string.
+func isTrue(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	default:
+		return false
+	}
+}
@@ -0,0 +1,203 @@
+package sso
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"todo-app-mongo/internal/config"
+	"todo-app-mongo/internal/pkg/sso/ssotest"
+)
+
+const (
+	testVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testNonce    = "nonce"
+)
+
+func newTestProvider(t *testing.T) (*ssotest.Provider, *Provider) {
+	t.Helper()
+
+	idp, err := ssotest.NewProvider("client", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(idp.Close)
+
+	providers := New(config.OIDC{Providers: []config.OIDCProvider{{
+		Name:         "stub",
+		Issuer:       idp.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Scopes:       []string{"openid", "email", "profile"},
+	}}}, "https://todo.example.com")
+
+	provider, err := providers.Get("stub")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return idp, provider
+}
+
+func TestProvidersGet(t *testing.T) {
+	providers := New(config.OIDC{Providers: []config.OIDCProvider{{Name: "b"}, {Name: "a"}}}, "")
+
+	if names := providers.Names(); len(names) != 2 || names[0] != "b" || names[1] != "a" {
+		t.Fatalf("names %v, want the configuration order", names)
+	}
+	if _, err := providers.Get("c"); err != ErrUnknownProvider {
+		t.Fatalf("got %v for an unknown provider", err)
+	}
+}
+
+func TestAuthURL(t *testing.T) {
+	idp, provider := newTestProvider(t)
+
+	authURL, err := provider.AuthURL(context.Background(), "state", testNonce, testVerifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != idp.URL+"/authorize" {
+		t.Fatalf("endpoint %s, want the discovered one", got)
+	}
+
+	query := u.Query()
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             "client",
+		"redirect_uri":          "https://todo.example.com/auth/oidc/stub/callback",
+		"scope":                 "openid email profile",
+		"state":                 "state",
+		"nonce":                 testNonce,
+		"code_challenge_method": "S256",
+		// RFC 7636 appendix B
+		"code_challenge": "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+	}
+	for key, value := range want {
+		if query.Get(key) != value {
+			t.Fatalf("%s is %q, want %q", key, query.Get(key), value)
+		}
+	}
+}
+
+func TestAuthURLUnreachableProvider(t *testing.T) {
+	idp, provider := newTestProvider(t)
+	idp.Close()
+
+	if _, err := provider.AuthURL(context.Background(), "state", testNonce, testVerifier); err == nil {
+		t.Fatal("no error without discovery")
+	}
+}
+
+func TestExchange(t *testing.T) {
+	tests := []struct {
+		name     string
+		claims   map[string]any
+		verifier string
+		nonce    string
+		err      string
+		identity Identity
+	}{
+		{
+			name:     "verified email",
+			claims:   map[string]any{"sub": "42", "email": "jane@example.com", "email_verified": true, "name": "Jane"},
+			verifier: testVerifier,
+			nonce:    testNonce,
+			identity: Identity{Provider: "stub", Subject: "42", Email: "jane@example.com", EmailVerified: true, Name: "Jane"},
+		},
+		{
+			name:     "email verified as a string",
+			claims:   map[string]any{"sub": "42", "email": "jane@example.com", "email_verified": "true"},
+			verifier: testVerifier,
+			nonce:    testNonce,
+			identity: Identity{Provider: "stub", Subject: "42", Email: "jane@example.com", EmailVerified: true},
+		},
+		{
+			name:     "unverified email",
+			claims:   map[string]any{"sub": "42", "email": "jane@example.com"},
+			verifier: testVerifier,
+			nonce:    testNonce,
+			identity: Identity{Provider: "stub", Subject: "42", Email: "jane@example.com"},
+		},
+		{
+			name:     "wrong PKCE verifier",
+			verifier: strings.Repeat("a", 43),
+			nonce:    testNonce,
+			err:      "exchanging code",
+		},
+		{
+			name:     "nonce of another login",
+			verifier: testVerifier,
+			nonce:    "other",
+			err:      "nonce mismatch",
+		},
+		{
+			name:     "token for another client",
+			claims:   map[string]any{"aud": "other"},
+			verifier: testVerifier,
+			nonce:    testNonce,
+			err:      "verifying id_token",
+		},
+		{
+			name:     "token from another issuer",
+			claims:   map[string]any{"iss": "https://evil.example.com"},
+			verifier: testVerifier,
+			nonce:    testNonce,
+			err:      "verifying id_token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp, provider := newTestProvider(t)
+
+			authURL, err := provider.AuthURL(context.Background(), "state", testNonce, testVerifier)
+			if err != nil {
+				t.Fatal(err)
+			}
+			callback, err := idp.Authorize(authURL, tt.claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			identity, err := provider.Exchange(context.Background(), callback.Get("code"), tt.nonce, tt.verifier)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *identity != tt.identity {
+				t.Fatalf("got %+v, want %+v", *identity, tt.identity)
+			}
+		})
+	}
+}
+
+func TestExchangeCodeOnce(t *testing.T) {
+	idp, provider := newTestProvider(t)
+
+	authURL, err := provider.AuthURL(context.Background(), "state", testNonce, testVerifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback, err := idp.Authorize(authURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := provider.Exchange(context.Background(), callback.Get("code"), testNonce, testVerifier); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.Exchange(context.Background(), callback.Get("code"), testNonce, testVerifier); err == nil {
+		t.Fatal("code redeemed twice")
+	}
+}
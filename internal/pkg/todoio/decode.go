@@ -0,0 +1,279 @@
+package todoio
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"todo-app-mongo/internal/entity"
+	"todo-app-mongo/internal/pkg/ical"
+)
+
+// Decode reads the todos of an import file. An error is returned when the
+// file can't be read at all; rows that can't be read carry their own.
+func Decode(format string, r io.Reader) ([]Row, error) {
+	switch format {
+	case FormatJSON:
+		return decodeJSON(r)
+	case FormatCSV:
+		return decodeCSV(r)
+	case FormatICS:
+		return decodeICS(r)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// jsonTodo is a todo as exported in JSON, times kept as text to report
+// the bad ones per row.
+type jsonTodo struct {
+	ID          string   `json:"id"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	Scheduled   bool     `json:"scheduled"`
+	ScheduledTo string   `json:"scheduled_to"`
+	AllDay      bool     `json:"all_day"`
+	Completed   bool     `json:"completed"`
+	CompletedAt string   `json:"completed_at"`
+	CreatedAt   string   `json:"created_at"`
+}
+
+func decodeJSON(r io.Reader) ([]Row, error) {
+
+	decoder := json.NewDecoder(r)
+	if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+		return nil, errors.New("a JSON import must be an array of todos")
+	}
+
+	rows := []Row{}
+	for decoder.More() {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+
+		row := Row{Number: len(rows) + 1}
+		var item jsonTodo
+		if err := json.Unmarshal(raw, &item); err != nil {
+			row.Err = errors.New("not a todo object")
+			rows = append(rows, row)
+			continue
+		}
+
+		row.ID = item.ID
+		row.Todo = entity.Todo{
+			Title:       item.Title,
+			Description: item.Description,
+			Tags:        item.Tags,
+			Scheduled:   item.Scheduled,
+			AllDay:      item.AllDay,
+			Completed:   item.Completed,
+		}
+		row.Err = parseTimes(&row.Todo, item.ScheduledTo, item.CompletedAt, item.CreatedAt)
+		rows = append(rows, row)
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	return rows, nil
+}
+
+func decodeCSV(r io.Reader) ([]Row, error) {
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("a CSV import needs a header line")
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, errors.New("the CSV header has no title column")
+	}
+
+	rows := []Row{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, err
+			}
+			rows = append(rows, Row{Number: parseErr.StartLine, Err: parseErr.Err})
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+
+		get := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(record) {
+				return unescapeCell(strings.TrimSpace(record[i]))
+			}
+			return ""
+		}
+
+		row := Row{Number: line, ID: get("id")}
+		row.Todo = entity.Todo{Title: get("title"), Description: get("description")}
+		if tags := get("tags"); tags != "" {
+			row.Todo.Tags = strings.Split(tags, ";")
+		}
+
+		row.Todo.Scheduled, err = parseBool(get("scheduled"))
+		if err != nil {
+			row.Err = fmt.Errorf("scheduled: %w", err)
+		}
+		row.Todo.AllDay, err = parseBool(get("all_day"))
+		if err != nil && row.Err == nil {
+			row.Err = fmt.Errorf("all_day: %w", err)
+		}
+		row.Todo.Completed, err = parseBool(get("completed"))
+		if err != nil && row.Err == nil {
+			row.Err = fmt.Errorf("completed: %w", err)
+		}
+		if err := parseTimes(&row.Todo, get("scheduled_to"), get("completed_at"), get("created_at")); err != nil && row.Err == nil {
+			row.Err = err
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// unescapeCell reverses escapeCell.
+func unescapeCell(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune(formulaStarts, rune(value[1])) {
+		return value[1:]
+	}
+
+	return value
+}
+
+func parseBool(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%q is not a boolean", value)
+	}
+
+	return b, nil
+}
+
+// decodeICS reads the VTODOs, and the VEVENTs as todos scheduled at their
+// start. Those scheduled on a date last all day. The VEVENTs exported along
+// with the VTODO of a todo are skipped, the VTODO is the todo.
+func decodeICS(r io.Reader) ([]Row, error) {
+
+	components, err := ical.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid iCalendar: %w", err)
+	}
+
+	todoUIDs := map[string]bool{}
+	for _, component := range components {
+		if uid, ok := component.Get("UID"); ok && component.Name == "VTODO" {
+			todoUIDs[uid.Value] = true
+		}
+	}
+
+	rows := []Row{}
+	for _, component := range components {
+		if component.Name != "VTODO" && component.Name != "VEVENT" {
+			continue
+		}
+
+		uid, _ := component.Get("UID")
+		if component.Name == "VEVENT" {
+			if todoUID, ok := strings.CutSuffix(uid.Value, eventSuffix+uidDomain); ok && todoUIDs[todoUID+uidDomain] {
+				continue
+			}
+		}
+
+		row := Row{Number: component.Line}
+		if uid.Value != "" {
+			row.ID = strings.TrimSuffix(uid.Value, uidDomain)
+		}
+		if summary, ok := component.Get("SUMMARY"); ok {
+			row.Todo.Title = ical.UnescapeText(summary.Value)
+		}
+		if description, ok := component.Get("DESCRIPTION"); ok {
+			row.Todo.Description = ical.UnescapeText(description.Value)
+		}
+		for _, categories := range component.Properties["CATEGORIES"] {
+			row.Todo.Tags = append(row.Todo.Tags, ical.SplitTextList(categories.Value)...)
+		}
+
+		scheduledAt := "DUE"
+		if component.Name == "VEVENT" {
+			scheduledAt = "DTSTART"
+		}
+		times := []struct {
+			name string
+			dest *time.Time
+		}{
+			{scheduledAt, &row.Todo.ScheduledTo},
+			{"COMPLETED", &row.Todo.CompletedAt},
+			{"CREATED", &row.Todo.CreatedAt},
+		}
+		for _, field := range times {
+			prop, ok := component.Get(field.name)
+			if !ok {
+				continue
+			}
+			t, isDate, err := ical.ParseTime(prop, time.UTC)
+			if err != nil {
+				row.Err = fmt.Errorf("%s: %q is not a date", strings.ToLower(field.name), prop.Value)
+				break
+			}
+			*field.dest = t
+			if field.name == scheduledAt {
+				row.Todo.AllDay = isDate
+			}
+		}
+
+		row.Todo.Scheduled = !row.Todo.ScheduledTo.IsZero()
+		status, _ := component.Get("STATUS")
+		row.Todo.Completed = status.Value == "COMPLETED" || !row.Todo.CompletedAt.IsZero()
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// parseTimes sets the times of the todo from their RFC 3339 text, the
+// schedule being a date when the todo lasts all day.
+func parseTimes(todo *entity.Todo, scheduledTo string, completedAt string, createdAt string) error {
+
+	var err error
+	if scheduledTo != "" {
+		if todo.ScheduledTo, err = entity.ParseSchedule(scheduledTo, todo.AllDay); err != nil {
+			return err
+		}
+	}
+	if todo.CompletedAt, err = parseTime(completedAt); err != nil {
+		return fmt.Errorf("completed_at: %q is not an RFC 3339 time", completedAt)
+	}
+	if todo.CreatedAt, err = parseTime(createdAt); err != nil {
+		return fmt.Errorf("created_at: %q is not an RFC 3339 time", createdAt)
+	}
+
+	return nil
+}
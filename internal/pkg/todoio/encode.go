@@ -0,0 +1,253 @@
+package todoio
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"todo-app-mongo/internal/entity"
+	"todo-app-mongo/internal/pkg/ical"
+)
+
+// Encoder writes todos one at a time, so exports don't hold them all in
+// memory. Close ends the document.
+type Encoder interface {
+	Encode(todo *entity.Todo) error
+	Close() error
+}
+
+func NewEncoder(format string, w io.Writer) (Encoder, error) {
+	switch format {
+	case FormatJSON:
+		return &jsonEncoder{w: w}, nil
+	case FormatCSV:
+		return newCSVEncoder(w), nil
+	case FormatICS:
+		return &icsEncoder{w: ical.NewWriter(w, ProdID), now: time.Now()}, nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// NewFeedEncoder writes an iCalendar feed that calendar apps subscribe to:
+// named, refreshed every refresh and in the time zone loc. Unless loc is
+// UTC, the feed describes it in a VTIMEZONE from a year ago to zoneYears
+// from now, and schedules in that range are written in it.
+func NewFeedEncoder(w io.Writer, name string, loc *time.Location, refresh time.Duration) Encoder {
+
+	now := time.Now()
+
+	cw := ical.NewWriter(w, ProdID)
+	cw.Text("NAME", name)
+	cw.Text("X-WR-CALNAME", name)
+	cw.Value("REFRESH-INTERVAL;VALUE=DURATION", ical.FormatDuration(refresh))
+	cw.Value("X-PUBLISHED-TTL", ical.FormatDuration(refresh))
+
+	e := &icsEncoder{w: cw, now: now}
+	if loc != time.UTC {
+		cw.Text("X-WR-TIMEZONE", loc.String())
+		e.loc, e.zoneFrom, e.zoneTo = loc, now.AddDate(-1, 0, 0), now.AddDate(zoneYears, 0, 0)
+		cw.Timezone(e.loc, e.zoneFrom, e.zoneTo)
+	}
+
+	return e
+}
+
+// jsonEncoder writes an array of todos as the API returns them.
+type jsonEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonEncoder) Encode(todo *entity.Todo) error {
+
+	data, err := json.Marshal(todo)
+	if err != nil {
+		return err
+	}
+
+	separator := ",\n"
+	if e.count == 0 {
+		separator = "[\n"
+	}
+	e.count++
+
+	_, err = e.w.Write(append([]byte(separator), data...))
+	return err
+}
+
+func (e *jsonEncoder) Close() error {
+	end := "\n]\n"
+	if e.count == 0 {
+		end = "[]\n"
+	}
+
+	_, err := io.WriteString(e.w, end)
+	return err
+}
+
+var csvHeader = []string{"id", "title", "description", "tags", "scheduled", "scheduled_to", "all_day", "completed", "completed_at", "created_at"}
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func newCSVEncoder(w io.Writer) *csvEncoder {
+	e := &csvEncoder{w: csv.NewWriter(w)}
+	_ = e.w.Write(csvHeader)
+	return e
+}
+
+func (e *csvEncoder) Encode(todo *entity.Todo) error {
+	return e.w.Write([]string{
+		todo.ID.Hex(),
+		escapeCell(todo.Title),
+		escapeCell(todo.Description),
+		escapeCell(strings.Join(todo.Tags, ";")),
+		strconv.FormatBool(todo.Scheduled),
+		formatScheduledTo(todo),
+		strconv.FormatBool(todo.AllDay),
+		strconv.FormatBool(todo.Completed),
+		formatTime(todo.CompletedAt),
+		formatTime(todo.CreatedAt),
+	})
+}
+
+// escapeCell keeps spreadsheets from running a cell as a formula by
+// prefixing it with a quote, which they show as text. Cells starting with
+// a quote get one too, so unescapeCell can tell them apart.
+func escapeCell(value string) string {
+	if value != "" && strings.ContainsRune(formulaStarts, rune(value[0])) {
+		return "'" + value
+	}
+
+	return value
+}
+
+func (e *csvEncoder) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func formatScheduledTo(todo *entity.Todo) string {
+	switch {
+	case !todo.Scheduled:
+		return ""
+	case todo.AllDay:
+		return todo.FormatSchedule()
+	default:
+		return formatTime(todo.ScheduledTo)
+	}
+}
+
+// zoneYears is how many years ahead the VTIMEZONE of a feed goes.
+const zoneYears = 2
+
+// icsEncoder writes each todo as a VTODO, due when it is scheduled. A
+// scheduled todo also gets a VEVENT at that time, for the calendar apps
+// that only show events; it lasts the whole day when the todo does, and
+// doesn't make its time busy. The DTSTAMP of both is when the todo was last
+// changed, or now for todos that don't know. Todos don't repeat: there is
+// no recurrence rule to write.
+//
+// Schedules are in UTC, or in loc when they fall between zoneFrom and
+// zoneTo, the range its VTIMEZONE covers. All-day schedules are dates,
+// the same day in every zone.
+type icsEncoder struct {
+	w        *ical.Writer
+	now      time.Time
+	loc      *time.Location
+	zoneFrom time.Time
+	zoneTo   time.Time
+}
+
+func (e *icsEncoder) Encode(todo *entity.Todo) error {
+
+	scheduled := todo.Scheduled && !todo.ScheduledTo.IsZero()
+
+	e.w.Begin("VTODO")
+	e.common(todo, UID(todo))
+	switch {
+	case !scheduled:
+	case todo.AllDay:
+		e.w.Value("DUE;VALUE=DATE", ical.FormatDate(todo.ScheduledTo.UTC()))
+	default:
+		e.scheduleTime("DUE", todo.ScheduledTo)
+	}
+	if todo.Completed {
+		e.w.Value("STATUS", "COMPLETED")
+		if !todo.CompletedAt.IsZero() {
+			e.w.Time("COMPLETED", todo.CompletedAt)
+		}
+	} else {
+		e.w.Value("STATUS", "NEEDS-ACTION")
+	}
+	e.w.End("VTODO")
+
+	if scheduled {
+		e.w.Begin("VEVENT")
+		e.common(todo, EventUID(todo))
+		e.w.Value("RELATED-TO", UID(todo))
+		if todo.AllDay {
+			day := todo.ScheduledTo.UTC()
+			e.w.Value("DTSTART;VALUE=DATE", ical.FormatDate(day))
+			e.w.Value("DTEND;VALUE=DATE", ical.FormatDate(day.AddDate(0, 0, 1)))
+		} else {
+			e.scheduleTime("DTSTART", todo.ScheduledTo)
+		}
+		e.w.Value("TRANSP", "TRANSPARENT")
+		e.w.End("VEVENT")
+	}
+
+	// flushed per todo so the export streams
+	return e.w.Flush()
+}
+
+// scheduleTime writes the time of a schedule, local to the zone of the
+// calendar when its VTIMEZONE covers it.
+func (e *icsEncoder) scheduleTime(name string, t time.Time) {
+	if e.loc == nil || t.Before(e.zoneFrom) || t.After(e.zoneTo) {
+		e.w.Time(name, t)
+		return
+	}
+
+	e.w.LocalTime(name, t, e.loc)
+}
+
+// common writes the properties the VTODO and the VEVENT of a todo share.
+func (e *icsEncoder) common(todo *entity.Todo, uid string) {
+
+	e.w.Value("UID", uid)
+	e.w.Time("DTSTAMP", e.stamp(todo))
+	if !todo.CreatedAt.IsZero() {
+		e.w.Time("CREATED", todo.CreatedAt)
+	}
+	if !todo.UpdatedAt.IsZero() {
+		e.w.Time("LAST-MODIFIED", todo.UpdatedAt)
+	}
+	e.w.Value("SEQUENCE", strconv.FormatInt(todo.Version, 10))
+	e.w.Text("SUMMARY", todo.Title)
+	if todo.Description != "" {
+		e.w.Text("DESCRIPTION", todo.Description)
+	}
+	if len(todo.Tags) > 0 {
+		e.w.TextList("CATEGORIES", todo.Tags)
+	}
+}
+
+func (e *icsEncoder) stamp(todo *entity.Todo) time.Time {
+	switch {
+	case !todo.UpdatedAt.IsZero():
+		return todo.UpdatedAt
+	case !todo.CreatedAt.IsZero():
+		return todo.CreatedAt
+	default:
+		return e.now
+	}
+}
+
+func (e *icsEncoder) Close() error {
+	return e.w.Close()
+}
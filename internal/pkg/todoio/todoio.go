@@ -0,0 +1,96 @@
+package todoio
+
+import (
+	"errors"
+	"mime"
+	"time"
+	"todo-app-mongo/internal/entity"
+)
+
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatICS  = "ics"
+)
+
+// ProdID names the app in the calendars it writes.
+const ProdID = "-//todo-app-mongo//todos//EN"
+
+// uidDomain ends the iCalendar UIDs of todos, so they are globally unique.
+const uidDomain = "@todo-app-mongo"
+
+// eventSuffix tells the UID of the VEVENT of a scheduled todo from the UID
+// of its VTODO.
+const eventSuffix = "-event"
+
+// formulaStarts are the first characters that make spreadsheets read a CSV
+// cell as a formula, and the quote escaping them.
+const formulaStarts = "=+-@\t\r'"
+
+var ErrUnknownFormat = errors.New("format must be one of json, csv, ics")
+
+var contentTypes = map[string]string{
+	FormatJSON: "application/json",
+	FormatCSV:  "text/csv",
+	FormatICS:  "text/calendar",
+}
+
+// ContentType returns the media type of a format.
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// FormatOf returns the format of a media type, parameters ignored.
+func FormatOf(contentType string) (string, bool) {
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", false
+	}
+	for format, t := range contentTypes {
+		if t == mediaType {
+			return format, true
+		}
+	}
+
+	return "", false
+}
+
+// UID is the iCalendar UID of a todo.
+func UID(todo *entity.Todo) string {
+	return todo.ID.Hex() + uidDomain
+}
+
+// EventUID is the iCalendar UID of the event showing a scheduled todo.
+func EventUID(todo *entity.Todo) string {
+	return todo.ID.Hex() + eventSuffix + uidDomain
+}
+
+// Row is a todo read from an import file. Number locates it: the position
+// in a JSON array, the line in a CSV or iCalendar file. ID is the id or UID
+// it had where it was exported from, if any. Err tells why the row couldn't
+// be read, in which case Todo is incomplete.
+type Row struct {
+	Number int
+	ID     string
+	Todo   entity.Todo
+	Err    error
+}
+
+// parseTime reads an optional RFC 3339 time.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+// formatTime writes an optional RFC 3339 time.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,278 @@
+package todoio
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"todo-app-mongo/internal/entity"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func encode(t *testing.T, format string, todos ...*entity.Todo) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	encoder, err := NewEncoder(format, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, todo := range todos {
+		if err := encoder.Encode(todo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.String()
+}
+
+func TestCSVEscapesFormulas(t *testing.T) {
+	titles := []string{
+		"=HYPERLINK(\"http://example.com\")",
+		"+1",
+		"-1",
+		"@SUM(A1)",
+		"\tindented",
+		"'quoted",
+		"plain",
+		"a = b",
+	}
+
+	todos := make([]*entity.Todo, len(titles))
+	for i, title := range titles {
+		todos[i] = &entity.Todo{ID: primitive.NewObjectID(), Title: title, Description: title, Tags: []string{"-tag", "other"}}
+	}
+
+	out := encode(t, FormatCSV, todos...)
+
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n")[1:] {
+		cells := strings.SplitN(line, ",", 3)
+		title := strings.Trim(cells[1], `"`)
+		if title != "" && strings.ContainsRune("=+-@\t", rune(title[0])) {
+			t.Errorf("unescaped cell %q", title)
+		}
+	}
+
+	rows, err := Decode(FormatCSV, strings.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(titles) {
+		t.Fatalf("%d rows, want %d", len(rows), len(titles))
+	}
+	for i, row := range rows {
+		if row.Err != nil {
+			t.Fatalf("row %d: %v", row.Number, row.Err)
+		}
+		want := titles[i]
+		if row.Todo.Title != want || row.Todo.Description != want {
+			t.Errorf("row %d: title %q, description %q, want %q", row.Number, row.Todo.Title, row.Todo.Description, want)
+		}
+		if strings.Join(row.Todo.Tags, ";") != "-tag;other" {
+			t.Errorf("row %d: tags %q", row.Number, row.Todo.Tags)
+		}
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	created := time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)
+	todos := []*entity.Todo{
+		{ID: primitive.NewObjectID(), Title: "Timed", Scheduled: true, ScheduledTo: time.Date(2026, 1, 2, 15, 4, 5, 0, time.FixedZone("", 3600)), CreatedAt: created},
+		{ID: primitive.NewObjectID(), Title: "All day", Scheduled: true, ScheduledTo: time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC), AllDay: true, CreatedAt: created},
+		{ID: primitive.NewObjectID(), Title: "Done", Completed: true, CompletedAt: created.Add(time.Hour), CreatedAt: created},
+	}
+
+	rows, err := Decode(FormatCSV, strings.NewReader(encode(t, FormatCSV, todos...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, row := range rows {
+		todo := todos[i]
+		if row.Err != nil {
+			t.Fatalf("row %d: %v", row.Number, row.Err)
+		}
+		if row.ID != todo.ID.Hex() || row.Todo.Title != todo.Title || row.Todo.AllDay != todo.AllDay || row.Todo.Completed != todo.Completed {
+			t.Errorf("row %d: got %+v", row.Number, row)
+		}
+		if !row.Todo.ScheduledTo.Equal(todo.ScheduledTo) || !row.Todo.CompletedAt.Equal(todo.CompletedAt) || !row.Todo.CreatedAt.Equal(todo.CreatedAt) {
+			t.Errorf("row %d: times %v %v %v", row.Number, row.Todo.ScheduledTo, row.Todo.CompletedAt, row.Todo.CreatedAt)
+		}
+	}
+}
+
+func TestICSExportsEventsForScheduledTodos(t *testing.T) {
+	timed := &entity.Todo{ID: primitive.NewObjectID(), Title: "Call Bob", Scheduled: true, ScheduledTo: time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)}
+	allDay := &entity.Todo{ID: primitive.NewObjectID(), Title: "Holiday", Scheduled: true, ScheduledTo: time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC), AllDay: true}
+	unscheduled := &entity.Todo{ID: primitive.NewObjectID(), Title: "Someday"}
+
+	out := encode(t, FormatICS, timed, allDay, unscheduled)
+
+	if n := strings.Count(out, "BEGIN:VTODO"); n != 3 {
+		t.Fatalf("%d VTODOs, want 3", n)
+	}
+	if n := strings.Count(out, "BEGIN:VEVENT"); n != 2 {
+		t.Fatalf("%d VEVENTs, want 2", n)
+	}
+
+	for _, want := range []string{
+		"UID:" + EventUID(timed) + "\r\n",
+		"RELATED-TO:" + UID(timed) + "\r\n",
+		"DTSTART:20260102T150405Z\r\n",
+		"DUE:20260102T150405Z\r\n",
+		"DTSTART;VALUE=DATE:20260103\r\n",
+		"DTEND;VALUE=DATE:20260104\r\n",
+		"DUE;VALUE=DATE:20260103\r\n",
+		"TRANSP:TRANSPARENT\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, EventUID(unscheduled)) {
+		t.Error("event for an unscheduled todo")
+	}
+}
+
+func TestICSRoundTrip(t *testing.T) {
+	todos := []*entity.Todo{
+		{ID: primitive.NewObjectID(), Title: "Call, Bob", Description: "About\nthe trip", Tags: []string{"work", "a,b"}, Scheduled: true, ScheduledTo: time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{ID: primitive.NewObjectID(), Title: "Holiday", Scheduled: true, ScheduledTo: time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC), AllDay: true},
+		{ID: primitive.NewObjectID(), Title: "Done", Completed: true, CompletedAt: time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)},
+	}
+
+	rows, err := Decode(FormatICS, strings.NewReader(encode(t, FormatICS, todos...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the events of the scheduled todos are not imported again
+	if len(rows) != len(todos) {
+		t.Fatalf("%d rows, want %d", len(rows), len(todos))
+	}
+
+	for i, row := range rows {
+		todo := todos[i]
+		if row.Err != nil {
+			t.Fatalf("row %d: %v", row.Number, row.Err)
+		}
+		if row.ID != todo.ID.Hex() {
+			t.Errorf("row %d: id %q, want %q", row.Number, row.ID, todo.ID.Hex())
+		}
+		if row.Todo.Title != todo.Title || row.Todo.Description != todo.Description || strings.Join(row.Todo.Tags, "|") != strings.Join(todo.Tags, "|") {
+			t.Errorf("row %d: got %+v", row.Number, row.Todo)
+		}
+		if row.Todo.Scheduled != todo.Scheduled || row.Todo.AllDay != todo.AllDay || !row.Todo.ScheduledTo.Equal(todo.ScheduledTo) {
+			t.Errorf("row %d: schedule %v %v %v", row.Number, row.Todo.Scheduled, row.Todo.AllDay, row.Todo.ScheduledTo)
+		}
+		if row.Todo.Completed != todo.Completed || !row.Todo.CompletedAt.Equal(todo.CompletedAt) {
+			t.Errorf("row %d: completion %v %v", row.Number, row.Todo.Completed, row.Todo.CompletedAt)
+		}
+	}
+}
+
+func TestICSImportsForeignEvents(t *testing.T) {
+	input := "BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:abc-event@todo-app-mongo\r\n" +
+		"SUMMARY:Meeting\r\n" +
+		"DTSTART;VALUE=DATE:20260105\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	rows, err := Decode(FormatICS, strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Todo.Title != "Meeting" || !rows[0].Todo.AllDay {
+		t.Fatalf("rows %+v", rows)
+	}
+}
+
+func TestDecodeCSVErrors(t *testing.T) {
+	if _, err := Decode(FormatCSV, strings.NewReader("name\nGroceries\n")); err == nil {
+		t.Fatal("no error without a title column")
+	}
+
+	rows, err := Decode(FormatCSV, strings.NewReader("title,completed,scheduled_to,all_day\nA,maybe,,\nB,,2026-01-02T15:04:05,\nC,,2026-01-02T15:04:05Z,true\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if row.Err == nil {
+			t.Errorf("row %d: no error", row.Number)
+		}
+	}
+}
+
+func TestFeedEncoderTimeZone(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+
+	// noon, clocks never go back then
+	year, month, day := time.Now().In(paris).AddDate(0, 0, 2).Date()
+	noon := time.Date(year, month, day, 12, 0, 0, 0, paris)
+	soon := &entity.Todo{ID: primitive.NewObjectID(), Title: "Soon", Scheduled: true, ScheduledTo: noon}
+	later := &entity.Todo{ID: primitive.NewObjectID(), Title: "Later", Scheduled: true, ScheduledTo: noon.AddDate(zoneYears+1, 0, 0)}
+	allDay := &entity.Todo{ID: primitive.NewObjectID(), Title: "Holiday", Scheduled: true, ScheduledTo: time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC), AllDay: true}
+
+	var buf bytes.Buffer
+	encoder := NewFeedEncoder(&buf, "Todos", paris, time.Hour)
+	for _, todo := range []*entity.Todo{soon, later, allDay} {
+		if err := encoder.Encode(todo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"X-WR-TIMEZONE:Europe/Paris\r\n",
+		"BEGIN:VTIMEZONE\r\nTZID:Europe/Paris\r\n",
+		"DUE;TZID=Europe/Paris:" + noon.Format("20060102T150405") + "\r\n",
+		"DUE:" + later.ScheduledTo.UTC().Format("20060102T150405Z") + "\r\n",
+		"DTSTART;VALUE=DATE:20260103\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+
+	rows, err := Decode(FormatICS, strings.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, todo := range []*entity.Todo{soon, later, allDay} {
+		if !rows[i].Todo.ScheduledTo.Equal(todo.ScheduledTo) {
+			t.Errorf("%s read back at %v, want %v", todo.Title, rows[i].Todo.ScheduledTo, todo.ScheduledTo)
+		}
+	}
+}
+
+func TestFeedEncoderUTC(t *testing.T) {
+	todo := &entity.Todo{ID: primitive.NewObjectID(), Title: "Soon", Scheduled: true, ScheduledTo: time.Now().UTC().Add(time.Hour)}
+
+	var buf bytes.Buffer
+	encoder := NewFeedEncoder(&buf, "Todos", time.UTC, time.Hour)
+	if err := encoder.Encode(todo); err != nil {
+		t.Fatal(err)
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	if strings.Contains(out, "VTIMEZONE") || strings.Contains(out, "X-WR-TIMEZONE") || strings.Contains(out, "TZID") {
+		t.Fatalf("time zone in a UTC feed:\n%s", out)
+	}
+	if !strings.Contains(out, "DUE:"+todo.ScheduledTo.Format("20060102T150405Z")) {
+		t.Fatalf("no UTC due in\n%s", out)
+	}
+}
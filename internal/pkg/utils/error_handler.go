@@ -7,9 +7,18 @@ import (
 )
 
 type ErrorHandler struct {
-	Message   string `json:"message"`
-	Status    int    `json:"status"`
-	Timestamp string `json:"timestamp"`
+	Message   string        `json:"message"`
+	Status    int           `json:"status"`
+	Timestamp string        `json:"timestamp"`
+	Details   []ErrorDetail `json:"details,omitempty"`
+}
+
+// ErrorDetail describes one of several problems behind an error, e.g. each
+// rule a password breaks.
+type ErrorDetail struct {
+	Field   string `json:"field,omitempty"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
 }
 
 func NewErrorHandler(message string, status int, timestamp string) *ErrorHandler {
@@ -24,3 +33,9 @@ func DefaultErrorResponse(c *gin.Context, status int, message string) {
 	errorHandler := NewErrorHandler(message, status, time.Now().Format(time.RFC3339))
 	c.JSON(status, errorHandler)
 }
+
+func DetailedErrorResponse(c *gin.Context, status int, message string, details []ErrorDetail) {
+	errorHandler := NewErrorHandler(message, status, time.Now().Format(time.RFC3339))
+	errorHandler.Details = details
+	c.JSON(status, errorHandler)
+}
@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// Job is one run of a periodic task. The context is cancelled when the
+// worker stops.
+type Job func(ctx context.Context) error
+
+// Worker runs a job in the background at a fixed interval. Runs never
+// overlap: the next one waits for the interval after the previous ended.
+type Worker struct {
+	name     string
+	interval time.Duration
+	cancel   context.CancelFunc
+	done     chan struct{}
+	// when the worker last started waiting for a run, in Unix nanoseconds
+	idleSince atomic.Int64
+}
+
+// Start runs the job every interval, starting after the first one elapsed.
+// Errors are logged and the job runs again on the next tick.
+func Start(name string, interval time.Duration, job Job) *Worker {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Worker{name: name, interval: interval, cancel: cancel, done: make(chan struct{})}
+	w.idleSince.Store(time.Now().UnixNano())
+
+	go func() {
+		defer close(w.done)
+
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+
+			if err := job(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("%s: %v", name, err)
+			}
+			w.idleSince.Store(time.Now().UnixNano())
+			timer.Reset(interval)
+		}
+	}()
+
+	return w
+}
+
+// Check fails when a run took longer than the interval, so a stuck job
+// shows in the liveness probe.
+func (w *Worker) Check(ctx context.Context) error {
+
+	select {
+	case <-w.done:
+		return fmt.Errorf("%s stopped", w.name)
+	default:
+	}
+
+	idleSince := time.Unix(0, w.idleSince.Load())
+	if late := time.Since(idleSince) - 2*w.interval; late > 0 {
+		return fmt.Errorf("%s run overdue by %s", w.name, late.Round(time.Second))
+	}
+
+	return nil
+}
+
+// Stop cancels the running job, if any, and waits for it to return or for
+// ctx to end.
+func (w *Worker) Stop(ctx context.Context) error {
+	w.cancel()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"todo-app-mongo/internal/pkg/health"
+)
+
+// StopFunc releases a component once the HTTP server stopped taking requests.
+type StopFunc func(ctx context.Context) error
+
+type stopHook struct {
+	name string
+	fn   StopFunc
+}
+
+// Lifecycle runs the HTTP server until SIGINT/SIGTERM and then shuts the
+// application down in order: readiness is flipped to failing, in-flight
+// requests are drained and the registered components are stopped.
+type Lifecycle struct {
+	server          *http.Server
+	health          *health.Registry
+	drainDelay      time.Duration
+	shutdownTimeout time.Duration
+	hooks           []stopHook
+}
+
+func NewLifecycle(server *http.Server, registry *health.Registry, drainDelay time.Duration, shutdownTimeout time.Duration) *Lifecycle {
+	return &Lifecycle{
+		server:          server,
+		health:          registry,
+		drainDelay:      drainDelay,
+		shutdownTimeout: shutdownTimeout,
+	}
+}
+
+// OnStop registers a component to stop during shutdown. Hooks run in reverse
+// registration order, like deferred calls.
+func (l *Lifecycle) OnStop(name string, fn StopFunc) {
+	l.hooks = append(l.hooks, stopHook{name: name, fn: fn})
+}
+
+// Run blocks until the server fails or a termination signal is received,
+// then shuts everything down within the configured timeout.
+func (l *Lifecycle) Run(ctx context.Context) error {
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("server listening on %s", l.server.Addr)
+		serverErr <- l.server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			l.stopAll()
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+	}
+
+	log.Println("shutdown signal received, draining")
+	l.health.Drain()
+	time.Sleep(l.drainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), l.shutdownTimeout)
+	defer cancel()
+
+	err := l.server.Shutdown(shutdownCtx)
+	if err != nil {
+		log.Printf("http server shutdown: %v", err)
+	}
+
+	l.runHooks(shutdownCtx)
+
+	log.Println("shutdown complete")
+	return err
+}
+
+func (l *Lifecycle) stopAll() {
+	ctx, cancel := context.WithTimeout(context.Background(), l.shutdownTimeout)
+	defer cancel()
+
+	l.runHooks(ctx)
+}
+
+func (l *Lifecycle) runHooks(ctx context.Context) {
+	for i := len(l.hooks) - 1; i >= 0; i-- {
+		hook := l.hooks[i]
+		if err := hook.fn(ctx); err != nil {
+			log.Printf("stopping %s: %v", hook.name, err)
+		}
+	}
+}
@@ -1,14 +1,20 @@
 package server
 
 import (
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 
 	docs "todo-app-mongo/docs"
 	"todo-app-mongo/internal/database"
+	"todo-app-mongo/internal/entity"
 	"todo-app-mongo/internal/handlers"
+	"todo-app-mongo/internal/pkg/audit"
 	"todo-app-mongo/internal/pkg/middleware"
+	"todo-app-mongo/internal/pkg/ratelimit"
+	"todo-app-mongo/internal/pkg/telemetry"
 
 	swaggerfiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
@@ -17,16 +23,47 @@ import (
 func (s *Server) RegisterRoutes() http.Handler {
 
 	r := gin.Default()
-	r.Use(middleware.CorsMiddleware())
+	// Let handlers pass *gin.Context to the DAOs while keeping the request
+	// span (and its deadline) reachable through the context chain.
+	r.ContextWithFallback = true
+	// validated with the configuration, none trusts no X-Forwarded-For
+	if err := r.SetTrustedProxies(s.cfg.Server.TrustedProxies); err != nil {
+		log.Printf("trusted proxies: %v", err)
+	}
+	r.Use(otelgin.Middleware(telemetry.ServiceName))
+	r.Use(middleware.CorsMiddleware(s.cfg.CORS))
 
 	// Initialize DAOs
 	todoDao := database.NewTodoDAO(*s.db.GetDB())
 	userDao := database.NewUserDAO(*s.db.GetDB())
+	userTokenDao := database.NewUserTokenDAO(*s.db.GetDB())
+	oidcStateDao := database.NewOIDCStateDAO(*s.db.GetDB())
+	accessTokenDao := database.NewAccessTokenDAO(*s.db.GetDB())
+	auditEventDao := database.NewAuditEventDAO(*s.db.GetDB())
+	todoRevisionDao := database.NewTodoRevisionDAO(*s.db.GetDB(), s.cfg.Todo.MaxRevisions)
+
+	auditRecorder := audit.NewRecorder(auditEventDao, s.cfg.Audit.Retention)
 
 	// Initialize Handlers
-	healthHandler := handlers.NewHealthController(s.db)
-	todoHandler := handlers.NewTodoHandler(todoDao, userDao)
-	userHandler := handlers.NewUserHandler(userDao)
+	healthHandler := handlers.NewHealthController(s.health)
+	todoHandler := handlers.NewTodoHandler(todoDao, todoRevisionDao, userDao, s.db, auditRecorder)
+	emailHandler := handlers.NewEmailHandler(userDao, userTokenDao, s.userJWT, s.loginGuard, s.mailer, s.hasher, auditRecorder, s.cfg.Server.PublicURL, s.cfg.Email)
+	userHandler := handlers.NewUserHandler(userDao, s.userJWT, s.loginGuard, s.mailer, emailHandler, s.passwords, s.hasher, auditRecorder)
+	mfaHandler := handlers.NewMFAHandler(userDao, s.userJWT, s.loginGuard, s.hasher, auditRecorder, s.cfg.MFA)
+	oidcHandler := handlers.NewOIDCHandler(userDao, oidcStateDao, accessTokenDao, s.userJWT, s.providers, auditRecorder, s.cfg.OIDC.StateTTL)
+	accessTokenHandler := handlers.NewAccessTokenHandler(userDao, accessTokenDao, auditRecorder)
+	calendarHandler := handlers.NewCalendarHandler(userDao, todoDao, auditRecorder, s.cfg.Server.PublicURL)
+	adminHandler := handlers.NewAdminHandler(userDao, todoDao, auditEventDao, accessTokenDao, s.userJWT, auditRecorder)
+	passwordHandler := handlers.NewPasswordHandler(userDao, userTokenDao, s.userJWT, accessTokenDao, s.loginGuard, s.mailer, s.passwords, s.hasher, auditRecorder, s.cfg.Password)
+
+	// personal access tokens are only accepted by the todo routes
+	auth := middleware.AuthMiddleware(s.userJWT, accessTokenDao, userDao)
+	todoRead := middleware.AuthMiddleware(s.userJWT, accessTokenDao, userDao, entity.ScopeTodosRead)
+	todoWrite := middleware.AuthMiddleware(s.userJWT, accessTokenDao, userDao, entity.ScopeTodosWrite)
+	staff := middleware.RequireRole(entity.RoleSupport, entity.RoleAdmin)
+	adminOnly := middleware.RequireRole(entity.RoleAdmin)
+	verified := middleware.VerifiedEmailMiddleware(userDao, s.cfg.Email.VerificationPolicy)
+	authLimit, userLimit, todoLimit := s.rateLimits()
 
 	// Swagger
 	docs.SwaggerInfo.BasePath = "/"
@@ -35,6 +72,8 @@ func (s *Server) RegisterRoutes() http.Handler {
 	// Health routes
 	r.GET("/", healthHandler.HelloWorldHandler)
 	r.GET("/health", healthHandler.HealthHandler)
+	r.GET("/livez", healthHandler.LivenessHandler)
+	r.GET("/readyz", healthHandler.ReadinessHandler)
 
 	// Cors
 	r.OPTIONS("/*any", func(c *gin.Context) {
@@ -44,26 +83,111 @@ func (s *Server) RegisterRoutes() http.Handler {
 	//User routes
 	user := r.Group("/user")
 	{
-		user.POST("", userHandler.Create)
-		user.GET("/:id", middleware.AuthMiddleware(), userHandler.GetUser)
-		user.PUT("/:id", middleware.AuthMiddleware(), userHandler.Update)
-		user.DELETE("/:id", middleware.AuthMiddleware(), userHandler.Delete)
+		user.POST("", authLimit, userHandler.Create)
+		user.GET("/:id", auth, userLimit, userHandler.GetUser)
+		user.PUT("/:id", auth, userLimit, userHandler.Update)
+		user.DELETE("/:id", auth, userLimit, userHandler.Delete)
+		user.PATCH("", auth, userLimit, userHandler.Patch)
 
 		//Auth routes
-		user.POST("/login", userHandler.Login)
-		user.POST("/refresh", userHandler.Refresh)
-		user.POST("/logout", middleware.AuthMiddleware(), userHandler.Logout)
+		user.POST("/login", authLimit, userHandler.Login)
+		user.POST("/refresh", authLimit, userHandler.Refresh)
+		user.POST("/logout", auth, userLimit, userHandler.Logout)
+		user.POST("/login/mfa", authLimit, mfaHandler.Login)
+
+		//MFA routes
+		user.POST("/mfa/totp", auth, userLimit, mfaHandler.Setup)
+		user.POST("/mfa/totp/confirm", auth, userLimit, mfaHandler.Confirm)
+		user.DELETE("/mfa/totp", auth, userLimit, mfaHandler.Disable)
+		user.POST("/mfa/recovery-codes", auth, userLimit, mfaHandler.RegenerateRecoveryCodes)
+
+		//Personal access token routes
+		user.POST("/tokens", auth, userLimit, accessTokenHandler.Create)
+		user.GET("/tokens", auth, userLimit, accessTokenHandler.List)
+		user.DELETE("/tokens/:id", auth, userLimit, accessTokenHandler.Delete)
+
+		//Calendar feed routes
+		user.GET("/calendar", auth, userLimit, calendarHandler.Get)
+		user.POST("/calendar", auth, userLimit, calendarHandler.Rotate)
+		user.DELETE("/calendar", auth, userLimit, calendarHandler.Disable)
+
+		//Password routes
+		user.POST("/password/forgot", authLimit, passwordHandler.Forgot)
+		user.POST("/password/reset", authLimit, passwordHandler.Reset)
+		user.PUT("/password", auth, userLimit, passwordHandler.Change)
+
+		//Email routes
+		user.PUT("/email", auth, userLimit, emailHandler.Change)
+		user.GET("/email/confirm", authLimit, emailHandler.ConfirmChange)
+		user.GET("/verify", authLimit, emailHandler.Verify)
+		user.POST("/verify/resend", authLimit, emailHandler.Resend)
+	}
+
+	//OIDC routes
+	oidc := r.Group("/auth/oidc")
+	{
+		oidc.GET("", oidcHandler.Providers)
+		oidc.GET("/:provider", authLimit, oidcHandler.Login)
+		oidc.GET("/:provider/callback", authLimit, oidcHandler.Callback)
 	}
 
+	// the feed token is the credential, calendar apps can't log in
+	r.GET("/calendar/:file", authLimit, calendarHandler.Feed)
+
 	//Todo routes
 	todo := r.Group("/todo")
 	{
-		todo.GET("/pagination", middleware.AuthMiddleware(), todoHandler.GetAll)
-		todo.GET("/:id", middleware.AuthMiddleware(), todoHandler.Get)
-		todo.POST("", middleware.AuthMiddleware(), todoHandler.Create)
-		todo.PUT("/:id", middleware.AuthMiddleware(), todoHandler.Update)
-		todo.DELETE("/:id", middleware.AuthMiddleware(), todoHandler.Delete)
+		todo.GET("/pagination", todoRead, todoLimit, todoHandler.GetAll)
+		todo.GET("/today", todoRead, todoLimit, todoHandler.Today)
+		todo.GET("/upcoming", todoRead, todoLimit, todoHandler.Upcoming)
+		todo.GET("/:id", todoRead, todoLimit, todoHandler.Get)
+		todo.POST("", todoWrite, todoLimit, verified, todoHandler.Create)
+		todo.PUT("/:id", todoWrite, todoLimit, verified, todoHandler.Update)
+		todo.PATCH("/:id", todoWrite, todoLimit, verified, todoHandler.Patch)
+		todo.POST("/bulk", todoWrite, todoLimit, verified, todoHandler.Bulk)
+		todo.GET("/export", todoRead, todoLimit, todoHandler.Export)
+		todo.POST("/import", todoWrite, todoLimit, verified, todoHandler.Import)
+		todo.DELETE("/:id", todoWrite, todoLimit, verified, todoHandler.Delete)
+		todo.GET("/:id/history", todoRead, todoLimit, todoHandler.History)
+		todo.POST("/:id/restore/:rev", todoWrite, todoLimit, verified, todoHandler.Restore)
+		todo.GET("/trash", todoRead, todoLimit, todoHandler.ListTrash)
+		todo.POST("/:id/restore", todoWrite, todoLimit, verified, todoHandler.Untrash)
+		todo.DELETE("/trash/:id", todoWrite, todoLimit, verified, todoHandler.Purge)
+		todo.DELETE("/trash", todoWrite, todoLimit, verified, todoHandler.EmptyTrash)
+	}
+
+	//Admin routes
+	admin := r.Group("/admin", auth, userLimit, staff)
+	{
+		admin.GET("/users", adminHandler.ListUsers)
+		admin.GET("/users/:id", adminHandler.GetUser)
+		admin.GET("/users/:id/todos/count", adminHandler.TodoCounts)
+		admin.POST("/users/:id/disable", adminHandler.Disable)
+		admin.POST("/users/:id/enable", adminHandler.Enable)
+		admin.POST("/users/:id/logout", adminHandler.Logout)
+		admin.PUT("/users/:id/role", adminOnly, adminHandler.ChangeRole)
+		admin.GET("/audit", adminOnly, adminHandler.SearchAudit)
 	}
 
 	return r
 }
+
+// rateLimits builds the throttling middleware of the auth, user and todo
+// route groups, or no-ops when rate limiting is disabled.
+func (s *Server) rateLimits() (gin.HandlerFunc, gin.HandlerFunc, gin.HandlerFunc) {
+
+	cfg := s.cfg.RateLimit
+	if !cfg.Enabled {
+		noop := func(c *gin.Context) { c.Next() }
+		return noop, noop, noop
+	}
+
+	store := ratelimit.NewMemoryStore()
+	if cfg.Store == "mongo" {
+		store = database.NewRateLimitDAO(*s.db.GetDB())
+	}
+
+	return middleware.RateLimitMiddleware(store, "auth", ratelimit.Rate(cfg.Auth), middleware.ByIP),
+		middleware.RateLimitMiddleware(store, "user", ratelimit.Rate(cfg.User), middleware.ByUser),
+		middleware.RateLimitMiddleware(store, "todo", ratelimit.Rate(cfg.Todo), middleware.ByUser)
+}
@@ -1,38 +1,123 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"net/http"
-	"os"
-	"strconv"
 	"time"
 
+	"todo-app-mongo/internal/config"
 	"todo-app-mongo/internal/database"
-
-	_ "github.com/joho/godotenv/autoload"
+	"todo-app-mongo/internal/entity"
+	"todo-app-mongo/internal/pkg/audit"
+	"todo-app-mongo/internal/pkg/health"
+	"todo-app-mongo/internal/pkg/mailer"
+	"todo-app-mongo/internal/pkg/security"
+	"todo-app-mongo/internal/pkg/sso"
+	"todo-app-mongo/internal/pkg/worker"
 )
 
 type Server struct {
-	port int
-	db   database.Service
+	cfg        *config.Config
+	db         database.Service
+	userJWT    security.UserJWTInterface
+	loginGuard *security.LoginGuard
+	passwords  *security.PasswordPolicy
+	hasher     security.PasswordHasher
+	mailer     mailer.Mailer
+	providers  *sso.Providers
+	health     *health.Registry
+	lifecycle  *Lifecycle
 }
 
-func NewServer() *http.Server {
-	port, _ := strconv.Atoi(os.Getenv("PORT"))
+func NewServer(ctx context.Context, cfg *config.Config) (*Server, error) {
+
+	db, err := database.New(ctx, cfg.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := database.EnsureIndexes(ctx, db.GetDB()); err != nil {
+		return nil, err
+	}
+
+	if err := database.Migrate(ctx, db.GetDB(), cfg); err != nil {
+		return nil, err
+	}
+
+	if len(cfg.Admin.Emails) > 0 {
+		promoted, err := database.NewUserDAO(*db.GetDB()).GrantRole(ctx, cfg.Admin.Emails, entity.RoleAdmin)
+		if err != nil {
+			return nil, err
+		}
+		if promoted > 0 {
+			log.Printf("granted the admin role to %d account(s) from admin.emails", promoted)
+		}
+	}
+
+	mail, err := mailer.New(cfg.Mailer)
+	if err != nil {
+		return nil, err
+	}
+
+	passwords, err := security.NewPasswordPolicy(cfg.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	hasher := security.NewPasswordHasher(cfg.Password)
+	loginGuard, err := security.NewLoginGuard(cfg.Login, hasher)
+	if err != nil {
+		return nil, err
+	}
 
 	NewServer := &Server{
-		port: port,
-		db:   database.New(),
+		cfg:        cfg,
+		db:         db,
+		userJWT:    security.NewUserJWT(cfg.JWT),
+		loginGuard: loginGuard,
+		passwords:  passwords,
+		hasher:     hasher,
+		mailer:     mail,
+		providers:  sso.New(cfg.OIDC, cfg.Server.PublicURL),
+		health:     health.NewRegistry(cfg.Health.CacheTTL, cfg.Health.CheckTimeout),
 	}
 
+	NewServer.health.Register("mongo", health.Readiness, NewServer.db.Ping)
+
 	// Declare Server config
 	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", NewServer.port),
+		Addr:         fmt.Sprintf(":%d", cfg.Server.Port),
 		Handler:      NewServer.RegisterRoutes(),
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
 
-	return server
+	NewServer.lifecycle = NewLifecycle(server, NewServer.health, cfg.Server.DrainDelay, cfg.Server.ShutdownTimeout)
+	NewServer.lifecycle.OnStop("mongo", NewServer.db.Close)
+
+	if cfg.Todo.TrashRetention > 0 {
+		mongoDB := *db.GetDB()
+		recorder := audit.NewRecorder(database.NewAuditEventDAO(mongoDB), cfg.Audit.Retention)
+		purge := purgeTrash(database.NewTodoDAO(mongoDB), database.NewTodoRevisionDAO(mongoDB, cfg.Todo.MaxRevisions), recorder, cfg.Todo.TrashRetention)
+		purger := worker.Start("trash purge", cfg.Todo.PurgeInterval, purge)
+		NewServer.health.Register("trash purge", health.Liveness, purger.Check)
+		// registered after mongo, so it stops first
+		NewServer.lifecycle.OnStop("trash purge", purger.Stop)
+	}
+
+	return NewServer, nil
+}
+
+// OnStop registers a background component to stop during shutdown.
+func (s *Server) OnStop(name string, fn StopFunc) {
+	s.lifecycle.OnStop(name, fn)
+}
+
+// Run serves HTTP until a termination signal arrives, then shuts down
+// gracefully.
+func (s *Server) Run(ctx context.Context) error {
+	return s.lifecycle.Run(ctx)
 }
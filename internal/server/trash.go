@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"todo-app-mongo/internal/database"
+	"todo-app-mongo/internal/entity"
+	"todo-app-mongo/internal/pkg/audit"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// purgeBatchSize bounds the todos read per query, so a large backlog
+// isn't loaded at once.
+const purgeBatchSize = 500
+
+// purgeTrash returns the job deleting the todos trashed longer than
+// retention ago, with their history, and recording each deletion in the
+// audit log.
+func purgeTrash(todos database.TodoDAOInterface, revisions database.TodoRevisionDAOInterface, recorder *audit.Recorder, retention time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+
+		before := time.Now().Add(-retention)
+		var purged int64
+
+		for {
+			trashed, err := todos.TrashedBefore(ctx, before, purgeBatchSize)
+			if err != nil {
+				return err
+			}
+
+			for _, todo := range trashed {
+				// a todo restored since the read is left alone
+				err := todos.DeleteTrashedBefore(ctx, todo.ID, before)
+				if err == mongo.ErrNoDocuments {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				purged++
+
+				recorder.RecordJob(ctx, &entity.AuditEvent{
+					Action:     entity.AuditTodoPurge,
+					TargetType: entity.AuditTargetTodo,
+					TargetID:   todo.ID.Hex(),
+					Changes:    audit.Diff(todo, nil),
+					Details:    map[string]string{"job": "trash purge", "user_id": todo.UserID.Hex()},
+				})
+
+				// the todo is gone, a failure only leaves its revisions
+				// behind
+				if err := revisions.DeleteByTodo(ctx, todo.ID); err != nil {
+					log.Printf("deleting revisions of todo %s: %v", todo.ID.Hex(), err)
+				}
+			}
+
+			if len(trashed) < purgeBatchSize {
+				break
+			}
+		}
+
+		if purged > 0 {
+			log.Printf("purged %d todo(s) from the trash", purged)
+		}
+
+		return nil
+	}
+}